@@ -0,0 +1,101 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/config"
+)
+
+const configUsage = `Usage: archiver_service config print [-json] [-sources] [config flags]
+
+Prints the effective config after merging flags, env, .env, the config file
+and defaults (in that order of precedence). The output is valid .env,
+except for secrets: ADMIN_TOKEN and the DOWNLOAD_PROXY password are hidden,
+their lines are commented out.
+Exits with 1 and lists every problem if the config is invalid.
+`
+
+// runConfig - archiver_service config print.
+func runConfig(args []string, stdout, stderr io.Writer) int {
+	if len(args) == 0 || args[0] != "print" {
+		fmt.Fprint(stderr, configUsage)
+		return 2
+	}
+
+	loader := &config.Loader{}
+	fs := flag.NewFlagSet("config print", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {
+		fmt.Fprint(stderr, configUsage)
+		fs.PrintDefaults()
+	}
+	jsonOut := fs.Bool("json", false, "print JSON")
+	withSources := fs.Bool("sources", false, "show where each value came from")
+	loader.RegisterFlags(fs)
+	if err := fs.Parse(args[1:]); err != nil {
+		return 2
+	}
+	if fs.NArg() > 0 {
+		fs.Usage()
+		return 2
+	}
+
+	cfg, sources, err := loader.LoadWithSources()
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	values := cfg.Values()
+
+	if *jsonOut {
+		out := any(values)
+		if *withSources {
+			type entry struct {
+				Value  string `json:"value"`
+				Source string `json:"source"`
+			}
+			entries := make(map[string]entry, len(values))
+			for k, v := range values {
+				entries[k] = entry{Value: v, Source: sources[k]}
+			}
+			out = entries
+		}
+		enc := json.NewEncoder(stdout)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(out); err != nil {
+			fmt.Fprintln(stderr, "error:", err)
+			return 1
+		}
+		return 0
+	}
+
+	for _, key := range config.Keys() {
+		line := key + "=" + quoteEnv(values[key])
+		switch {
+		case key == "ADMIN_TOKEN" && values[key] != "":
+			// Токен скрыт, "***" в .env включил бы админку с чужим токеном.
+			line = "# " + key + " is set, hidden"
+		case key == "DOWNLOAD_PROXY" && values[key] != cfg.DownloadProxy:
+			// Пароль прокси заменен на xxxxx, с ним прокси молча перестал бы пускать.
+			line = "# " + key + "=" + quoteEnv(values[key]) + " (password hidden)"
+		}
+		if *withSources {
+			line += " # " + sources[key]
+		}
+		fmt.Fprintln(stdout, line)
+	}
+	return 0
+}
+
+// quoteEnv берет значение в кавычки, если без них .env его не прочитает.
+func quoteEnv(v string) string {
+	if strings.ContainsAny(v, " #\"'") {
+		return strconv.Quote(v)
+	}
+	return v
+}
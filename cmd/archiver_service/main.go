@@ -2,179 +2,188 @@ package main
 
 import (
 	"context"
-	"encoding/json"
-	"io"
-	"log"
+	"errors"
+	"flag"
+	"log/slog"
 	"net/http"
 	"os"
-	"path/filepath"
+	"os/signal"
 	"strings"
+	"syscall"
 	"time"
 
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/api"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/health"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/janitor"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/metrics"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/task"
 	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/taskmanager"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/tracing"
 	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/config"
 )
 
-func main() {
-	cfg := config.NewConfig()
-
-	// Дебаг мод
-	debug := cfg.Mode == "debug"
-
-	taskManager := taskmanager.NewTaskManager(cfg.MaxTasks, log.Default(), debug)
-
-	// GET /task - создать новую таску, вернуть uuid
-	http.HandleFunc("/task", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method != http.MethodGet {
-			w.WriteHeader(http.StatusMethodNotAllowed)
-			return
-		}
+// Версия, проставляется при сборке: -ldflags "-X main.version=..." (см. Makefile).
+var version = "dev"
 
-		id, err := taskManager.CreateTask([]string{})
-		if err != nil {
-			w.WriteHeader(http.StatusTooManyRequests)
-			if err := json.NewEncoder(w).Encode(map[string]string{"error": "server busy"}); err != nil {
-				log.Printf("Failed to encode error response: %v", err)
-			}
-			return
-		}
+// Сколько ждать отправки последних спанов. Отдельно от SHUTDOWN_GRACE:
+// его к этому моменту обычно съели зависшие таски.
+const traceFlushTimeout = 5 * time.Second
 
-		if err := json.NewEncoder(w).Encode(map[string]string{"task_id": id}); err != nil {
-			log.Printf("Failed to encode task_id response: %v", err)
+func main() {
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "pack": // Одноразовый режим без сервера.
+			ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+			code := runPack(ctx, os.Args[2:], os.Stdin, os.Stdout, os.Stderr)
+			stop()
+			os.Exit(code)
+		case "config":
+			os.Exit(runConfig(os.Args[2:], os.Stdout, os.Stderr))
 		}
-	})
+	}
 
-	// POST /task/{task_id} и GET /task/{task_id}
-	http.HandleFunc("/task/", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-		if len(parts) < 2 || parts[0] != "task" {
-			log.Printf("Not found: %s", r.URL.Path)
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-		taskID := parts[1]
-
-		if r.Method == http.MethodPost {
-			var req struct {
-				URL string `json:"url"`
-			}
-
-			if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
-				log.Printf("Invalid body for task %s", taskID)
-				w.WriteHeader(http.StatusBadRequest)
-				if err := json.NewEncoder(w).Encode(map[string]string{"error": "invalid body"}); err != nil {
-					log.Printf("Failed to encode error response: %v", err)
-				}
-				return
-			}
-
-			log.Printf("Add url to task %s: %s", taskID, req.URL)
-			err := taskManager.AddURL(taskID, []string{req.URL})
-			if err != nil {
-				log.Printf("Task not found: %s", taskID)
-				w.WriteHeader(http.StatusNotFound)
-				if err := json.NewEncoder(w).Encode(map[string]string{"error": "task not found"}); err != nil {
-					log.Printf("Failed to encode error response: %v", err)
-				}
-				return
-			}
-
-			status, _ := taskManager.GetStatus(taskID)
-			log.Printf("Task %s status after add: %s", taskID, status)
-			if err := json.NewEncoder(w).Encode(map[string]string{"status": string(status)}); err != nil {
-				log.Printf("Failed to encode status response: %v", err)
-			}
-			return
-		}
+	// Флаги > env > .env > файл конфига > значения по умолчанию.
+	loader := &config.Loader{}
+	loader.RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	cfg, err := loader.Load()
+	if err != nil {
+		slog.Error("invalid config", "error", err)
+		os.Exit(1)
+	}
 
-		if r.Method == http.MethodGet {
-			status, err := taskManager.GetStatus(taskID)
-			if err != nil {
-				log.Printf("Task not found: %s", taskID)
-				w.WriteHeader(http.StatusNotFound)
-				if err := json.NewEncoder(w).Encode(map[string]string{"error": "task not found"}); err != nil {
-					log.Printf("Failed to encode error response: %v", err)
-				}
-				return
-			}
-
-			resp := map[string]string{"status": string(status)}
-			if status == "completed" {
-				resp["download_url"] = "/download/" + taskID
-				log.Printf("Task %s completed, archive ready", taskID)
-			}
-
-			log.Printf("Task %s status: %s", taskID, status)
-			if err := json.NewEncoder(w).Encode(resp); err != nil {
-				log.Printf("Failed to encode response: %v", err)
-			}
-			return
+	logger, err := logging.New(cfg.LogLevel, cfg.LogFormat, os.Stderr)
+	if err != nil {
+		slog.Error("invalid logging config", "error", err)
+		os.Exit(1)
+	}
+	// Всё, что пишет через log или slog по умолчанию, тоже уйдет в этот логгер.
+	slog.SetDefault(logger)
+
+	// Трейсинг: без OTEL_EXPORTER_OTLP_ENDPOINT спаны никуда не уходят.
+	var exporter tracing.Exporter = tracing.NoopExporter{}
+	if cfg.OTLPEndpoint != "" {
+		exporter = tracing.NewOTLPExporter(cfg.OTLPEndpoint, cfg.ServiceName, logger.With("component", "tracing"))
+		logger.Info("tracing enabled", "endpoint", cfg.OTLPEndpoint)
+	}
+	tracer := tracing.NewTracer(exporter)
+	tracing.SetDefault(tracer)
+
+	taskManager := taskmanager.NewTaskManager(cfg, logger.With("component", "taskmanager"))
+
+	// Уборка старых тасок и осиротевших директорий.
+	cleaner := janitor.NewJanitor(cfg.TmpPath, janitor.Policy{
+		TTL: map[task.TaskStatus]time.Duration{
+			task.StatusPending:   cfg.TTLPending,
+			task.StatusCompleted: cfg.TTLCompleted,
+			task.StatusFailed:    cfg.TTLFailed,
+			task.StatusCancelled: cfg.TTLFailed,
+		},
+		MaxDiskUsage: cfg.MaxDiskUsage,
+		Interval:     cfg.CleanupInterval,
+	}, taskManager, logger.With("component", "janitor"))
+	cleaner.Start()
+
+	// Проверки для /readyz.
+	checker := health.NewChecker()
+	checker.Add("tmp_path_writable", health.Writable(cfg.TmpPath))
+	checker.Add("free_disk", health.FreeSpace(cfg.TmpPath, cfg.MinFreeDisk))
+	checker.Add("actor", taskManager.Ping)
+	checker.Add("download_transport", taskManager.CheckTransport)
+	checker.Add("draining", func(ctx context.Context) error {
+		if taskManager.Draining() {
+			return errors.New("shutting down")
 		}
-
-		log.Printf("Method not allowed: %s", r.Method)
-		w.WriteHeader(http.StatusMethodNotAllowed)
+		return nil
 	})
 
-	// GET /download/{task_id}
-	http.HandleFunc("/download/", func(w http.ResponseWriter, r *http.Request) {
-		log.Printf("%s %s from %s", r.Method, r.URL.Path, r.RemoteAddr)
-		parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
-		if len(parts) < 2 || parts[0] != "download" {
-			log.Printf("Not found: %s", r.URL.Path)
-			w.WriteHeader(http.StatusNotFound)
-			return
-		}
-
-		// Берем с url id
-		taskID := parts[1]
-		archivePath := filepath.Join("/tmp/archiver", taskID, "archive.zip")
-		f, err := os.Open(archivePath)
-		if err != nil {
-			log.Printf("Archive not found for task %s", taskID)
-			w.WriteHeader(http.StatusNotFound)
-			if err := json.NewEncoder(w).Encode(map[string]string{"error": "archive not found"}); err != nil {
-				log.Printf("Failed to encode error response: %v", err)
-			}
-			return
-		}
-		defer func() {
-			if err := f.Close(); err != nil {
-				log.Printf("Failed to close file: %v", err)
-			}
-		}()
-
-		// Заголовки
-		w.Header().Set("Content-Type", "application/zip")
-		w.Header().Set("Content-Disposition", "attachment; filename=archive.zip")
-		log.Printf("Serving archive for task %s", taskID)
-		if _, err := io.Copy(w, f); err != nil {
-			log.Printf("Failed to copy file to response: %v", err)
-		}
-	})
+	// Хосты из url клиентов в лейбл не пускаем как есть, только из списка.
+	metrics.SetHosts(strings.Split(cfg.MetricsHosts, ","))
+
+	// Метрики, которые считаются в момент скрейпа.
+	metrics.Default.NewGaugeFunc("archiver_actor_mailbox_depth",
+		"Commands waiting in the task manager actor mailbox.",
+		func() float64 { return float64(taskManager.MailboxDepth()) })
+	metrics.Default.NewGaugeFunc("archiver_slots_used",
+		"Task slots taken by pending and processing tasks.",
+		func() float64 { return float64(taskManager.SlotsUsed()) })
+	metrics.Default.NewGaugeFunc("archiver_slots_max",
+		"Total task slots.",
+		func() float64 { return float64(taskManager.MaxTasks()) })
+	metrics.Default.NewGaugeFunc("archiver_download_connections",
+		"Downloads in progress across all tasks.",
+		func() float64 { return float64(taskManager.DownloadConnections()) })
+	metrics.Default.NewGaugeFunc("archiver_slot_utilization",
+		"Share of task slots in use, 0..1.",
+		func() float64 { return float64(taskManager.SlotsUsed()) / float64(max(taskManager.MaxTasks(), 1)) })
+
+	// Все маршруты: /api/v1, старые /task и /download, /healthz, /metrics и т.д.
+	apiServer := api.NewServer(taskManager, checker, version)
+	apiServer.SetConfigLoader(loader.Load)
 
 	server := &http.Server{
-		Addr: cfg.Port,
+		Addr:     cfg.Port,
+		Handler:  logging.Middleware(logger, tracing.Middleware(apiServer.Handler())),
+		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelWarn),
 	}
 
 	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	// SIGHUP - перечитать конфиг, лимиты применяются без перезапуска.
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			reloadConfig(loader, taskManager, logger)
+		}
+	}()
 
 	go func() {
-		log.Printf("Server starting on %s", cfg.Port)
+		logger.Info("server starting", "addr", cfg.Port, "version", version)
 		if err := server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
-			log.Fatalf("Server failed to start: %v", err)
+			logger.Error("server failed to start", "error", err)
+			os.Exit(1)
 		}
 	}()
 
-	<-stop
-	log.Println("Shutting down server...")
+	sig := <-stop
+	logger.Info("shutting down server", "signal", sig.String())
 
-	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	// Один бюджет времени на HTTP запросы и запущенные таски, у трейсов свой.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.ShutdownGrace)
 	defer cancel()
 
+	// Сначала перестаем принимать запросы, потом ждем таски.
 	if err := server.Shutdown(ctx); err != nil {
-		log.Fatalf("Server forced to shutdown: %v", err)
+		logger.Warn("server forced to shutdown", "error", err)
 	}
+	if err := taskManager.Shutdown(ctx); err != nil {
+		logger.Warn("tasks did not finish in time", "grace", cfg.ShutdownGrace.String(), "error", err)
+	}
+	cleaner.Stop()
+	flushCtx, cancelFlush := context.WithTimeout(context.Background(), traceFlushTimeout)
+	defer cancelFlush()
+	if err := tracer.Shutdown(flushCtx); err != nil {
+		logger.Warn("failed to flush traces", "error", err)
+	}
+
+	logger.Info("server exited gracefully")
+}
 
-	log.Println("Server exited gracefully")
+// reloadConfig перечитывает конфиг по SIGHUP. Кривой конфиг не применяется,
+// сервис продолжает работать со старым.
+func reloadConfig(loader *config.Loader, tm *taskmanager.TaskManager, logger *slog.Logger) {
+	logger.Info("reloading config", "signal", "SIGHUP")
+	cfg, err := loader.Load()
+	if err != nil {
+		logger.Error("config reload failed, keeping the old one", "error", err)
+		return
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := tm.Reconfigure(ctx, cfg); err != nil {
+		logger.Error("config reload failed, keeping the old one", "error", err)
+	}
 }
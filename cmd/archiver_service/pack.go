@@ -0,0 +1,285 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/task"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/taskmanager"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/config"
+)
+
+const packUsage = `Usage: archiver_service pack -o out.zip [-template T] [-collision S] [-no-manifest] [-json] [-v] [urls.txt|-]
+
+Downloads URLs (one per line, # for comments) and packs them into a zip
+without starting the server. Reads stdin if no file is given.
+A line may be "URL PATH" to set the path inside the archive,
+-template names the rest, e.g. {index:2}-{name}. Same names are told apart
+by -collision: suffix (default), host or hash. The archive gets manifest.json
+and README.txt listing every URL, -no-manifest leaves them out.
+Uses the same config (MAX_FILES, ALLOWED_EXT, MAX_FILE_SIZE_MB, ...),
+including $CONFIG_FILE and ./.env.
+Exits with 1 if nothing was packed.
+`
+
+// Как часто pack спрашивает статус таски.
+const packPollInterval = 100 * time.Millisecond
+
+// packManifest - что получилось: что упаковали и что нет.
+type packManifest struct {
+	Output string           `json:"output,omitempty"`
+	Packed []string         `json:"packed"`
+	Failed []task.FileError `json:"failed"`
+	Files  []task.FileEntry `json:"files,omitempty"` // Имена в архиве.
+}
+
+// runPack - одноразовый режим: скачать, упаковать, выйти.
+// Работает через тот же TaskManager, что и сервер, только с временной TMP_PATH,
+// чтобы janitor запущенного сервера не снес нашу директорию.
+func runPack(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("pack", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, packUsage) }
+	out := fs.String("o", "", "output zip file")
+	jsonOut := fs.Bool("json", false, "print the manifest as JSON")
+	verbose := fs.Bool("v", false, "log with LOG_LEVEL instead of warn")
+	template := fs.String("template", "", "file name template")
+	collision := fs.String("collision", "", "same names in the archive: suffix, host or hash")
+	noManifest := fs.Bool("no-manifest", false, "no manifest.json and README.txt in the archive")
+	if err := fs.Parse(args); err != nil {
+		return 2
+	}
+	if *out == "" || fs.NArg() > 1 {
+		fs.Usage()
+		return 2
+	}
+
+	urls, paths, err := readURLList(fs.Arg(0), stdin)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 2
+	}
+
+	cfg, err := config.Load()
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 2
+	}
+	if len(urls) == 0 {
+		fmt.Fprintln(stderr, "error: no urls")
+		return 2
+	}
+	if len(urls) > cfg.MaxFiles {
+		fmt.Fprintf(stderr, "error: %d urls, but MAX_FILES is %d\n", len(urls), cfg.MaxFiles)
+		return 2
+	}
+
+	level := "warn"
+	if *verbose {
+		level = cfg.LogLevel
+	}
+	logger, err := logging.New(level, cfg.LogFormat, stderr)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 2
+	}
+
+	tmp, err := os.MkdirTemp("", "archiver-pack-")
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+		return 1
+	}
+	defer os.RemoveAll(tmp)
+	cfg.TmpPath = tmp
+	cfg.MaxTasks = 1
+
+	tm := taskmanager.NewTaskManager(cfg, logger)
+	defer func() { _ = tm.Shutdown(context.Background()) }()
+
+	opts := taskmanager.TaskOptions{NameTemplate: *template, Collision: *collision}
+	if *noManifest {
+		opts.Manifest = new(bool)
+	}
+	manifest, err := pack(ctx, tm, urls, paths, opts, *out)
+	if err != nil {
+		fmt.Fprintln(stderr, "error:", err)
+	}
+	if manifest != nil {
+		printManifest(stdout, manifest, len(urls), *jsonOut)
+	}
+	if err != nil || len(manifest.Packed) == 0 {
+		return 1
+	}
+	return 0
+}
+
+// pack прогоняет urls через TaskManager и кладет архив в out.
+// paths - пути в архиве (url -> путь), opts - шаблон имен и т.п.
+func pack(ctx context.Context, tm *taskmanager.TaskManager, urls []string, paths map[string]string, opts taskmanager.TaskOptions, out string) (*packManifest, error) {
+	manifest := &packManifest{Packed: []string{}, Failed: []task.FileError{}}
+
+	id, err := tm.CreateTask(ctx, nil, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	// По одной, чтобы плохая url не утянула за собой остальные.
+	accepted := 0
+	for _, u := range urls {
+		var path map[string]string
+		if p, ok := paths[u]; ok {
+			path = map[string]string{u: p}
+		}
+		err := tm.AddFiles(ctx, id, []string{u}, taskmanager.TaskOptions{Paths: path})
+		switch {
+		case err == nil:
+			accepted++
+		case errors.Is(err, taskmanager.ErrURLRejected):
+			manifest.Failed = append(manifest.Failed, task.FileError{URL: u, Error: err.Error()})
+		default:
+			return manifest, err
+		}
+	}
+	if accepted == 0 {
+		return manifest, nil
+	}
+
+	// Если набралось MAX_FILES url, таска уже стартовала сама.
+	if err := tm.StartTask(ctx, id); err != nil && !errors.Is(err, taskmanager.ErrTaskSealed) {
+		return manifest, err
+	}
+
+	snap, err := waitTask(ctx, tm, id)
+	if err != nil {
+		_ = tm.CancelTask(context.Background(), id)
+		return manifest, err
+	}
+	manifest.Failed = append(manifest.Failed, snap.Errors...)
+	if snap.Status != task.StatusCompleted {
+		return manifest, nil
+	}
+
+	archivePath, ok := tm.ArchivePath(id)
+	if !ok {
+		return manifest, errors.New("archive not found")
+	}
+	if err := moveFile(archivePath, out); err != nil {
+		return manifest, err
+	}
+	manifest.Output = out
+	manifest.Packed = snap.URLs
+	manifest.Files = snap.Files
+	return manifest, nil
+}
+
+// waitTask ждет, пока таска завершится.
+func waitTask(ctx context.Context, tm *taskmanager.TaskManager, id string) (task.Snapshot, error) {
+	ticker := time.NewTicker(packPollInterval)
+	defer ticker.Stop()
+	for {
+		snap, err := tm.GetTask(ctx, id)
+		if err != nil {
+			return snap, err
+		}
+		if snap.Status.IsFinished() {
+			return snap, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return snap, ctx.Err()
+		}
+	}
+}
+
+func printManifest(w io.Writer, m *packManifest, total int, asJSON bool) {
+	if asJSON {
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		_ = enc.Encode(m)
+		return
+	}
+	if m.Output != "" {
+		fmt.Fprintf(w, "packed %d of %d urls into %s\n", len(m.Packed), total, m.Output)
+	} else {
+		fmt.Fprintf(w, "nothing packed, %d urls\n", total)
+	}
+	for _, f := range m.Files {
+		if f.RenamedFrom != "" {
+			fmt.Fprintf(w, "renamed %s -> %s (%s)\n", f.RenamedFrom, f.Name, f.URL)
+		}
+	}
+	if len(m.Failed) > 0 {
+		fmt.Fprintln(w, "failed:")
+		for _, f := range m.Failed {
+			fmt.Fprintf(w, "  %s: %s\n", f.URL, f.Error)
+		}
+	}
+}
+
+// readURLList читает url из файла, "" или "-" - из stdin.
+// После url через пробел можно указать путь в архиве.
+func readURLList(name string, stdin io.Reader) ([]string, map[string]string, error) {
+	r := stdin
+	if name != "" && name != "-" {
+		f, err := os.Open(name)
+		if err != nil {
+			return nil, nil, err
+		}
+		defer f.Close()
+		r = f
+	}
+
+	var urls []string
+	paths := make(map[string]string)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, p, _ := strings.Cut(strings.ReplaceAll(line, "\t", " "), " ")
+		urls = append(urls, u)
+		if p = strings.TrimSpace(p); p != "" {
+			paths[u] = p
+		}
+	}
+	return urls, paths, sc.Err()
+}
+
+// moveFile переносит src в dst, если rename не вышел (другой диск) - копирует.
+func moveFile(src, dst string) error {
+	if err := os.Rename(src, dst); err == nil {
+		return nil
+	}
+
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	tmp := dst + ".part"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	return os.Rename(tmp, dst)
+}
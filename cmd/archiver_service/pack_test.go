@@ -0,0 +1,233 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newFileServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("content of " + r.URL.Path))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func runPackTest(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := runPack(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestPack_PartialFailure(t *testing.T) {
+	t.Setenv("ALLOWED_EXT", ".pdf .jpg")
+	t.Setenv("MAX_FILES", "3")
+	files := newFileServer(t)
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out.zip")
+
+	list := filepath.Join(dir, "urls.txt")
+	content := files.URL + "/a.pdf\n# comment\n" + files.URL + "/missing.pdf\n" + files.URL + "/c.exe\n"
+	if err := os.WriteFile(list, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write urls: %v", err)
+	}
+
+	code, stdout, stderr := runPackTest(t, "", "-o", out, "-json", list)
+	if code != 0 {
+		t.Fatalf("Expected exit 0, got %d: %s", code, stderr)
+	}
+
+	var m packManifest
+	if err := json.Unmarshal([]byte(stdout), &m); err != nil {
+		t.Fatalf("Expected JSON manifest, got %q: %v", stdout, err)
+	}
+	if len(m.Packed) != 1 || len(m.Failed) != 2 {
+		t.Errorf("Expected 1 packed and 2 failed, got %+v", m)
+	}
+
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("Expected zip archive: %v", err)
+	}
+	defer zr.Close()
+	// Файл и README.txt с manifest.json, в манифесте и то, что не скачалось.
+	if len(zr.File) != 3 {
+		t.Fatalf("Expected 3 files in archive, got %d", len(zr.File))
+	}
+	rc, err := zr.File[1].Open()
+	if err != nil {
+		t.Fatalf("Failed to open %s: %v", zr.File[1].Name, err)
+	}
+	defer rc.Close()
+	var manifest struct {
+		Files []struct {
+			URL    string `json:"url"`
+			Name   string `json:"name"`
+			SHA256 string `json:"sha256"`
+			Error  string `json:"error"`
+		} `json:"files"`
+	}
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		t.Fatalf("Expected manifest.json, got %s: %v", zr.File[1].Name, err)
+	}
+	if len(manifest.Files) != 2 {
+		t.Fatalf("Expected 2 urls in manifest, got %+v", manifest.Files)
+	}
+	if f := manifest.Files[0]; f.Name != "a.pdf" || len(f.SHA256) != 64 {
+		t.Errorf("Expected a.pdf with sha256, got %+v", f)
+	}
+	if f := manifest.Files[1]; f.Name != "" || !strings.Contains(f.Error, "404") {
+		t.Errorf("Expected missing.pdf with 404, got %+v", f)
+	}
+}
+
+func TestPack_NothingPacked(t *testing.T) {
+	t.Setenv("ALLOWED_EXT", ".pdf .jpg")
+	files := newFileServer(t)
+	out := filepath.Join(t.TempDir(), "out.zip")
+
+	code, stdout, _ := runPackTest(t, files.URL+"/missing.pdf\n", "-o", out)
+	if code != 1 {
+		t.Errorf("Expected exit 1, got %d", code)
+	}
+	if !strings.Contains(stdout, "nothing packed") || !strings.Contains(stdout, "/missing.pdf") {
+		t.Errorf("Expected failure manifest, got %q", stdout)
+	}
+	if _, err := os.Stat(out); !os.IsNotExist(err) {
+		t.Error("Expected no archive")
+	}
+}
+
+func TestPack_Usage(t *testing.T) {
+	if code, _, _ := runPackTest(t, "http://example.com/a.pdf\n"); code != 2 {
+		t.Errorf("Expected exit 2 without -o, got %d", code)
+	}
+	t.Setenv("MAX_FILES", "1")
+	stdin := "http://example.com/a.pdf\nhttp://example.com/b.pdf\n"
+	if code, _, stderr := runPackTest(t, stdin, "-o", "x.zip"); code != 2 || !strings.Contains(stderr, "MAX_FILES") {
+		t.Errorf("Expected exit 2 for too many urls, got %d %q", code, stderr)
+	}
+}
+
+func TestPack_Names(t *testing.T) {
+	t.Setenv("ARCHIVE_MANIFEST", "false")
+	t.Setenv("ALLOWED_EXT", ".pdf .jpg")
+	t.Setenv("MAX_FILES", "3")
+	files := newFileServer(t)
+	out := filepath.Join(t.TempDir(), "out.zip")
+
+	stdin := files.URL + "/download.pdf?id=77 invoice-2026-10/01-scan.pdf\n" +
+		files.URL + "/b.jpg\n" +
+		files.URL + "/c.pdf\tother/\n"
+	code, _, stderr := runPackTest(t, stdin, "-o", out, "-template", "{index:2}-{name}")
+	if code != 0 {
+		t.Fatalf("Expected exit 0, got %d: %s", code, stderr)
+	}
+
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("Expected zip archive: %v", err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	want := []string{"invoice-2026-10/01-scan.pdf", "02-b.jpg", "other/03-c.pdf"}
+	if strings.Join(names, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected entries %v, got %v", want, names)
+	}
+}
+
+func TestPack_DuplicateNames(t *testing.T) {
+	t.Setenv("ARCHIVE_MANIFEST", "false")
+	t.Setenv("ALLOWED_EXT", ".pdf .jpg")
+	t.Setenv("MAX_FILES", "3")
+	first, second := newFileServer(t), newFileServer(t)
+	out := filepath.Join(t.TempDir(), "out.zip")
+
+	stdin := first.URL + "/image.jpg\n" + second.URL + "/image.jpg\n" + first.URL + "/IMAGE.jpg\n"
+	code, stdout, stderr := runPackTest(t, stdin, "-o", out, "-json")
+	if code != 0 {
+		t.Fatalf("Expected exit 0, got %d: %s", code, stderr)
+	}
+	var m packManifest
+	if err := json.Unmarshal([]byte(stdout), &m); err != nil {
+		t.Fatalf("Expected JSON manifest, got %q: %v", stdout, err)
+	}
+	if len(m.Files) != 3 || m.Files[1].Name != "image-2.jpg" || m.Files[1].RenamedFrom != "image.jpg" || m.Files[2].Name != "IMAGE-3.jpg" {
+		t.Errorf("Expected renamed duplicates in manifest, got %+v", m.Files)
+	}
+
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("Expected zip archive: %v", err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if want := "image.jpg image-2.jpg IMAGE-3.jpg"; strings.Join(names, " ") != want {
+		t.Errorf("Expected entries %q, got %v", want, names)
+	}
+}
+
+func TestPack_NamesFromResponse(t *testing.T) {
+	t.Setenv("ARCHIVE_MANIFEST", "false")
+	t.Setenv("ALLOWED_EXT", ".pdf .jpg")
+	t.Setenv("MAX_FILES", "3")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Query().Get("id") {
+		case "42":
+			w.Header().Set("Content-Type", "application/pdf")
+		case "43":
+			w.Header().Set("Content-Disposition", `attachment; filename*=UTF-8''Invoice%2043.pdf`)
+		case "44":
+			w.Header().Set("Content-Type", "application/x-msdownload")
+		}
+		_, _ = w.Write([]byte("%PDF-1.4"))
+	}))
+	defer srv.Close()
+	out := filepath.Join(t.TempDir(), "out.zip")
+
+	stdin := srv.URL + "/download?id=42\n" + srv.URL + "/download?id=43\n" + srv.URL + "/download?id=44\n"
+	code, stdout, stderr := runPackTest(t, stdin, "-o", out, "-json")
+	if code != 0 {
+		t.Fatalf("Expected exit 0, got %d: %s", code, stderr)
+	}
+	var m packManifest
+	if err := json.Unmarshal([]byte(stdout), &m); err != nil {
+		t.Fatalf("Expected JSON manifest, got %q: %v", stdout, err)
+	}
+	if len(m.Failed) != 1 || !strings.Contains(m.Failed[0].URL, "id=44") {
+		t.Errorf("Expected id=44 to fail by content type, got %+v", m.Failed)
+	}
+
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("Expected zip archive: %v", err)
+	}
+	defer zr.Close()
+	var names []string
+	for _, f := range zr.File {
+		names = append(names, f.Name)
+	}
+	if want := "download.pdf Invoice 43.pdf"; strings.Join(names, " ") != want {
+		t.Errorf("Expected entries %q, got %v", want, names)
+	}
+}
@@ -0,0 +1,483 @@
+// archiverctl - консольный клиент для archiver_service.
+//
+//	archiverctl create https://example.com/a.pdf https://example.com/b.jpg --wait -o out.zip
+//	archiverctl create -f urls.txt
+//	cat urls.txt | archiverctl create -f - --wait -o out.zip
+//	archiverctl status <id>
+//	archiverctl list -status failed,cancelled -all
+//	archiverctl cancel <id>
+//	archiverctl download <id> -o out.zip
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/client"
+)
+
+const usage = `Usage: archiverctl [-server URL] [-owner NAME] [-json] <command> [args]
+
+Commands:
+  create [url...] [-f file|-] [--wait] [-o out.zip] [--no-start]
+         [-name NAME] [-template T] [-collision suffix|host|hash] [-no-manifest]
+                         create a task, URLs from args, a file or stdin (-f -);
+                         a file line may be "URL PATH" to set the path inside the archive
+  status <id>            show task state
+  list [-status s1,s2] [-owner NAME] [-errors] [-sort FIELD] [-limit N] [-cursor C] [-all]
+                         list tasks, newest first; -all follows all pages
+  cancel <id>            cancel a task
+  download <id> [-o out.zip]
+                         download the archive (to stdout if -o is not set)
+
+Global flags:
+  -server URL            service address (default $ARCHIVER_URL or http://localhost:8080)
+  -owner NAME            owner of created tasks (default $ARCHIVER_OWNER)
+  -json                  print JSON instead of text
+`
+
+// Коды выхода.
+const (
+	exitOK    = 0
+	exitError = 1
+	exitUsage = 2
+)
+
+// errUsage - неправильные аргументы, печатаем usage.
+var errUsage = errors.New("usage")
+
+// app - общие для команд настройки.
+type app struct {
+	client   *client.Client
+	json     bool
+	stdin    io.Reader
+	stdout   io.Writer
+	stderr   io.Writer
+	interval time.Duration
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	defer stop()
+	os.Exit(run(ctx, os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+func run(ctx context.Context, args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	fs := flag.NewFlagSet("archiverctl", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() { fmt.Fprint(stderr, usage) }
+	server := fs.String("server", envOr("ARCHIVER_URL", "http://localhost:8080"), "service address")
+	owner := fs.String("owner", os.Getenv("ARCHIVER_OWNER"), "owner of created tasks")
+	jsonOut := fs.Bool("json", false, "print JSON")
+	if err := fs.Parse(args); err != nil {
+		return exitUsage
+	}
+	if fs.NArg() == 0 {
+		fs.Usage()
+		return exitUsage
+	}
+
+	a := &app{
+		client:   client.NewClient(*server, client.WithOwner(*owner)),
+		json:     *jsonOut,
+		stdin:    stdin,
+		stdout:   stdout,
+		stderr:   stderr,
+		interval: time.Second,
+	}
+
+	var err error
+	cmd, cmdArgs := fs.Arg(0), fs.Args()[1:]
+	switch cmd {
+	case "create":
+		err = a.create(ctx, cmdArgs)
+	case "status":
+		err = a.status(ctx, cmdArgs)
+	case "list":
+		err = a.list(ctx, cmdArgs)
+	case "cancel":
+		err = a.cancel(ctx, cmdArgs)
+	case "download":
+		err = a.download(ctx, cmdArgs)
+	default:
+		fmt.Fprintf(stderr, "unknown command %q\n\n", cmd)
+		err = errUsage
+	}
+
+	switch {
+	case err == nil:
+		return exitOK
+	case errors.Is(err, errUsage):
+		fmt.Fprint(stderr, usage)
+		return exitUsage
+	default:
+		fmt.Fprintln(stderr, "error:", err)
+		return exitError
+	}
+}
+
+// create - создать таску, запустить и, если нужно, дождаться и скачать.
+func (a *app) create(ctx context.Context, args []string) error {
+	fs := newFlagSet("create", a.stderr)
+	file := fs.String("f", "", "read URLs from file, - for stdin")
+	wait := fs.Bool("wait", false, "wait for the task to finish")
+	out := fs.String("o", "", "download the archive to this file (implies --wait)")
+	noStart := fs.Bool("no-start", false, "leave the task pending")
+	name := fs.String("name", "", "archive file name")
+	template := fs.String("template", "", "file name template, e.g. {index:2}-{name}")
+	collision := fs.String("collision", "", "same names in the archive: suffix, host or hash")
+	noManifest := fs.Bool("no-manifest", false, "no manifest.json and README.txt in the archive")
+	urls, err := parseInterspersed(fs, args)
+	if err != nil {
+		return errUsage
+	}
+
+	var paths map[string]string
+	if *file != "" {
+		fromFile, filePaths, err := a.readURLsFrom(*file)
+		if err != nil {
+			return err
+		}
+		urls = append(urls, fromFile...)
+		paths = filePaths
+	}
+
+	opts := client.CreateOptions{
+		ArchiveName:  *name,
+		NameTemplate: *template,
+		Paths:        paths,
+		Collision:    *collision,
+	}
+	if *noManifest {
+		opts.Manifest = new(bool)
+	}
+	t, err := a.client.CreateTaskWith(ctx, urls, opts)
+	if err != nil {
+		return err
+	}
+	a.progress("created task %s (%d urls)", t.TaskID, len(t.URLs))
+
+	// Сервис сам стартует таску, когда набралось MAX_FILES url,
+	// иначе стартуем руками.
+	if !*noStart && len(urls) > 0 && t.Status == client.StatusPending {
+		started, err := a.client.Start(ctx, t.TaskID)
+		switch {
+		case err == nil:
+			t = started
+		case !errors.Is(err, client.ErrTaskSealed): // Уже стартовала сама.
+			return err
+		}
+	}
+
+	if *wait || *out != "" {
+		if t, err = a.wait(ctx, t.TaskID); err != nil {
+			return err
+		}
+	}
+	if err := a.printTask(t); err != nil {
+		return err
+	}
+	if t.Status == client.StatusFailed || t.Status == client.StatusCancelled {
+		return fmt.Errorf("task %s %s", t.TaskID, t.Status)
+	}
+	if *out != "" {
+		return a.save(ctx, t.TaskID, *out)
+	}
+	return nil
+}
+
+// status - показать таску.
+func (a *app) status(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	t, err := a.client.Status(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return a.printTask(t)
+}
+
+// list - поиск по таскам. Без -all печатает одну страницу
+// и курсор следующей.
+func (a *app) list(ctx context.Context, args []string) error {
+	fs := newFlagSet("list", a.stderr)
+	statuses := fs.String("status", "", "comma-separated statuses")
+	owner := fs.String("owner", "", "only tasks of this owner")
+	withErrors := fs.Bool("errors", false, "only tasks with failed urls")
+	sort := fs.String("sort", "", "created_at, updated_at, - for descending")
+	limit := fs.Int("limit", 0, "page size")
+	cursor := fs.String("cursor", "", "next_cursor from the previous page")
+	all := fs.Bool("all", false, "follow next_cursor until the last page")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil || len(rest) != 0 {
+		return errUsage
+	}
+
+	opts := client.ListOptions{Owner: *owner, Sort: *sort, Limit: *limit, Cursor: *cursor}
+	if *statuses != "" {
+		for _, s := range strings.Split(*statuses, ",") {
+			opts.Statuses = append(opts.Statuses, client.Status(strings.TrimSpace(s)))
+		}
+	}
+	if *withErrors {
+		opts.HasErrors = withErrors
+	}
+
+	page := &client.TaskPage{Tasks: []client.Task{}}
+	for {
+		next, err := a.client.ListTasks(ctx, opts)
+		if err != nil {
+			return err
+		}
+		page.Tasks = append(page.Tasks, next.Tasks...)
+		page.NextCursor = next.NextCursor
+		if !*all || next.NextCursor == "" {
+			break
+		}
+		opts.Cursor = next.NextCursor
+	}
+
+	if a.json {
+		return a.printJSON(page)
+	}
+	tw := tabwriter.NewWriter(a.stdout, 0, 4, 2, ' ', 0)
+	fmt.Fprintln(tw, "ID\tSTATUS\tURLS\tERRORS\tOWNER\tCREATED")
+	for _, t := range page.Tasks {
+		fmt.Fprintf(tw, "%s\t%s\t%d\t%d\t%s\t%s\n", t.TaskID, t.Status, len(t.URLs), len(t.Errors), t.Owner, t.CreatedAt.Format(time.RFC3339))
+	}
+	if err := tw.Flush(); err != nil {
+		return err
+	}
+	if page.NextCursor != "" {
+		a.progress("more tasks: list -cursor %s", page.NextCursor)
+	}
+	return nil
+}
+
+// cancel - отменить таску.
+func (a *app) cancel(ctx context.Context, args []string) error {
+	if len(args) != 1 {
+		return errUsage
+	}
+	t, err := a.client.Cancel(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	return a.printTask(t)
+}
+
+// download - скачать архив в файл или stdout.
+func (a *app) download(ctx context.Context, args []string) error {
+	fs := newFlagSet("download", a.stderr)
+	out := fs.String("o", "", "output file (default stdout)")
+	rest, err := parseInterspersed(fs, args)
+	if err != nil || len(rest) != 1 {
+		return errUsage
+	}
+	if *out == "" {
+		_, err := a.client.Download(ctx, rest[0], a.stdout)
+		return err
+	}
+	return a.save(ctx, rest[0], *out)
+}
+
+// wait опрашивает таску и печатает смену статуса.
+func (a *app) wait(ctx context.Context, taskID string) (*client.Task, error) {
+	var last client.Status
+	for {
+		t, err := a.client.Status(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+		if t.Status != last {
+			a.progress("task %s: %s", taskID, t.Status)
+			last = t.Status
+		}
+		if t.Status.IsFinished() {
+			return t, nil
+		}
+		select {
+		case <-time.After(a.interval):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// save качает архив в файл через .part, чтобы не оставить обрезанный zip.
+func (a *app) save(ctx context.Context, taskID, path string) error {
+	tmp := path + ".part"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	n, err := a.client.Download(ctx, taskID, &progressWriter{w: f, report: func(n int64) {
+		a.progress("downloaded %s", formatBytes(n))
+	}})
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, path); err != nil {
+		return err
+	}
+	a.progress("saved %s (%s)", path, formatBytes(n))
+	return nil
+}
+
+// readURLsFrom читает url из файла или stdin ("-").
+func (a *app) readURLsFrom(name string) ([]string, map[string]string, error) {
+	if name == "-" {
+		return readURLs(a.stdin)
+	}
+	f, err := os.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	return readURLs(f)
+}
+
+// readURLs - по url на строку, пустые строки и # комментарии пропускаются.
+// После url через пробел можно указать путь в архиве: "URL invoices/01.pdf".
+func readURLs(r io.Reader) ([]string, map[string]string, error) {
+	var urls []string
+	var paths map[string]string
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		u, p, _ := strings.Cut(strings.ReplaceAll(line, "\t", " "), " ")
+		urls = append(urls, u)
+		if p = strings.TrimSpace(p); p != "" {
+			if paths == nil {
+				paths = make(map[string]string)
+			}
+			paths[u] = p
+		}
+	}
+	return urls, paths, sc.Err()
+}
+
+// ----- Вывод -----
+
+func (a *app) printTask(t *client.Task) error {
+	if a.json {
+		return a.printJSON(t)
+	}
+	fmt.Fprintf(a.stdout, "id:      %s\nstatus:  %s\n", t.TaskID, t.Status)
+	for _, u := range t.URLs {
+		fmt.Fprintf(a.stdout, "url:     %s\n", u)
+	}
+	if t.FailureReason != "" {
+		fmt.Fprintf(a.stdout, "reason:  %s\n", t.FailureReason)
+	}
+	for _, e := range t.Errors {
+		fmt.Fprintf(a.stdout, "error:   %s: %s\n", e.URL, e.Error)
+	}
+	for _, f := range t.Files {
+		if f.RenamedFrom != "" {
+			fmt.Fprintf(a.stdout, "renamed: %s -> %s (%s)\n", f.RenamedFrom, f.Name, f.URL)
+		}
+	}
+	if t.DownloadURL != "" {
+		fmt.Fprintf(a.stdout, "archive: %s\n", t.DownloadURL)
+	}
+	if t.ArchiveSHA256 != "" {
+		fmt.Fprintf(a.stdout, "sha256:  %s\n", t.ArchiveSHA256)
+	}
+	return nil
+}
+
+func (a *app) printJSON(v any) error {
+	enc := json.NewEncoder(a.stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// progress пишет ход работы в stderr, в JSON режиме молчит,
+// чтобы stdout можно было сразу отдать в другую программу.
+func (a *app) progress(format string, args ...any) {
+	if a.json {
+		return
+	}
+	fmt.Fprintf(a.stderr, format+"\n", args...)
+}
+
+// progressWriter сообщает о скачанном каждые reportEvery байт.
+type progressWriter struct {
+	w      io.Writer
+	n      int64
+	next   int64
+	report func(n int64)
+}
+
+const reportEvery = 4 << 20
+
+func (p *progressWriter) Write(b []byte) (int, error) {
+	n, err := p.w.Write(b)
+	p.n += int64(n)
+	if p.n >= p.next+reportEvery {
+		p.next = p.n
+		p.report(p.n)
+	}
+	return n, err
+}
+
+func formatBytes(n int64) string {
+	switch {
+	case n >= 1<<20:
+		return fmt.Sprintf("%.1f MB", float64(n)/(1<<20))
+	case n >= 1<<10:
+		return fmt.Sprintf("%.1f KB", float64(n)/(1<<10))
+	}
+	return fmt.Sprintf("%d B", n)
+}
+
+// ----- Флаги -----
+
+func newFlagSet(name string, stderr io.Writer) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.Usage = func() {}
+	return fs
+}
+
+// parseInterspersed разрешает флаги после аргументов: create url1 url2 --wait,
+// стандартный flag останавливается на первом аргументе.
+func parseInterspersed(fs *flag.FlagSet, args []string) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		if fs.NArg() == 0 {
+			return rest, nil
+		}
+		rest = append(rest, fs.Arg(0))
+		args = fs.Args()[1:]
+	}
+}
+
+func envOr(key, def string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return def
+}
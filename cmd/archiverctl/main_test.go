@@ -0,0 +1,167 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/api"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/taskmanager"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/client"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/config"
+)
+
+func newTestServer(t *testing.T) string {
+	t.Helper()
+	cfg := config.NewConfig()
+	cfg.TmpPath = t.TempDir()
+	cfg.MaxTasks = 3
+	cfg.MaxFiles = 3
+	cfg.AllowedExtensions = []string{".pdf", ".jpg"}
+
+	tm := taskmanager.NewTaskManager(cfg, nil)
+	srv := httptest.NewServer(api.NewServer(tm, nil, "test").Handler())
+	t.Cleanup(func() {
+		srv.Close()
+		_ = tm.Shutdown(context.Background())
+	})
+	return srv.URL
+}
+
+func runCtl(t *testing.T, stdin string, args ...string) (int, string, string) {
+	t.Helper()
+	var stdout, stderr bytes.Buffer
+	code := run(context.Background(), args, strings.NewReader(stdin), &stdout, &stderr)
+	return code, stdout.String(), stderr.String()
+}
+
+func TestCreateWaitDownload(t *testing.T) {
+	server := newTestServer(t)
+	files := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("content"))
+	}))
+	defer files.Close()
+
+	out := filepath.Join(t.TempDir(), "out.zip")
+	stdin := "# comment\n" + files.URL + "/a.pdf\n\n" + files.URL + "/b.jpg\n"
+	code, stdout, stderr := runCtl(t, stdin, "-server", server,
+		"create", files.URL+"/c.pdf", "-f", "-", "--wait", "-o", out)
+	if code != exitOK {
+		t.Fatalf("Expected exit 0, got %d: %s", code, stderr)
+	}
+	if !strings.Contains(stdout, "status:  completed") {
+		t.Errorf("Expected completed task in output, got %q", stdout)
+	}
+	if !strings.Contains(stderr, "saved "+out) {
+		t.Errorf("Expected progress in stderr, got %q", stderr)
+	}
+
+	zr, err := zip.OpenReader(out)
+	if err != nil {
+		t.Fatalf("Expected zip archive: %v", err)
+	}
+	defer zr.Close()
+	// 3 файла и README.txt с manifest.json.
+	if len(zr.File) != 5 {
+		t.Errorf("Expected 5 files, got %d", len(zr.File))
+	}
+}
+
+func TestJSONMode(t *testing.T) {
+	server := newTestServer(t)
+
+	code, stdout, stderr := runCtl(t, "", "-server", server, "-json", "create", "--no-start")
+	if code != exitOK {
+		t.Fatalf("Expected exit 0, got %d: %s", code, stderr)
+	}
+	if stderr != "" {
+		t.Errorf("Expected no progress output in JSON mode, got %q", stderr)
+	}
+	var created client.Task
+	if err := json.Unmarshal([]byte(stdout), &created); err != nil {
+		t.Fatalf("Expected JSON task, got %q: %v", stdout, err)
+	}
+
+	code, stdout, _ = runCtl(t, "", "-server", server, "-json", "cancel", created.TaskID)
+	if code != exitOK || !strings.Contains(stdout, `"cancelled"`) {
+		t.Errorf("Expected cancelled task, got %d %q", code, stdout)
+	}
+
+	code, stdout, _ = runCtl(t, "", "-server", server, "-json", "list")
+	var page client.TaskPage
+	if err := json.Unmarshal([]byte(stdout), &page); err != nil || code != exitOK {
+		t.Fatalf("Expected JSON list, got %d %q: %v", code, stdout, err)
+	}
+	if len(page.Tasks) != 1 || page.Tasks[0].TaskID != created.TaskID {
+		t.Errorf("Unexpected tasks: %+v", page.Tasks)
+	}
+}
+
+func TestListPages(t *testing.T) {
+	server := newTestServer(t)
+	for _, owner := range []string{"alice", "bob", "alice"} {
+		if code, _, stderr := runCtl(t, "", "-server", server, "-owner", owner, "create", "--no-start"); code != exitOK {
+			t.Fatalf("Expected exit 0, got %d: %s", code, stderr)
+		}
+	}
+
+	code, stdout, stderr := runCtl(t, "", "-server", server, "list", "-limit", "1")
+	if code != exitOK || strings.Count(stdout, "\n") != 2 || !strings.Contains(stderr, "-cursor") {
+		t.Errorf("Expected one task and a cursor, got %d %q %q", code, stdout, stderr)
+	}
+
+	code, stdout, _ = runCtl(t, "", "-server", server, "-json", "list", "-owner", "alice", "-limit", "1", "-all")
+	var page client.TaskPage
+	if err := json.Unmarshal([]byte(stdout), &page); err != nil || code != exitOK {
+		t.Fatalf("Expected JSON list, got %d %q: %v", code, stdout, err)
+	}
+	if len(page.Tasks) != 2 || page.NextCursor != "" {
+		t.Errorf("Expected 2 alice tasks on all pages, got %+v", page)
+	}
+	for _, task := range page.Tasks {
+		if task.Owner != "alice" {
+			t.Errorf("Expected owner alice, got %q", task.Owner)
+		}
+	}
+
+	if code, _, stderr := runCtl(t, "", "-server", server, "list", "-status", "bogus"); code != exitError || !strings.Contains(stderr, "invalid_request") {
+		t.Errorf("Expected exit 1 with invalid_request, got %d %q", code, stderr)
+	}
+}
+
+func TestErrorsAndUsage(t *testing.T) {
+	server := newTestServer(t)
+
+	if code, _, stderr := runCtl(t, "", "-server", server, "status", "nope"); code != exitError || !strings.Contains(stderr, "not_found") {
+		t.Errorf("Expected exit 1 with not_found, got %d %q", code, stderr)
+	}
+	if code, _, _ := runCtl(t, "", "-server", server, "status"); code != exitUsage {
+		t.Errorf("Expected usage exit code, got %d", code)
+	}
+	if code, _, _ := runCtl(t, "", "-server", server, "frobnicate"); code != exitUsage {
+		t.Errorf("Expected usage exit code, got %d", code)
+	}
+	if code, _, stderr := runCtl(t, "", "-server", server, "create", "http://example.com/a.exe"); code != exitError || !strings.Contains(stderr, "url_rejected") {
+		t.Errorf("Expected exit 1 with url_rejected, got %d %q", code, stderr)
+	}
+}
+
+func TestParseInterspersed(t *testing.T) {
+	fs := newFlagSet("test", &bytes.Buffer{})
+	wait := fs.Bool("wait", false, "")
+	out := fs.String("o", "", "")
+
+	rest, err := parseInterspersed(fs, []string{"a", "--wait", "b", "-o", "x.zip", "c"})
+	if err != nil {
+		t.Fatalf("Unexpected error: %v", err)
+	}
+	if strings.Join(rest, ",") != "a,b,c" || !*wait || *out != "x.zip" {
+		t.Errorf("Unexpected result: %v wait=%v o=%q", rest, *wait, *out)
+	}
+}
@@ -2,8 +2,12 @@ package actor
 
 import (
 	"context"
-	"log"
+	"errors"
+	"log/slog"
 	"maps"
+	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/tracing"
 )
 
 // Handler описывает функцию-обработчик команды:
@@ -14,45 +18,56 @@ type Handler func(ctx context.Context, payload any) error
 // ActorInterface задаёт методы актора:
 // Register - регистрирует обработчик для action,
 // Send - отправляет сообщение с action и payload,
-// Stop - останавливает цикл обработки.
+// SendContext - то же, но с контекстом отправителя (трейсинг и отмена ожидания),
+// Stop - останавливает цикл обработки,
+// Done - закрывается, когда актор остановлен,
+// Len - сколько сообщений ждет в очереди.
 type ActorInterface interface {
 	Register(action string, handler Handler)
 	Send(action string, payload any)
+	SendContext(ctx context.Context, action string, payload any) error
 	Stop()
+	Done() <-chan struct{}
+	Len() int
 }
 
+// ErrStopped - актор остановлен, сообщение никто не обработает.
+var ErrStopped = errors.New("actor stopped")
+
 // actorImpl - приватный тип.
 type actorImpl struct {
 	mailbox  chan message
 	handlers map[string]Handler
+	ctx      context.Context // Отменяется в Stop.
 	cancel   context.CancelFunc
-	logger   *log.Logger
-	debug    bool
+	logger   *slog.Logger
 }
 
 // message - внутренняя структура сообщений.
 type message struct {
-	action  string
-	payload any
+	ctx      context.Context
+	action   string
+	payload  any
+	enqueued time.Time
 }
 
 // NewActor создаёт и запускает актора:
 // bufferSize - размер буфера очереди,
 // handlersInit - начальные обработчики (можно nil),
-// logger - логгер для сообщений (если nil, используется log.Default()),
-// debug - включить вывод отладочных сообщений.
-func NewActor(bufferSize int, handlersInit map[string]Handler, logger *log.Logger, debug bool) ActorInterface {
+// logger - логгер для сообщений (если nil, используется slog.Default()),
+// отладочные сообщения пишутся на уровне debug.
+func NewActor(bufferSize int, handlersInit map[string]Handler, logger *slog.Logger) ActorInterface {
 	ctx, cancel := context.WithCancel(context.Background())
 	if logger == nil {
-		logger = log.Default() // На всякий случай.
+		logger = slog.Default() // На всякий случай.
 	}
 	// Приватный "класс" Actor
 	a := &actorImpl{
 		mailbox:  make(chan message, bufferSize),
 		handlers: make(map[string]Handler),
+		ctx:      ctx,
 		cancel:   cancel,
 		logger:   logger,
-		debug:    debug,
 	}
 	maps.Copy(a.handlers, handlersInit) // Копия.
 
@@ -67,13 +82,27 @@ func (a *actorImpl) Register(action string, handler Handler) {
 
 // Send передает сообщение актору.
 // Если action не зарегистрирован, сообщение будет проигнорировано.
+// Остановленному актору - тоже.
 func (a *actorImpl) Send(action string, payload any) {
-	msg := message{action: action, payload: payload}
+	_ = a.SendContext(context.Background(), action, payload)
+}
+
+// SendContext передает сообщение актору вместе с контекстом отправителя.
+// При переполненном почтовом ящике ждет, пока не отменят ctx или не
+// остановят актора. Для хендлера из ctx берется только родительский спан:
+// он работает с контекстом актора.
+func (a *actorImpl) SendContext(ctx context.Context, action string, payload any) error {
+	if a.ctx.Err() != nil {
+		return ErrStopped // Иначе select мог бы положить в ящик, который никто не разберет.
+	}
+	msg := message{ctx: ctx, action: action, payload: payload, enqueued: time.Now()}
 	select {
 	case a.mailbox <- msg:
-	default:
-		// Блокируем при переполнении буфера.
-		a.mailbox <- msg
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-a.ctx.Done():
+		return ErrStopped
 	}
 }
 
@@ -82,27 +111,51 @@ func (a *actorImpl) Stop() {
 	a.cancel()
 }
 
+// Done закрывается после Stop.
+func (a *actorImpl) Done() <-chan struct{} {
+	return a.ctx.Done()
+}
+
+// Len возвращает количество сообщений в почтовом ящике.
+func (a *actorImpl) Len() int {
+	return len(a.mailbox)
+}
+
 // start обрабатывает сообщения до завершения контекста.
 func (a *actorImpl) start(ctx context.Context) {
 	for {
 		select {
 		case <-ctx.Done():
-			if a.debug {
-				a.logger.Println("Actor stopped")
-			}
+			a.logger.Debug("actor stopped")
 			return
 
 		case msg := <-a.mailbox:
 			handler, exists := a.handlers[msg.action]
 			if !exists {
-				if a.debug {
-					a.logger.Printf("No handler for action %q", msg.action)
-				}
+				a.logger.Debug("no handler for action", "action", msg.action)
 				continue
 			}
-			if err := handler(ctx, msg.payload); err != nil {
-				a.logger.Printf("Error in handler %q: %v", msg.action, err) // Можно использовать Errorf, но тут не возвращается ошибка
-			}
+			a.handle(ctx, msg, handler)
 		}
 	}
 }
+
+// handle вызывает хендлер внутри спана "actor.<action>".
+// Спан начинается с момента постановки в очередь, а время ожидания
+// в почтовом ящике пишется отдельным атрибутом.
+func (a *actorImpl) handle(ctx context.Context, msg message, handler Handler) {
+	parent := tracing.SpanContextFromContext(msg.ctx)
+	if parent.IsValid() {
+		ctx = tracing.ContextWithRemoteSpanContext(ctx, parent)
+	}
+	ctx, span := tracing.Start(ctx, "actor."+msg.action,
+		tracing.WithStartTime(msg.enqueued),
+		tracing.WithAttrs(tracing.Attr{Key: "actor.mailbox_wait_ms", Value: time.Since(msg.enqueued).Milliseconds()}),
+	)
+	defer span.End()
+
+	if err := handler(ctx, msg.payload); err != nil {
+		span.RecordError(err)
+		a.logger.Error("actor handler failed", "action", msg.action, "error", err)
+	}
+}
@@ -0,0 +1,154 @@
+package api
+
+import (
+	"crypto/subtle"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/config"
+)
+
+// Админка: смотреть и менять конфиг на лету.
+// Закрыта токеном ADMIN_TOKEN (Authorization: Bearer ...), без токена выключена.
+
+// AdminConfigResponse - действующий конфиг.
+type AdminConfigResponse struct {
+	Config          map[string]string `json:"config"`                     // Как переменные окружения, токен скрыт.
+	Live            []string          `json:"live"`                       // Что меняется без перезапуска.
+	RestartRequired []string          `json:"restart_required,omitempty"` // Что изменилось, но применится только после рестарта.
+}
+
+// ConfigPatch - тело PATCH /admin/config, пустые поля не меняются.
+type ConfigPatch struct {
+	MaxTasks        *int     `json:"max_tasks,omitempty"`
+	MaxFiles        *int     `json:"max_files,omitempty"`
+	MaxFileSizeMB   *int64   `json:"max_file_size_mb,omitempty"`
+	AllowedExt      []string `json:"allowed_ext,omitempty"`
+	ArchiveManifest *bool    `json:"archive_manifest,omitempty"`
+
+	DownloadMaxConns        *int   `json:"download_max_conns,omitempty"`
+	DownloadMaxConnsPerHost *int   `json:"download_max_conns_per_host,omitempty"`
+	DownloadBandwidthKB     *int64 `json:"download_bandwidth_kb,omitempty"`
+	TaskBandwidthKB         *int64 `json:"task_bandwidth_kb,omitempty"`
+
+	HostFailureThreshold *int    `json:"host_failure_threshold,omitempty"`
+	HostCooldown         *string `json:"host_cooldown,omitempty"` // Как в конфиге: 30s, 2m.
+	HostRequestsPerMin   *int    `json:"host_requests_per_min,omitempty"`
+}
+
+// SetConfigLoader - откуда перечитывать конфиг в POST /admin/config/reload,
+// по умолчанию config.Load.
+func (s *Server) SetConfigLoader(load func() (*config.Config, error)) {
+	s.loadConfig = load
+}
+
+// admin проверяет токен и пускает в h.
+func (s *Server) admin(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cfg := s.tm.Config()
+		if cfg.AdminToken == "" {
+			writeError(w, r, http.StatusNotFound, CodeNotFound, "admin API is disabled", nil)
+			return
+		}
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || subtle.ConstantTimeCompare([]byte(token), []byte(cfg.AdminToken)) != 1 {
+			w.Header().Set("WWW-Authenticate", `Bearer realm="admin"`)
+			writeError(w, r, http.StatusUnauthorized, CodeUnauthorized, "invalid admin token", nil)
+			return
+		}
+		h(w, r)
+	}
+}
+
+// GET /admin/config - действующий конфиг.
+func (s *Server) getConfig(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, newAdminConfigResponse(s.tm.Config(), nil))
+}
+
+// PATCH /admin/config - поменять лимиты.
+func (s *Server) patchConfig(w http.ResponseWriter, r *http.Request) {
+	var patch ConfigPatch
+	if err := decodeJSON(r, &patch); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid body", map[string]any{"reason": err.Error()})
+		return
+	}
+
+	// Через строгие парсеры конфига, как значения из env: иначе
+	// max_tasks=-1000 после int8 стал бы 24, а мегабайты переполнились бы.
+	var set [][2]string
+	setInt := func(key string, v *int) {
+		if v != nil {
+			set = append(set, [2]string{key, strconv.Itoa(*v)})
+		}
+	}
+	setInt64 := func(key string, v *int64) {
+		if v != nil {
+			set = append(set, [2]string{key, strconv.FormatInt(*v, 10)})
+		}
+	}
+	setInt("MAX_TASKS", patch.MaxTasks)
+	setInt("MAX_FILES", patch.MaxFiles)
+	setInt64("MAX_FILE_SIZE_MB", patch.MaxFileSizeMB)
+	if patch.AllowedExt != nil {
+		set = append(set, [2]string{"ALLOWED_EXT", strings.Join(patch.AllowedExt, " ")})
+	}
+	if patch.ArchiveManifest != nil {
+		set = append(set, [2]string{"ARCHIVE_MANIFEST", strconv.FormatBool(*patch.ArchiveManifest)})
+	}
+	setInt("DOWNLOAD_MAX_CONNS", patch.DownloadMaxConns)
+	setInt("DOWNLOAD_MAX_CONNS_PER_HOST", patch.DownloadMaxConnsPerHost)
+	setInt64("DOWNLOAD_BANDWIDTH_KB", patch.DownloadBandwidthKB)
+	setInt64("TASK_BANDWIDTH_KB", patch.TaskBandwidthKB)
+	setInt("HOST_FAILURE_THRESHOLD", patch.HostFailureThreshold)
+	if patch.HostCooldown != nil {
+		set = append(set, [2]string{"HOST_COOLDOWN", *patch.HostCooldown})
+	}
+	setInt("HOST_REQUESTS_PER_MIN", patch.HostRequestsPerMin)
+
+	// Правим в акторе, а не копию из Config(): иначе параллельный PATCH
+	// или SIGHUP откатил бы чужие правки.
+	err := s.tm.UpdateConfig(r.Context(), func(cfg *config.Config) error {
+		for _, kv := range set {
+			if err := cfg.Set(kv[0], kv[1]); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	logging.FromContext(r.Context()).Info("config changed via admin API")
+	writeJSON(w, r, http.StatusOK, newAdminConfigResponse(s.tm.Config(), nil))
+}
+
+// POST /admin/config/reload - перечитать конфиг, как по SIGHUP.
+func (s *Server) reloadConfig(w http.ResponseWriter, r *http.Request) {
+	cfg, err := s.loadConfig()
+	if err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	s.applyConfig(w, r, cfg)
+}
+
+func (s *Server) applyConfig(w http.ResponseWriter, r *http.Request, cfg *config.Config) {
+	restart, err := s.tm.Reconfigure(r.Context(), cfg)
+	if err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	logging.FromContext(r.Context()).Info("config changed via admin API")
+	writeJSON(w, r, http.StatusOK, newAdminConfigResponse(s.tm.Config(), restart))
+}
+
+func newAdminConfigResponse(cfg config.Config, restart []string) AdminConfigResponse {
+	return AdminConfigResponse{
+		Config:          cfg.Values(),
+		Live:            config.LiveKeys,
+		RestartRequired: restart,
+	}
+}
@@ -0,0 +1,90 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/taskmanager"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/config"
+)
+
+// Коды ошибок API, клиенты должны смотреть на них, а не на message.
+const (
+	CodeInvalidRequest  = "invalid_request"
+	CodeUnauthorized    = "unauthorized"
+	CodeNotFound        = "not_found"
+	CodeTaskFull        = "task_full"
+	CodeTaskSealed      = "task_sealed"
+	CodeTaskEmpty       = "task_empty"
+	CodeURLRejected     = "url_rejected"
+	CodeServerBusy      = "server_busy"
+	CodeShuttingDown    = "shutting_down"
+	CodeArchiveNotReady = "archive_not_ready"
+	CodeInternal        = "internal"
+)
+
+// Error - тело ошибки: code - машиночитаемый код,
+// message - для человека, details - подробности (по ситуации).
+type Error struct {
+	Code    string         `json:"code"`
+	Message string         `json:"message"`
+	Details map[string]any `json:"details,omitempty"`
+}
+
+// ErrorResponse - ответ с ошибкой, всегда {"error": {...}}.
+type ErrorResponse struct {
+	Error Error `json:"error"`
+}
+
+// writeError пишет ошибку в формате ErrorResponse.
+func writeError(w http.ResponseWriter, r *http.Request, status int, code, message string, details map[string]any) {
+	writeJSON(w, r, status, ErrorResponse{Error: Error{Code: code, Message: message, Details: details}})
+}
+
+// errorStatus переводит ошибку TaskManager-а в http статус и код API.
+func errorStatus(err error) (int, string) {
+	switch {
+	case errors.Is(err, taskmanager.ErrTaskNotFound):
+		return http.StatusNotFound, CodeNotFound
+	case errors.Is(err, taskmanager.ErrTaskFull):
+		return http.StatusConflict, CodeTaskFull
+	case errors.Is(err, taskmanager.ErrTaskSealed):
+		return http.StatusConflict, CodeTaskSealed
+	case errors.Is(err, taskmanager.ErrTaskEmpty):
+		return http.StatusConflict, CodeTaskEmpty
+	case errors.Is(err, taskmanager.ErrURLRejected):
+		return http.StatusUnprocessableEntity, CodeURLRejected
+	case errors.Is(err, taskmanager.ErrInvalidQuery), errors.Is(err, taskmanager.ErrInvalidOptions),
+		errors.Is(err, config.ErrInvalidConfig):
+		return http.StatusBadRequest, CodeInvalidRequest
+	case errors.Is(err, taskmanager.ErrShuttingDown):
+		return http.StatusServiceUnavailable, CodeShuttingDown
+	case errors.Is(err, taskmanager.ErrBusy):
+		return http.StatusTooManyRequests, CodeServerBusy
+	default:
+		return http.StatusInternalServerError, CodeInternal
+	}
+}
+
+// writeTaskError пишет ошибку TaskManager-а.
+func writeTaskError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := errorStatus(err)
+	message := err.Error()
+	var details map[string]any
+	var rejected *taskmanager.URLRejectedError
+	switch {
+	case errors.As(err, &rejected):
+		details = map[string]any{"url": rejected.URL, "reason": rejected.Reason}
+		if rejected.Detail != "" {
+			details["detail"] = rejected.Detail
+		}
+	case code == CodeServerBusy:
+		// Слот обычно освобождается быстро, клиенту есть смысл повторить.
+		w.Header().Set("Retry-After", "1")
+	case code == CodeInternal:
+		logging.FromContext(r.Context()).Error("request failed", "error", err)
+		message = "internal error" // Внутренности наружу не отдаем.
+	}
+	writeError(w, r, status, code, message, details)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Сколько ждем ответа от актора в проверках.
+const probeTimeout = 2 * time.Second
+
+// GET /healthz - процесс жив.
+func (s *Server) healthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, r, http.StatusOK, map[string]string{"status": "ok"})
+}
+
+// GET /readyz - можно слать трафик.
+func (s *Server) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+	defer cancel()
+
+	ok, checks := s.checker.Run(ctx)
+	code := http.StatusOK
+	status := "ok"
+	if !ok {
+		code = http.StatusServiceUnavailable
+		status = "not ready"
+	}
+	writeJSON(w, r, code, map[string]any{"status": status, "checks": checks})
+}
+
+// GET /status - сводка.
+func (s *Server) status(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), probeTimeout)
+	defer cancel()
+
+	stats, err := s.tm.Stats(ctx)
+	if err != nil {
+		writeJSON(w, r, http.StatusServiceUnavailable, map[string]string{"error": "actor is not responding"})
+		return
+	}
+	writeJSON(w, r, http.StatusOK, map[string]any{
+		"version":    s.version,
+		"draining":   s.tm.Draining(),
+		"active":     stats.Processing,
+		"queued":     stats.Pending,
+		"completed":  stats.Completed,
+		"failed":     stats.Failed,
+		"cancelled":  stats.Cancelled,
+		"max_tasks":  stats.MaxTasks,
+		"slots_free": stats.SlotsFree,
+	})
+}
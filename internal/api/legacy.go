@@ -0,0 +1,88 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/task"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/taskmanager"
+)
+
+// Старое API: тела ответов остались как были ({"error": "..."}),
+// но коды теперь те же, что и в /api/v1.
+
+// legacyError пишет ошибку в старом формате.
+func legacyError(w http.ResponseWriter, r *http.Request, err error) {
+	status, code := errorStatus(err)
+	message := err.Error()
+	switch code {
+	case CodeShuttingDown:
+		message = "server is shutting down"
+	case CodeInternal:
+		logging.FromContext(r.Context()).Error("request failed", "error", err)
+		message = "internal error"
+	}
+	writeJSON(w, r, status, map[string]string{"error": message})
+}
+
+// GET /task - создать новую таску, вернуть uuid
+func (s *Server) legacyCreateTask(w http.ResponseWriter, r *http.Request) {
+	id, err := s.tm.CreateTask(r.Context(), []string{}, taskmanager.TaskOptions{})
+	if err != nil {
+		legacyError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, map[string]string{"task_id": id})
+}
+
+// POST /task/{task_id} - добавить url.
+func (s *Server) legacyAddURL(w http.ResponseWriter, r *http.Request) {
+	taskID := r.PathValue("id")
+	ctx := r.Context()
+	log := logging.FromContext(ctx).With("task_id", taskID)
+
+	var req struct {
+		URL string `json:"url"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.URL == "" {
+		log.Info("invalid body")
+		writeJSON(w, r, http.StatusBadRequest, map[string]string{"error": "invalid body"})
+		return
+	}
+
+	log.Info("add url", "url", logging.RedactURL(req.URL))
+	if err := s.tm.AddURL(ctx, taskID, []string{req.URL}); err != nil {
+		legacyError(w, r, err)
+		return
+	}
+
+	status, _ := s.tm.GetStatus(ctx, taskID)
+	writeJSON(w, r, http.StatusOK, map[string]string{"status": string(status)})
+}
+
+// GET /task/{task_id} - статус.
+func (s *Server) legacyStatus(w http.ResponseWriter, r *http.Request) {
+	taskID := r.PathValue("id")
+	status, err := s.tm.GetStatus(r.Context(), taskID)
+	if err != nil {
+		legacyError(w, r, err)
+		return
+	}
+
+	resp := map[string]string{"status": string(status)}
+	if status == task.StatusCompleted {
+		resp["download_url"] = "/download/" + taskID
+	}
+
+	logging.FromContext(r.Context()).Debug("task status", "task_id", taskID, "status", status)
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// GET /download/{task_id}
+func (s *Server) legacyDownload(w http.ResponseWriter, r *http.Request) {
+	snap, err := s.tm.GetTask(r.Context(), r.PathValue("id"))
+	if err != nil || !s.serveArchive(w, r, snap) {
+		writeJSON(w, r, http.StatusNotFound, map[string]string{"error": "archive not found"})
+	}
+}
@@ -0,0 +1,18 @@
+package api
+
+import (
+	_ "embed"
+	"net/http"
+)
+
+// Спецификация пишется руками, а api_test.go проверяет,
+// что пути и методы в ней совпадают с таблицей маршрутов.
+//
+//go:embed openapi.json
+var openAPISpec []byte
+
+// GET /api/v1/openapi.json - OpenAPI 3 спецификация.
+func (s *Server) openAPI(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	_, _ = w.Write(openAPISpec)
+}
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/health"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/metrics"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/taskmanager"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/config"
+)
+
+// Prefix - префикс текущей версии API.
+const Prefix = "/api/v1"
+
+// Server - HTTP обработчики сервиса: /api/v1, старые /task и /download,
+// проверки здоровья и метрики.
+type Server struct {
+	tm      *taskmanager.TaskManager
+	checker *health.Checker
+	version string
+
+	loadConfig func() (*config.Config, error) // Для /admin/config/reload.
+}
+
+// Конструктор сервера:
+// tm - TaskManager,
+// checker - проверки для /readyz,
+// version - версия сборки для /status.
+func NewServer(tm *taskmanager.TaskManager, checker *health.Checker, version string) *Server {
+	if checker == nil {
+		checker = health.NewChecker()
+	}
+	return &Server{tm: tm, checker: checker, version: version, loadConfig: config.Load}
+}
+
+// route - одна запись в таблице маршрутов.
+// По этой же таблице тест сверяет openapi.json с обработчиками.
+type route struct {
+	method  string
+	pattern string
+	handler http.HandlerFunc
+}
+
+func (s *Server) routes() []route {
+	return []route{
+		// v1
+		{http.MethodPost, Prefix + "/tasks", s.createTask},
+		{http.MethodGet, Prefix + "/tasks", s.listTasks},
+		{http.MethodGet, Prefix + "/tasks/{id}", s.getTask},
+		{http.MethodDelete, Prefix + "/tasks/{id}", s.cancelTask},
+		{http.MethodPost, Prefix + "/tasks/{id}/urls", s.addURLs},
+		{http.MethodPost, Prefix + "/tasks/{id}/start", s.startTask},
+		{http.MethodGet, Prefix + "/tasks/{id}/archive", s.downloadArchive},
+		{http.MethodGet, Prefix + "/openapi.json", s.openAPI},
+
+		// Старое API, оставлено для совместимости.
+		{http.MethodGet, "/task", s.legacyCreateTask},
+		{http.MethodPost, "/task/{id}", s.legacyAddURL},
+		{http.MethodGet, "/task/{id}", s.legacyStatus},
+		{http.MethodGet, "/download/{id}", s.legacyDownload},
+
+		// Служебное.
+		{http.MethodGet, "/healthz", s.healthz},
+		{http.MethodGet, "/readyz", s.readyz},
+		{http.MethodGet, "/status", s.status},
+		{http.MethodGet, "/metrics", metrics.Default.Handler().ServeHTTP},
+
+		// Админка, только с ADMIN_TOKEN.
+		{http.MethodGet, "/admin/config", s.admin(s.getConfig)},
+		{http.MethodPatch, "/admin/config", s.admin(s.patchConfig)},
+		{http.MethodPost, "/admin/config/reload", s.admin(s.reloadConfig)},
+	}
+}
+
+// Handler возвращает роутер со всеми маршрутами.
+func (s *Server) Handler() http.Handler {
+	mux := http.NewServeMux()
+	for _, rt := range s.routes() {
+		mux.HandleFunc(rt.method+" "+rt.pattern, rt.handler)
+	}
+	return mux
+}
+
+// writeJSON пишет ответ в JSON, ошибку кодирования логирует с request_id.
+func writeJSON(w http.ResponseWriter, r *http.Request, code int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logging.FromContext(r.Context()).Warn("failed to encode response", "error", err)
+	}
+}
@@ -0,0 +1,364 @@
+package api
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/task"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/taskmanager"
+)
+
+// Максимальный размер тела запроса, url-ов там немного.
+const maxBodySize = 1 << 20
+
+// CreateTaskRequest - тело POST /api/v1/tasks, url можно передать сразу.
+type CreateTaskRequest struct {
+	URLs         []string          `json:"urls,omitempty"`
+	Owner        string            `json:"owner,omitempty"`
+	ArchiveName  string            `json:"archive_name,omitempty"`  // Имя архива при скачивании.
+	NameTemplate string            `json:"name_template,omitempty"` // Например "{index:2}-{name}".
+	Paths        map[string]string `json:"paths,omitempty"`         // url -> путь в архиве.
+	Collision    string            `json:"collision,omitempty"`     // suffix, host или hash.
+	Manifest     *bool             `json:"manifest,omitempty"`      // nil - ARCHIVE_MANIFEST.
+	Checksums    map[string]string `json:"checksums,omitempty"`     // url -> ожидаемый sha256.
+	// url -> заголовок -> значение (Authorization, Cookie...), только в памяти.
+	Headers map[string]map[string]string `json:"headers,omitempty"`
+}
+
+// AddURLsRequest - тело POST /api/v1/tasks/{id}/urls.
+type AddURLsRequest struct {
+	URLs      []string          `json:"urls"`
+	Paths     map[string]string `json:"paths,omitempty"`
+	Checksums map[string]string `json:"checksums,omitempty"`
+
+	Headers map[string]map[string]string `json:"headers,omitempty"`
+}
+
+// TaskResponse - состояние таски.
+type TaskResponse struct {
+	TaskID      string           `json:"task_id"`
+	Status      task.TaskStatus  `json:"status"`
+	URLs        []string         `json:"urls"`
+	MaxFiles    int              `json:"max_files"`
+	Errors      []task.FileError `json:"errors"`
+	Owner       string           `json:"owner,omitempty"`
+	CreatedAt   time.Time        `json:"created_at"`
+	UpdatedAt   time.Time        `json:"updated_at"`
+	DownloadURL string           `json:"download_url,omitempty"`
+	// Почему failed, если не из-за конкретных url (например, остановка сервиса).
+	FailureReason string `json:"failure_reason,omitempty"`
+
+	ArchiveName  string            `json:"archive_name"`
+	NameTemplate string            `json:"name_template"`
+	Paths        map[string]string `json:"paths,omitempty"`
+	Collision    string            `json:"collision"`
+	Manifest     bool              `json:"manifest"`
+	Checksums    map[string]string `json:"checksums,omitempty"`
+	Files        []task.FileEntry  `json:"files,omitempty"` // Что под каким именем в архиве.
+
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+	// url -> имя заголовка -> "***", значения не отдаются никогда.
+	Headers map[string]map[string]string `json:"headers,omitempty"`
+}
+
+// TaskListResponse - ответ GET /api/v1/tasks.
+type TaskListResponse struct {
+	Tasks      []TaskResponse `json:"tasks"`
+	NextCursor string         `json:"next_cursor,omitempty"` // Пустой - это последняя страница.
+}
+
+func newTaskResponse(snap task.Snapshot) TaskResponse {
+	resp := TaskResponse{
+		TaskID:    snap.TaskID,
+		Status:    snap.Status,
+		URLs:      snap.URLs,
+		MaxFiles:  snap.MaxFiles,
+		Errors:    snap.Errors,
+		Owner:     snap.Owner,
+		CreatedAt: snap.CreatedAt,
+		UpdatedAt: snap.UpdatedAt,
+
+		FailureReason: snap.FailureReason,
+
+		ArchiveName:  snap.ArchiveName,
+		NameTemplate: snap.NameTemplate,
+		Paths:        snap.Paths,
+		Collision:    snap.Collision,
+		Manifest:     snap.Manifest,
+		Checksums:    snap.Checksums,
+		Files:        snap.Files,
+
+		ArchiveSHA256: snap.ArchiveSHA256,
+		Headers:       snap.Headers,
+	}
+	if snap.Status == task.StatusCompleted {
+		resp.DownloadURL = Prefix + "/tasks/" + snap.TaskID + "/archive"
+	}
+	return resp
+}
+
+// decodeJSON читает тело запроса в v, пустое тело - не ошибка.
+func decodeJSON(r *http.Request, v any) error {
+	dec := json.NewDecoder(io.LimitReader(r.Body, maxBodySize))
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	return nil
+}
+
+// POST /api/v1/tasks - создать таску.
+func (s *Server) createTask(w http.ResponseWriter, r *http.Request) {
+	var req CreateTaskRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid body", map[string]any{"reason": err.Error()})
+		return
+	}
+	if req.URLs == nil {
+		req.URLs = []string{}
+	}
+
+	ctx := r.Context()
+	id, err := s.tm.CreateTask(ctx, req.URLs, taskmanager.TaskOptions{
+		Owner:        req.Owner,
+		ArchiveName:  req.ArchiveName,
+		NameTemplate: req.NameTemplate,
+		Paths:        req.Paths,
+		Collision:    req.Collision,
+		Manifest:     req.Manifest,
+		Checksums:    req.Checksums,
+		Headers:      req.Headers,
+	})
+	if err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	snap, err := s.tm.GetTask(ctx, id)
+	if err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", Prefix+"/tasks/"+id)
+	writeJSON(w, r, http.StatusCreated, newTaskResponse(snap))
+}
+
+// GET /api/v1/tasks - поиск по таскам, по умолчанию новые сверху.
+func (s *Server) listTasks(w http.ResponseWriter, r *http.Request) {
+	q, err := parseQuery(r.URL.Query())
+	if err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid query", map[string]any{"reason": err.Error()})
+		return
+	}
+	page, err := s.tm.ListTasks(r.Context(), q)
+	if err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	resp := TaskListResponse{Tasks: make([]TaskResponse, 0, len(page.Tasks)), NextCursor: page.NextCursor}
+	for _, snap := range page.Tasks {
+		resp.Tasks = append(resp.Tasks, newTaskResponse(snap))
+	}
+	writeJSON(w, r, http.StatusOK, resp)
+}
+
+// parseQuery разбирает параметры GET /api/v1/tasks.
+// status можно повторять или писать через запятую: ?status=pending,processing.
+// Сортировку, лимит и курсор проверяет TaskManager.
+func parseQuery(v url.Values) (taskmanager.Query, error) {
+	q := taskmanager.Query{
+		Owner:  v.Get("owner"),
+		Sort:   v.Get("sort"),
+		Cursor: v.Get("cursor"),
+	}
+	for _, raw := range v["status"] {
+		for _, st := range strings.Split(raw, ",") {
+			status := task.TaskStatus(strings.TrimSpace(st))
+			switch status {
+			case task.StatusPending, task.StatusProcessing, task.StatusCompleted, task.StatusFailed, task.StatusCancelled:
+				q.Statuses = append(q.Statuses, status)
+			default:
+				return q, fmt.Errorf("unknown status %q", st)
+			}
+		}
+	}
+	var err error
+	if q.CreatedAfter, err = parseTimeParam(v, "created_after"); err != nil {
+		return q, err
+	}
+	if q.CreatedBefore, err = parseTimeParam(v, "created_before"); err != nil {
+		return q, err
+	}
+	if raw := v.Get("has_errors"); raw != "" {
+		b, err := strconv.ParseBool(raw)
+		if err != nil {
+			return q, fmt.Errorf("has_errors: %q is not a bool", raw)
+		}
+		q.HasErrors = &b
+	}
+	if raw := v.Get("limit"); raw != "" {
+		if q.Limit, err = strconv.Atoi(raw); err != nil || q.Limit < 1 {
+			return q, fmt.Errorf("limit: %q is not a positive number", raw)
+		}
+	}
+	return q, nil
+}
+
+// parseTimeParam - время в RFC3339, пустое - нулевое.
+func parseTimeParam(v url.Values, name string) (time.Time, error) {
+	raw := v.Get(name)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, raw)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %q is not RFC3339", name, raw)
+	}
+	return t, nil
+}
+
+// GET /api/v1/tasks/{id} - состояние таски.
+func (s *Server) getTask(w http.ResponseWriter, r *http.Request) {
+	snap, err := s.tm.GetTask(r.Context(), r.PathValue("id"))
+	if err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, newTaskResponse(snap))
+}
+
+// POST /api/v1/tasks/{id}/urls - добавить url, все или ничего.
+func (s *Server) addURLs(w http.ResponseWriter, r *http.Request) {
+	var req AddURLsRequest
+	if err := decodeJSON(r, &req); err != nil {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "invalid body", map[string]any{"reason": err.Error()})
+		return
+	}
+	if len(req.URLs) == 0 {
+		writeError(w, r, http.StatusBadRequest, CodeInvalidRequest, "urls must not be empty", nil)
+		return
+	}
+
+	ctx := r.Context()
+	id := r.PathValue("id")
+	logging.FromContext(ctx).Info("add urls", "task_id", id, "urls", len(req.URLs))
+	opts := taskmanager.TaskOptions{Paths: req.Paths, Checksums: req.Checksums, Headers: req.Headers}
+	if err := s.tm.AddFiles(ctx, id, req.URLs, opts); err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	snap, err := s.tm.GetTask(ctx, id)
+	if err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	writeJSON(w, r, http.StatusOK, newTaskResponse(snap))
+}
+
+// POST /api/v1/tasks/{id}/start - запустить, не дожидаясь MaxFiles url.
+func (s *Server) startTask(w http.ResponseWriter, r *http.Request) {
+	s.taskAction(w, r, http.StatusAccepted, s.tm.StartTask)
+}
+
+// DELETE /api/v1/tasks/{id} - отменить таску.
+func (s *Server) cancelTask(w http.ResponseWriter, r *http.Request) {
+	s.taskAction(w, r, http.StatusOK, s.tm.CancelTask)
+}
+
+// taskAction выполняет action над таской и возвращает её состояние.
+func (s *Server) taskAction(w http.ResponseWriter, r *http.Request, code int, action func(context.Context, string) error) {
+	ctx := r.Context()
+	id := r.PathValue("id")
+	if err := action(ctx, id); err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	snap, err := s.tm.GetTask(ctx, id)
+	if err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	writeJSON(w, r, code, newTaskResponse(snap))
+}
+
+// GET /api/v1/tasks/{id}/archive - скачать архив.
+func (s *Server) downloadArchive(w http.ResponseWriter, r *http.Request) {
+	id := r.PathValue("id")
+	snap, err := s.tm.GetTask(r.Context(), id)
+	if err != nil {
+		writeTaskError(w, r, err)
+		return
+	}
+	if snap.Status != task.StatusCompleted {
+		writeError(w, r, http.StatusConflict, CodeArchiveNotReady, "archive is not ready",
+			map[string]any{"status": snap.Status})
+		return
+	}
+	if !s.serveArchive(w, r, snap) {
+		writeError(w, r, http.StatusNotFound, CodeNotFound, "archive not found", nil)
+	}
+}
+
+// serveArchive отдает архив таски, false - архива нет.
+func (s *Server) serveArchive(w http.ResponseWriter, r *http.Request, snap task.Snapshot) bool {
+	log := logging.FromContext(r.Context()).With("task_id", snap.TaskID)
+	archivePath, ok := s.tm.ArchivePath(snap.TaskID)
+	if !ok {
+		return false
+	}
+	f, err := os.Open(archivePath)
+	if err != nil {
+		log.Warn("failed to open archive", "error", err)
+		return false
+	}
+	defer func() {
+		if err := f.Close(); err != nil {
+			log.Warn("failed to close archive", "error", err)
+		}
+	}()
+
+	// Заголовки
+	w.Header().Set("Content-Type", "application/zip")
+	name := snap.ArchiveName
+	if name == "" {
+		name = taskmanager.DefaultArchiveName
+	}
+	// FormatMediaType сам закодирует не-ASCII имя в filename*.
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+	setDigest(w.Header(), snap.ArchiveSHA256)
+	stat, err := f.Stat()
+	if err != nil {
+		log.Warn("failed to stat archive", "error", err)
+		return false
+	}
+	log.Info("serving archive")
+	// ServeContent сам ответит 304 на If-None-Match с нашим ETag и умеет Range.
+	http.ServeContent(w, r, name, stat.ModTime(), f)
+	return true
+}
+
+// setDigest - sha256 архива в Digest (RFC 3230), Repr-Digest (RFC 9530)
+// и ETag, чтобы клиент мог проверить, что скачал ровно то, что собрали.
+func setDigest(h http.Header, sum string) {
+	raw, err := hex.DecodeString(sum)
+	if err != nil || len(raw) == 0 {
+		return
+	}
+	b64 := base64.StdEncoding.EncodeToString(raw)
+	h.Set("Digest", "sha-256="+b64)
+	h.Set("Repr-Digest", "sha-256=:"+b64+":")
+	h.Set("ETag", `"`+sum+`"`)
+}
@@ -2,14 +2,31 @@ package archiver
 
 import (
 	"archive/zip"
+	"context"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
+	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/metrics"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/naming"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/tracing"
 )
 
 // Нужно нормальное название.
+// ctx несет логи (task_id) и отмену: отмененный ctx прерывает
+// запись, недописанный архив удаляется.
 type Archiver interface {
-	CreateZip(files []string, dest string) error
+	CreateZip(ctx context.Context, files []Entry, dest string) error
+}
+
+// Entry - файл на диске и его имя в архиве.
+type Entry struct {
+	Name string // Путь внутри архива через "/", например "invoices/01-scan.pdf".
+	Path string // Где файл лежит сейчас.
+	Data []byte // Если Path пустой - содержимое из памяти (manifest.json и т.п.).
 }
 
 type ZipArchiver struct{} // any не подходит.
@@ -20,51 +37,104 @@ func NewZipArchiver() *ZipArchiver {
 }
 
 // Создает и заполняет zip архив.
-func (a *ZipArchiver) CreateZip(files []string, dest string) error {
+func (a *ZipArchiver) CreateZip(ctx context.Context, files []Entry, dest string) (err error) {
+	ctx, span := tracing.Start(ctx, "archive.build", tracing.WithAttrs(
+		tracing.Attr{Key: "archive.files", Value: len(files)},
+	))
+	defer func() {
+		span.RecordError(err)
+		span.End()
+	}()
+	start := time.Now()
+
 	// Проверка существования директории.
 	dir := filepath.Dir(dest)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return err
 	}
 
-	zipFile, err := os.Create(dest)
+	// Пишем во временный файл и переименовываем в конце,
+	// чтобы по пути dest никогда не лежал недописанный архив
+	// (например, если процесс убили посреди записи).
+	tmp := dest + ".part"
+	zipFile, err := os.Create(tmp)
 	if err != nil {
 		return err
 	}
 
-	defer func() {
-			if err := zipFile.Close(); err != nil {
-				return
-			}
-		}()
+	if err := writeZip(ctx, zipFile, files); err != nil {
+		_ = zipFile.Close()
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := zipFile.Close(); err != nil {
+		_ = os.Remove(tmp)
+		return err
+	}
+	if err := os.Rename(tmp, dest); err != nil {
+		return err
+	}
 
-	zipWriter := zip.NewWriter(zipFile)
-	defer func() {
-			if err := zipWriter.Close(); err != nil {
-				return
-			}
-		}()
+	elapsed := time.Since(start)
+	metrics.ArchiveDuration.Observe(elapsed.Seconds())
+	var size int64
+	if info, err := os.Stat(dest); err == nil {
+		size = info.Size()
+		metrics.ArchiveSize.Observe(float64(size))
+	}
+	span.SetAttr("archive.bytes", size)
+	logging.FromContext(ctx).Debug("archive created",
+		"files", len(files), "bytes", size, "duration_ms", elapsed.Milliseconds())
+	return nil
+}
+
+// Заполняет архив, ошибка Close у zip.Writer тоже важна -
+// в ней дописывается central directory.
+func writeZip(ctx context.Context, w io.Writer, files []Entry) error {
+	zipWriter := zip.NewWriter(w)
 
 	// Добавление файлов в архив.
 	for _, file := range files {
-		if err := addFileToZip(zipWriter, file); err != nil {
+		if err := ctx.Err(); err != nil {
+			_ = zipWriter.Close()
+			return err
+		}
+		if err := addFileToZip(ctx, zipWriter, file); err != nil {
+			_ = zipWriter.Close()
 			return err
 		}
 	}
-	return nil
+	return zipWriter.Close()
 }
 
 // Добавляет файл в архив.
-func addFileToZip(zipWriter *zip.Writer, filename string) error {
-	file, err := os.Open(filename)
+// Имя проверяется еще раз: в архив не должно попасть "../x" или "/etc/x",
+// даже если кто-то выше забыл его почистить.
+func addFileToZip(ctx context.Context, zipWriter *zip.Writer, entry Entry) error {
+	if clean, err := naming.CleanPath(entry.Name); err != nil || clean != entry.Name || clean[len(clean)-1] == '/' {
+		return fmt.Errorf("bad entry name %q", entry.Name)
+	}
+	if entry.Path == "" {
+		writer, err := zipWriter.CreateHeader(&zip.FileHeader{
+			Name:     entry.Name,
+			Method:   zip.Deflate,
+			Modified: time.Now(),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = writer.Write(entry.Data)
+		return err
+	}
+	file, err := os.Open(entry.Path)
 	if err != nil {
 		return err
 	}
 	defer func() {
-			if err := file.Close(); err != nil {
-				return
-			}
-		}()
+		if err := file.Close(); err != nil {
+			return
+		}
+	}()
 
 	info, err := file.Stat()
 	if err != nil {
@@ -75,7 +145,7 @@ func addFileToZip(zipWriter *zip.Writer, filename string) error {
 	if err != nil {
 		return err
 	}
-	header.Name = filepath.Base(filename)
+	header.Name = entry.Name
 	header.Method = zip.Deflate
 
 	writer, err := zipWriter.CreateHeader(header)
@@ -83,6 +153,20 @@ func addFileToZip(zipWriter *zip.Writer, filename string) error {
 		return err
 	}
 
-	_, err = io.Copy(writer, file)
+	_, err = io.Copy(writer, ctxReader{ctx: ctx, r: file})
 	return err
 }
+
+// ctxReader - Read с проверкой ctx, чтобы отмена не ждала,
+// пока допишется большой файл.
+type ctxReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func (r ctxReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
@@ -0,0 +1,51 @@
+package archiver
+
+import (
+	"archive/zip"
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/metrics"
+)
+
+func TestCreateZip_Metrics(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "001")
+	if err := os.WriteFile(src, []byte("%PDF-1.4"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	files := []Entry{{Name: "docs/a.pdf", Path: src}, {Name: "README.txt", Data: []byte("hi")}}
+	durations, sizes := metrics.ArchiveDuration.Count(), metrics.ArchiveSize.Count()
+
+	dest := filepath.Join(dir, "archive.zip")
+	if err := NewZipArchiver().CreateZip(context.Background(), files, dest); err != nil {
+		t.Fatalf("CreateZip: %v", err)
+	}
+	r, err := zip.OpenReader(dest)
+	if err != nil {
+		t.Fatalf("Expected a valid zip, got %v", err)
+	}
+	defer r.Close()
+	if len(r.File) != 2 || r.File[0].Name != "docs/a.pdf" {
+		t.Errorf("Expected docs/a.pdf and README.txt, got %d files", len(r.File))
+	}
+	if metrics.ArchiveDuration.Count()-durations != 1 || metrics.ArchiveSize.Count()-sizes != 1 {
+		t.Error("Expected archive duration and size to be observed once")
+	}
+
+	// Прерванная сборка в метрики не попадает, архива нет.
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	dest = filepath.Join(dir, "cancelled.zip")
+	if err := NewZipArchiver().CreateZip(ctx, files, dest); err == nil {
+		t.Fatal("Expected error for cancelled context")
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Errorf("Expected no archive after cancel, got %v", err)
+	}
+	if metrics.ArchiveDuration.Count()-durations != 1 {
+		t.Error("Expected cancelled build not to be observed")
+	}
+}
@@ -0,0 +1,111 @@
+package archiver
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Имена файлов манифеста в корне архива.
+const (
+	ManifestName = "manifest.json"
+	ReadmeName   = "README.txt"
+)
+
+// Manifest - что просили положить в архив и что получилось,
+// чтобы тот, кто получил архив, знал и про файлы, которых в нем нет.
+type Manifest struct {
+	TaskID    string         `json:"task_id"`
+	CreatedAt time.Time      `json:"created_at"` // Когда собран архив.
+	Files     []ManifestFile `json:"files"`      // Все url таски, по порядку.
+}
+
+// ManifestFile - один url: либо имя в архиве и что о нем известно, либо ошибка.
+type ManifestFile struct {
+	URL          string     `json:"url"`
+	FinalURL     string     `json:"final_url,omitempty"` // После редиректов.
+	Name         string     `json:"name,omitempty"`      // Путь в архиве, пусто - файла нет.
+	Size         int64      `json:"size,omitempty"`
+	SHA256       string     `json:"sha256,omitempty"`
+	ContentType  string     `json:"content_type,omitempty"`
+	DownloadedAt *time.Time `json:"downloaded_at,omitempty"`
+	Error        string     `json:"error,omitempty"` // Почему файла нет.
+}
+
+// Entries - manifest.json и README.txt, готовые для CreateZip.
+func (m *Manifest) Entries() ([]Entry, error) {
+	data, err := json.MarshalIndent(m, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	return []Entry{
+		{Name: ReadmeName, Data: []byte(m.readme())},
+		{Name: ManifestName, Data: append(data, '\n')},
+	}, nil
+}
+
+// readme - то же, что в manifest.json, но для людей.
+// \r\n, чтобы нормально открывалось и в Блокноте.
+func (m *Manifest) readme() string {
+	var ok, failed []ManifestFile
+	for _, f := range m.Files {
+		if f.Name != "" {
+			ok = append(ok, f)
+		} else {
+			failed = append(failed, f)
+		}
+	}
+
+	var b strings.Builder
+	line := func(format string, args ...any) {
+		fmt.Fprintf(&b, format+"\r\n", args...)
+	}
+	line("Archive for task %s, built %s", m.TaskID, m.CreatedAt.UTC().Format(time.RFC3339))
+	line("")
+	line("Downloaded %d of %d files:", len(ok), len(m.Files))
+	for _, f := range ok {
+		line("")
+		line("  %s", f.Name)
+		line("    from %s", f.URL)
+		if f.FinalURL != "" && f.FinalURL != f.URL {
+			line("    redirected to %s", f.FinalURL)
+		}
+		line("    %s, %s", formatSize(f.Size), orUnknown(f.ContentType))
+		if f.SHA256 != "" {
+			line("    sha256 %s", f.SHA256)
+		}
+	}
+	if len(failed) > 0 {
+		line("")
+		line("Not downloaded (%d):", len(failed))
+		for _, f := range failed {
+			line("")
+			line("  %s", f.URL)
+			line("    %s", f.Error)
+		}
+	}
+	line("")
+	line("Details: %s", ManifestName)
+	return b.String()
+}
+
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %cB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return "unknown type"
+	}
+	return s
+}
@@ -0,0 +1,255 @@
+package downloader
+
+import (
+	"container/list"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Cache - кеш скачанных файлов, общий для всех тасок.
+//
+// Файлы лежат по sha256 содержимого (dir/sha256/ab/ab12...), так что
+// один и тот же файл по разным url хранится один раз. Для url запоминаются
+// ETag и Last-Modified ответа: в следующий раз сервер спрашивается
+// с If-None-Match / If-Modified-Since, и если он ответил 304, файл берется
+// из кеша. Ответ без валидаторов не кешируется: проверить его свежесть нечем.
+//
+// Размер ограничен maxSize, лишнее вытесняется начиная с файлов,
+// которые дольше всех не были нужны (LRU). Индекс url живет в памяти,
+// файлы с диска после рестарта подхватываются, но пригодятся, только
+// когда какой-нибудь url снова отдаст то же содержимое.
+type Cache struct {
+	dir     string
+	maxSize int64
+
+	mu    sync.Mutex
+	urls  map[string]cacheEntry
+	blobs map[string]*list.Element // sha256 -> элемент lru, в нем *blob.
+	lru   *list.List               // Спереди - недавно нужные.
+	size  int64
+}
+
+// cacheEntry - что известно про ответ на url.
+type cacheEntry struct {
+	etag         string
+	lastModified string
+	meta         Meta
+}
+
+type blob struct {
+	sum  string
+	size int64
+}
+
+// Конструктор кеша:
+// dir - директория, файлы от прошлого запуска в ней остаются,
+// maxSize - сколько байт можно занять.
+func NewCache(dir string, maxSize int64) (*Cache, error) {
+	c := &Cache{
+		dir:     dir,
+		maxSize: maxSize,
+		urls:    make(map[string]cacheEntry),
+		blobs:   make(map[string]*list.Element),
+		lru:     list.New(),
+	}
+	if err := os.MkdirAll(filepath.Join(dir, "sha256"), 0755); err != nil {
+		return nil, err
+	}
+	if err := c.load(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Size - сколько байт сейчас занято.
+func (c *Cache) Size() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.size
+}
+
+// load подхватывает файлы, оставшиеся на диске, старые - в конец lru.
+// Недописанные копии (.tmp) удаляются.
+func (c *Cache) load() error {
+	type found struct {
+		blob
+		modTime time.Time
+	}
+	var files []found
+	err := filepath.WalkDir(filepath.Join(c.dir, "sha256"), func(p string, e os.DirEntry, err error) error {
+		if err != nil || e.IsDir() {
+			return err
+		}
+		if strings.HasSuffix(p, ".tmp") {
+			return os.Remove(p)
+		}
+		if !isSHA256(e.Name()) {
+			return nil
+		}
+		info, err := e.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, found{blob{sum: e.Name(), size: info.Size()}, info.ModTime()})
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	slices.SortFunc(files, func(a, b found) int { return a.modTime.Compare(b.modTime) })
+	for _, f := range files {
+		b := f.blob
+		c.blobs[b.sum] = c.lru.PushFront(&b)
+		c.size += b.size
+	}
+	c.evict()
+	return nil
+}
+
+func (c *Cache) path(sum string) string {
+	return filepath.Join(c.dir, "sha256", sum[:2], sum)
+}
+
+// lookup - что известно про url, false - ничего.
+func (c *Cache) lookup(url string) (cacheEntry, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.urls[url]
+	return e, ok
+}
+
+// fetch кладет закешированный файл url в dest.
+// false - файла уже нет (вытеснили), запись про url забывается.
+func (c *Cache) fetch(url, dest string) (Meta, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	e, ok := c.urls[url]
+	if !ok {
+		return Meta{}, false
+	}
+	el, ok := c.blobs[e.meta.SHA256]
+	if !ok {
+		delete(c.urls, url)
+		return Meta{}, false
+	}
+	if err := linkOrCopy(c.path(e.meta.SHA256), dest); err != nil {
+		// Файл мог удалить другой процесс с тем же CACHE_DIR.
+		c.drop(el)
+		return Meta{}, false
+	}
+	c.lru.MoveToFront(el)
+	return e.meta, true
+}
+
+// store запоминает ответ на url, src - уже скачанный файл.
+// Старая запись про url забывается в любом случае.
+func (c *Cache) store(url string, h http.Header, meta Meta, src string) error {
+	etag, lastModified := h.Get("ETag"), h.Get("Last-Modified")
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	delete(c.urls, url)
+	if etag == "" && lastModified == "" || !cacheable(h) || meta.SHA256 == "" || meta.Size > c.maxSize {
+		return nil
+	}
+
+	if el, ok := c.blobs[meta.SHA256]; ok {
+		c.lru.MoveToFront(el)
+	} else {
+		p := c.path(meta.SHA256)
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			return err
+		}
+		if err := linkOrCopy(src, p); err != nil {
+			return err
+		}
+		c.blobs[meta.SHA256] = c.lru.PushFront(&blob{sum: meta.SHA256, size: meta.Size})
+		c.size += meta.Size
+	}
+	c.urls[url] = cacheEntry{etag: etag, lastModified: lastModified, meta: meta}
+	c.evict()
+	return nil
+}
+
+// evict вытесняет давно не нужные файлы, пока кеш не влезет в maxSize.
+// Только что добавленный файл спереди и сам по себе не больше maxSize,
+// так что его не трогаем.
+func (c *Cache) evict() {
+	for c.size > c.maxSize {
+		el := c.lru.Back()
+		if el == nil {
+			return
+		}
+		c.drop(el)
+	}
+}
+
+// drop удаляет файл и все url, которые на него ссылаются.
+func (c *Cache) drop(el *list.Element) {
+	b := el.Value.(*blob)
+	_ = os.Remove(c.path(b.sum))
+	c.lru.Remove(el)
+	delete(c.blobs, b.sum)
+	c.size -= b.size
+	for u, e := range c.urls {
+		if e.meta.SHA256 == b.sum {
+			delete(c.urls, u)
+		}
+	}
+}
+
+// cacheable - можно ли хранить ответ. Кеш общий для всех тасок,
+// поэтому private, как и no-store, не храним.
+func cacheable(h http.Header) bool {
+	for _, d := range strings.Split(strings.ToLower(h.Get("Cache-Control")), ",") {
+		switch strings.TrimSpace(d) {
+		case "no-store", "private":
+			return false
+		}
+	}
+	return true
+}
+
+func isSHA256(s string) bool {
+	b, err := hex.DecodeString(s)
+	return err == nil && len(b) == 32
+}
+
+// linkOrCopy делает dst жесткой ссылкой на src, а если не вышло
+// (другой диск, Windows без прав) - копирует через .tmp,
+// чтобы под именем dst никогда не лежал недописанный файл.
+func linkOrCopy(src, dst string) error {
+	_ = os.Remove(dst)
+	if err := os.Link(src, dst); err == nil {
+		return nil
+	}
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	tmp := dst + ".tmp"
+	out, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(out, in)
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, dst)
+	}
+	if err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("failed to copy cached file: %w", err)
+	}
+	return nil
+}
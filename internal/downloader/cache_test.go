@@ -0,0 +1,161 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// cacheServer отдает "%PDF-" + путь с ETag от версии, full считает ответы с телом.
+type cacheServer struct {
+	*httptest.Server
+	version atomic.Int32
+	full    atomic.Int32
+}
+
+func newCacheServer(t *testing.T) *cacheServer {
+	t.Helper()
+	s := &cacheServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := `"v` + string(rune('0'+s.version.Load())) + `"`
+		switch {
+		case strings.HasPrefix(r.URL.Path, "/plain"):
+		case strings.HasPrefix(r.URL.Path, "/nostore"):
+			w.Header().Set("ETag", etag)
+			w.Header().Set("Cache-Control", "no-store")
+		default:
+			w.Header().Set("ETag", etag)
+			if r.Header.Get("If-None-Match") == etag {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+		s.full.Add(1)
+		body := "%PDF-" + r.URL.Path
+		if strings.HasPrefix(r.URL.Path, "/same") {
+			body = "%PDF-same"
+		}
+		_, _ = w.Write([]byte(body + etag))
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func newCachedDownloader(t *testing.T, maxSize int64) (*HTTPDownloader, *Cache) {
+	t.Helper()
+	cache, err := NewCache(t.TempDir(), maxSize)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+	d.SetCache(cache)
+	return d, cache
+}
+
+func download(t *testing.T, d *HTTPDownloader, url string) (Meta, string) {
+	t.Helper()
+	dest := filepath.Join(t.TempDir(), "001")
+	meta, err := d.Download(context.Background(), url, dest)
+	if err != nil {
+		t.Fatalf("%s: unexpected error %v", url, err)
+	}
+	body, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("%s: %v", url, err)
+	}
+	return meta, string(body)
+}
+
+func TestCache_Revalidate(t *testing.T) {
+	srv := newCacheServer(t)
+	d, _ := newCachedDownloader(t, 1<<20)
+
+	first, body := download(t, d, srv.URL+"/a.pdf")
+	second, cached := download(t, d, srv.URL+"/a.pdf")
+	if first.Cached || !second.Cached {
+		t.Errorf("Expected only the second download from cache, got %v %v", first.Cached, second.Cached)
+	}
+	if cached != body || second.SHA256 != first.SHA256 || second.Size != first.Size {
+		t.Errorf("Expected the same file from cache, got %q (%+v)", cached, second)
+	}
+	if srv.full.Load() != 1 {
+		t.Errorf("Expected 1 full response, got %d", srv.full.Load())
+	}
+
+	// Файл на сервере поменялся: ETag другой, качается заново.
+	srv.version.Add(1)
+	changed, body := download(t, d, srv.URL+"/a.pdf")
+	if changed.Cached || !strings.HasSuffix(body, `"v1"`) {
+		t.Errorf("Expected a fresh download after change, got %q (%+v)", body, changed)
+	}
+}
+
+func TestCache_NotCacheable(t *testing.T) {
+	srv := newCacheServer(t)
+	d, cache := newCachedDownloader(t, 1<<20)
+
+	for _, path := range []string{"/plain.pdf", "/nostore.pdf"} {
+		download(t, d, srv.URL+path)
+		if meta, _ := download(t, d, srv.URL+path); meta.Cached {
+			t.Errorf("%s: expected no cache", path)
+		}
+	}
+	if srv.full.Load() != 4 || cache.Size() != 0 {
+		t.Errorf("Expected 4 full responses and empty cache, got %d and %d bytes", srv.full.Load(), cache.Size())
+	}
+}
+
+func TestCache_EvictLRU(t *testing.T) {
+	srv := newCacheServer(t)
+	// Ответы по 15 байт ("%PDF-/a.pdf" + `"v0"`), влезают два.
+	d, cache := newCachedDownloader(t, 30)
+
+	download(t, d, srv.URL+"/a.pdf")
+	download(t, d, srv.URL+"/b.pdf")
+	download(t, d, srv.URL+"/a.pdf") // a теперь нужнее b.
+	download(t, d, srv.URL+"/c.pdf")
+	if cache.Size() > 30 {
+		t.Errorf("Expected cache within 30 bytes, got %d", cache.Size())
+	}
+	if meta, _ := download(t, d, srv.URL+"/a.pdf"); !meta.Cached {
+		t.Error("Expected a.pdf to stay in cache")
+	}
+	if meta, _ := download(t, d, srv.URL+"/b.pdf"); meta.Cached {
+		t.Error("Expected b.pdf to be evicted")
+	}
+}
+
+func TestCache_ContentAddressed(t *testing.T) {
+	srv := newCacheServer(t)
+	d, cache := newCachedDownloader(t, 1<<20)
+
+	one, _ := download(t, d, srv.URL+"/same/1.pdf")
+	two, _ := download(t, d, srv.URL+"/same/2.pdf")
+	if one.SHA256 != two.SHA256 || cache.Size() != one.Size {
+		t.Errorf("Expected one copy of the same content, got %d bytes for %d", cache.Size(), one.Size)
+	}
+
+	// Другой процесс вычистил файлы: 304 уже не поможет, качаем заново.
+	if err := os.RemoveAll(filepath.Join(cache.dir, "sha256")); err != nil {
+		t.Fatal(err)
+	}
+	meta, body := download(t, d, srv.URL+"/same/1.pdf")
+	if meta.Cached || body != `%PDF-same"v0"` {
+		t.Errorf("Expected a fresh download, got %q (%+v)", body, meta)
+	}
+
+	// После рестарта файлы с диска подхватываются.
+	reopened, err := NewCache(cache.dir, 1<<20)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+	if reopened.Size() != meta.Size {
+		t.Errorf("Expected %d bytes after restart, got %d", meta.Size, reopened.Size())
+	}
+}
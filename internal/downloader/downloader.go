@@ -1,28 +1,49 @@
 package downloader
 
 import (
+	"bufio"
 	"context"
+	"crypto/sha256"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
 	"path/filepath"
+	"slices"
+	"sync"
 	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/metrics"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/tracing"
 )
 
+// Downloader скачивает url в dest и рассказывает, что скачал:
+// имя из Content-Disposition, тип и т.п., из этого потом собирается имя в архиве.
 type Downloader interface {
-	Download(ctx context.Context, url, dest string) error
+	Download(ctx context.Context, url, dest string) (Meta, error)
 }
 
 type HTTPDownloader struct {
-	Timeout     time.Duration
+	Timeout     time.Duration // Сколько ждать молчащий сервер, см. watchdog.
 	MaxSize     int64
 	AllowedExts []string
+
+	mu    sync.RWMutex // Лимиты меняются на лету через SetLimits.
+	cache *Cache       // nil - без кеша.
+	sched *Scheduler   // nil - без общих лимитов на соединения и полосу.
+	hosts *hostGuard
+
+	transport http.RoundTripper // nil - http.DefaultTransport.
 }
 
 // Конструктор загрузчика
-// timeout - время на запрос,
+// timeout - сколько ждать молчащий сервер (заголовки, каждый кусок тела), а не весь файл:
+// под лимитом полосы большой файл качается долго, и это не повод его бросать,
 // maxSize - максимальный размер файла MB,
 // allowedExts - массив расширений.
 func NewHTTPDownloader(timeout time.Duration, maxSize int64, allowedExts []string) *HTTPDownloader {
@@ -30,58 +51,444 @@ func NewHTTPDownloader(timeout time.Duration, maxSize int64, allowedExts []strin
 		Timeout:     timeout,
 		MaxSize:     maxSize,
 		AllowedExts: allowedExts,
+		hosts:       newHostGuard(),
 	}
 }
 
-func (d *HTTPDownloader) Download(ctx context.Context, url, dest string) error {
-	client := &http.Client{Timeout: d.Timeout}
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+// SetLimits меняет лимиты на лету. Загрузки, которые уже идут,
+// докачиваются со старыми.
+func (d *HTTPDownloader) SetLimits(maxSize int64, allowedExts []string) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.MaxSize = maxSize
+	d.AllowedExts = allowedExts
+}
+
+// SetCache включает кеш, nil - выключает.
+func (d *HTTPDownloader) SetCache(c *Cache) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.cache = c
+}
+
+// SetScheduler включает общие лимиты на соединения и полосу, nil - выключает.
+func (d *HTTPDownloader) SetScheduler(s *Scheduler) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.sched = s
+}
+
+// SetTransport - через что ходить в сеть, см. NewTransport. nil - http.DefaultTransport.
+func (d *HTTPDownloader) SetTransport(rt http.RoundTripper) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.transport = rt
+}
+
+// SetHostPolicy меняет circuit breaker и лимит запросов на хост, см. HostPolicy.
+func (d *HTTPDownloader) SetHostPolicy(p HostPolicy) {
+	d.hosts.setPolicy(p)
+}
+
+func (d *HTTPDownloader) limits() (int64, []string) {
+	d.mu.RLock()
+	defer d.mu.RUnlock()
+	return d.MaxSize, d.AllowedExts
+}
+
+// Download скачивает url в dest и пишет метрики по хосту и классу ошибки.
+// Тип файла проверяется по ответу, а не по dest: у url может вообще
+// не быть расширения (/download?id=42), тогда оно берется
+// из Content-Disposition или Content-Type.
+// Сначала ждет своей очереди к хосту и свободный слот, это время в загрузку
+// и в Timeout не входит. Хост, который недавно падал, отказывает сразу, см. hostGuard.
+func (d *HTTPDownloader) Download(ctx context.Context, url, dest string) (Meta, error) {
+	host := hostOf(url)
+	ctx, span := tracing.Start(ctx, "download", tracing.WithKind(tracing.KindClient), tracing.WithAttrs(
+		tracing.Attr{Key: "url.full", Value: logging.RedactURL(url)},
+		tracing.Attr{Key: "server.address", Value: host},
+	))
+	defer span.End()
+
+	probe, err := d.hosts.allow(host)
 	if err != nil {
-		return err
+		return Meta{FinalURL: logging.RedactURL(url)}, failEarly(ctx, span, err)
+	}
+	release, err := d.await(ctx, span, host)
+	if err != nil {
+		d.hosts.report(host, hostUnknown, probe)
+		return Meta{FinalURL: logging.RedactURL(url)}, failEarly(ctx, span, err)
+	}
+	defer release()
+
+	start := time.Now()
+	meta, err := d.download(ctx, url, dest)
+	outcome := hostOutcome(err)
+	if ctx.Err() != nil {
+		outcome = hostUnknown // Отменили нас или вышел наш дедлайн, хост ни при чем.
 	}
-	resp, err := client.Do(req)
+	if d.hosts.report(host, outcome, probe) {
+		logging.FromContext(ctx).Warn("host is failing, pausing downloads from it", "host", host, "error", err)
+	}
+	n := meta.Size
+	span.SetAttr("download.bytes", n)
+
+	elapsed := time.Since(start)
+	metrics.DownloadDuration.With(metrics.Host(host)).Observe(elapsed.Seconds())
+	if meta.Cached {
+		metrics.DownloadCacheHits.With(metrics.Host(host)).Inc()
+	} else {
+		metrics.DownloadBytes.With(metrics.Host(host)).Add(float64(n))
+	}
+
+	logger := logging.FromContext(ctx).With("host", host, "bytes", n, "duration_ms", elapsed.Milliseconds())
 	if err != nil {
-		return err
+		class := errorClass(err)
+		metrics.DownloadErrors.With(class).Inc()
+		span.SetAttr("error.type", class)
+		span.RecordError(err)
+		logger.Debug("download failed", "error_class", class, "error", err)
+		return meta, err
 	}
+	span.SetAttr("http.response.content_type", meta.ContentType)
+	span.SetAttr("download.cached", meta.Cached)
+	logger.Debug("download finished", "content_type", meta.ContentType, "filename", meta.Filename, "cached", meta.Cached)
+	return meta, nil
+}
+
+// await ждет очереди к хосту по RequestsPerMinute и слот у планировщика.
+func (d *HTTPDownloader) await(ctx context.Context, span *tracing.Span, host string) (release func(), err error) {
+	waitStart := time.Now()
 	defer func() {
-			if err := resp.Body.Close(); err != nil {
-				return
-			}
-		}()
+		metrics.DownloadWait.Observe(time.Since(waitStart).Seconds())
+		span.SetAttr("download.wait_ms", time.Since(waitStart).Milliseconds())
+	}()
+	if err := d.hosts.wait(ctx, host); err != nil {
+		return nil, err
+	}
+	d.mu.RLock()
+	sched := d.sched
+	d.mu.RUnlock()
+	if sched == nil {
+		return func() {}, nil
+	}
+	return sched.acquire(ctx, host)
+}
+
+// failEarly - до запроса дело не дошло, только метрика и спан.
+func failEarly(ctx context.Context, span *tracing.Span, err error) error {
+	class := errorClass(err)
+	metrics.DownloadErrors.With(class).Inc()
+	span.SetAttr("error.type", class)
+	span.RecordError(err)
+	logging.FromContext(ctx).Debug("download not started", "error_class", class, "error", err)
+	return err
+}
+
+func (d *HTTPDownloader) download(ctx context.Context, url, dest string) (meta Meta, err error) {
+	maxSize, allowedExts := d.limits()
+	d.mu.RLock()
+	cache, sched, transport := d.cache, d.sched, d.transport
+	d.mu.RUnlock()
 
-	extCaugh := 0
-	for _, ext := range d.AllowedExts {
-		if ext == filepath.Ext(dest) {
-			extCaugh++
+	extra := headersFrom(ctx)
+	if len(extra) > 0 {
+		// Файл за токеном - не для общего кеша: другая таска получила бы его
+		// без токена. И наоборот, ответ без токена может быть другим.
+		cache = nil
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	defer cancel(nil)
+	watch := newWatchdog(d.Timeout, cancel)
+	defer watch.stop()
+	defer func() {
+		cause := context.Cause(ctx)
+		switch {
+		case err == nil || cause == nil:
+		case errors.Is(cause, errServerSilent):
+			err = fmt.Errorf("%w for %s: %w", errServerSilent, d.Timeout, err)
+		case !errors.Is(err, cause):
+			// Посреди чтения тела транспорт отдает "use of closed network connection",
+			// а вызывающему важно увидеть, что кончился именно его ctx.
+			err = fmt.Errorf("%w: %w", cause, err)
 		}
-	} // Тупая проверка, но тут нет arr.include(), поэтому так.
-	if extCaugh == 0 { // Нужно было запихать сюда логер.
-		return errors.New("extention is not allowed: " + filepath.Ext(dest))
+	}()
+
+	meta = Meta{FinalURL: logging.RedactURL(url)}
+	// Клиент дешевый, соединения живут в транспорте и переиспользуются.
+	// Без Client.Timeout: он считал бы и чтение тела под лимитом полосы.
+	client := &http.Client{Transport: transport, CheckRedirect: dropHeadersOnRedirect(extra)}
+	var cached *cacheEntry
+	if cache != nil {
+		if e, ok := cache.lookup(url); ok {
+			cached = &e
+		}
+	}
+	watch.start()
+	resp, err := get(ctx, client, url, cached, extra)
+	watch.stop()
+	if err != nil {
+		return meta, err
 	}
+	defer func() {
+		if err := resp.Body.Close(); err != nil {
+			return
+		}
+	}()
 
-	if resp.ContentLength > 0 && resp.ContentLength > d.MaxSize {
-		return errors.New("file too large: " + fmt.Sprint(resp.ContentLength))
+	if cached != nil && resp.StatusCode == http.StatusNotModified {
+		// Лимиты могли поменяться с тех пор, как файл попал в кеш.
+		m := cached.meta
+		m.Ext = fileExt(m, url)
+		if !slices.Contains(allowedExts, m.Ext) {
+			return m, fmt.Errorf("%w: %q (%s)", errExtNotAllowed, m.Ext, m.ContentType)
+		}
+		if m.Size > maxSize {
+			return m, fmt.Errorf("%w: %d", errTooLarge, m.Size)
+		}
+		if err := os.MkdirAll(filepath.Dir(dest), 0755); err != nil {
+			return m, err
+		}
+		if m, ok := cache.fetch(url, dest); ok {
+			m.Ext = fileExt(m, url)
+			m.Cached = true
+			return m, nil
+		}
+		// Файл успели вытеснить, качаем заново уже без условий.
+		_ = resp.Body.Close()
+		watch.start()
+		fresh, err := get(ctx, client, url, nil, extra)
+		watch.stop()
+		if err != nil {
+			return meta, err
+		}
+		resp = fresh
 	}
 
 	if resp.StatusCode != http.StatusOK {
-		return errors.New("failed to download: " + resp.Status)
+		return meta, &statusError{code: resp.StatusCode, status: resp.Status}
+	}
+	if resp.ContentLength > 0 && resp.ContentLength > maxSize {
+		return meta, fmt.Errorf("%w: %d", errTooLarge, resp.ContentLength)
+	}
+
+	// Первые байты нужны, чтобы угадать тип, если сервер его не назвал.
+	// Watchdog смотрит только на Read тела, паузы под лимитом полосы - снаружи.
+	var src io.Reader = watchedReader{r: resp.Body, w: watch}
+	if sched != nil {
+		src = sched.reader(ctx, src)
+	}
+	body := bufio.NewReaderSize(src, sniffLen)
+	// Короткий файл - не ошибка. Остальное возвращаем сразу: bufio отдает
+	// ошибку один раз, и Copy бы ее уже не увидел.
+	head, err := body.Peek(sniffLen)
+	if err != nil && err != io.EOF {
+		return meta, err
+	}
+	meta.FinalURL = logging.RedactURL(resp.Request.URL.String()) // Редирект мог прийти с user:pass@.
+	meta.ContentType = contentType(resp.Header.Get("Content-Type"), head)
+	meta.Filename = filenameFrom(resp.Header.Get("Content-Disposition"))
+	meta.Ext = fileExt(meta, url)
+
+	if !slices.Contains(allowedExts, meta.Ext) {
+		return meta, fmt.Errorf("%w: %q (%s)", errExtNotAllowed, meta.Ext, meta.ContentType)
 	}
 
 	dir := filepath.Dir(dest)
 	if err := os.MkdirAll(dir, 0755); err != nil { // rwxr-xr-x виндой игнорится.
-		return err
+		return meta, err
 	}
 
 	out, err := os.Create(dest)
 	if err != nil {
-		return err
+		return meta, err
 	}
 	defer func() {
-			if err := out.Close(); err != nil {
-				return
+		if err := out.Close(); err != nil {
+			return
+		}
+	}()
+
+	// Хеш считается на лету, второй раз читать файл не нужно.
+	h := sha256.New()
+	meta.Size, err = io.Copy(io.MultiWriter(out, h), body)
+	if err == nil {
+		// После отмены транспорт может отдать обрезанное тело как io.EOF.
+		err = ctx.Err()
+	}
+	if err != nil {
+		// Оборванная загрузка (в том числе отмена ctx) не оставляет полфайла.
+		_ = out.Close()
+		_ = os.Remove(dest)
+		return meta, err
+	}
+	meta.SHA256 = hex.EncodeToString(h.Sum(nil))
+	if cache != nil {
+		if err := cache.store(url, resp.Header, meta, dest); err != nil {
+			logging.FromContext(ctx).Warn("failed to cache file", "error", err)
+		}
+	}
+	return meta, nil
+}
+
+// get - GET url с заголовками клиента extra, с cached - условный:
+// If-None-Match и If-Modified-Since из прошлого ответа, тогда сервер может ответить 304.
+func get(ctx context.Context, client *http.Client, url string, cached *cacheEntry, extra http.Header) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range extra {
+		req.Header[name] = values
+	}
+	if cached != nil {
+		if cached.etag != "" {
+			req.Header.Set("If-None-Match", cached.etag)
+		}
+		if cached.lastModified != "" {
+			req.Header.Set("If-Modified-Since", cached.lastModified)
+		}
+	}
+	return client.Do(req)
+}
+
+// errServerSilent - сервер молчит дольше Timeout: не отдает заголовки или перестал слать тело.
+var errServerSilent = errors.New("server stopped responding")
+
+// watchdog отменяет запрос, если сервер молчит дольше timeout. Часы идут,
+// только пока мы ждем сервер (start/stop вокруг запроса и каждого Read тела):
+// очередь к хосту, слот и паузы под лимитом полосы не считаются.
+type watchdog struct {
+	timer   *time.Timer // nil - timeout 0, ждем сколько угодно.
+	timeout time.Duration
+}
+
+func newWatchdog(timeout time.Duration, cancel context.CancelCauseFunc) *watchdog {
+	w := &watchdog{timeout: timeout}
+	if timeout > 0 {
+		w.timer = time.AfterFunc(timeout, func() { cancel(errServerSilent) })
+		w.timer.Stop()
+	}
+	return w
+}
+
+func (w *watchdog) start() {
+	if w.timer != nil {
+		w.timer.Reset(w.timeout)
+	}
+}
+
+func (w *watchdog) stop() {
+	if w.timer != nil {
+		w.timer.Stop()
+	}
+}
+
+// watchedReader - каждый Read из r под присмотром watchdog.
+type watchedReader struct {
+	r io.Reader
+	w *watchdog
+}
+
+func (r watchedReader) Read(p []byte) (int, error) {
+	r.w.start()
+	defer r.w.stop()
+	return r.r.Read(p)
+}
+
+type headersKey struct{}
+
+// WithHeaders - заголовки, которые надо отправить за файлом: Authorization,
+// Cookie, X-Api-Key и т.п. Только на хост из url, см. dropHeadersOnRedirect.
+func WithHeaders(ctx context.Context, h http.Header) context.Context {
+	if len(h) == 0 {
+		return ctx
+	}
+	return context.WithValue(ctx, headersKey{}, h)
+}
+
+func headersFrom(ctx context.Context) http.Header {
+	h, _ := ctx.Value(headersKey{}).(http.Header)
+	return h
+}
+
+// dropHeadersOnRedirect убирает заголовки клиента, если редирект ведет
+// на другой хост или с https на http: токен одного сервера не должен уйти
+// другому или открытым текстом. Authorization и Cookie Go сам не шлет
+// на чужой домен, но поддомены и X-Api-Key и т.п. - шлет.
+func dropHeadersOnRedirect(extra http.Header) func(req *http.Request, via []*http.Request) error {
+	return func(req *http.Request, via []*http.Request) error {
+		if len(via) >= 10 { // Как у http.Client по умолчанию.
+			return errors.New("stopped after 10 redirects")
+		}
+		first := via[0].URL
+		if req.URL.Host != first.Host || first.Scheme == "https" && req.URL.Scheme != "https" {
+			for name := range extra {
+				req.Header.Del(name)
 			}
-		}()
+		}
+		return nil
+	}
+}
 
-	_, err = io.Copy(out, resp.Body)
-	return err
+// Ошибки загрузки, по ним считается класс для метрик.
+var (
+	errExtNotAllowed = errors.New("extention is not allowed")
+	errTooLarge      = errors.New("file too large")
+	errMisconfigured = errors.New("download transport is misconfigured") // Хосты тут ни при чем.
+)
+
+// statusError - сервер ответил не 200.
+type statusError struct {
+	code   int
+	status string
+}
+
+func (e *statusError) Error() string {
+	return "failed to download: " + e.status
+}
+
+// errorClass - грубая классификация ошибки для лейбла метрики,
+// значений должно быть немного, поэтому без текста ошибки.
+func errorClass(err error) string {
+	var se *statusError
+	var dnsErr *net.DNSError
+	var netErr net.Error
+	switch {
+	case errors.Is(err, errServerSilent):
+		return "timeout"
+	case errors.Is(err, errHostUnavailable):
+		return "host_unavailable"
+	case errors.Is(err, errMisconfigured):
+		return "misconfigured"
+	case errors.Is(err, errExtNotAllowed):
+		return "extension"
+	case errors.Is(err, errTooLarge):
+		return "too_large"
+	case errors.As(err, &se) && se.code >= 500:
+		return "http_5xx"
+	case errors.As(err, &se):
+		return "http_4xx"
+	case errors.Is(err, context.Canceled):
+		return "canceled"
+	case errors.Is(err, context.DeadlineExceeded):
+		return "timeout"
+	case errors.As(err, &dnsErr):
+		return "dns"
+	case errors.As(err, &netErr) && netErr.Timeout():
+		return "timeout"
+	case errors.As(err, &netErr):
+		return "network"
+	}
+	return "other"
+}
+
+// hostOf - хост из url, для hostGuard, планировщика и лейбла метрики (через metrics.Host).
+func hostOf(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return "invalid"
+	}
+	return u.Hostname()
 }
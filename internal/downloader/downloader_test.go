@@ -0,0 +1,181 @@
+package downloader
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/metrics"
+)
+
+func TestDownload_Meta(t *testing.T) {
+	pdf := []byte("%PDF-1.4\n...")
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/download", "/get.aspx":
+			w.Header().Set("Content-Type", "application/pdf")
+		case "/named":
+			w.Header().Set("Content-Disposition", `attachment; filename="fallback.pdf"; filename*=UTF-8''%D1%81%D1%87%D0%B5%D1%82%2042.pdf`)
+		case "/sneaky":
+			w.Header().Set("Content-Disposition", `attachment; filename="../../etc/scan.pdf"`)
+		case "/octet":
+			w.Header().Set("Content-Type", "application/octet-stream")
+		case "/exe":
+			w.Header().Set("Content-Disposition", `attachment; filename=setup.exe`)
+		case "/redirect":
+			http.Redirect(w, r, "/files/report.jpg", http.StatusFound)
+			return
+		}
+		_, _ = w.Write(pdf)
+	}))
+	defer srv.Close()
+
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf", ".jpg"})
+	tests := []struct {
+		path     string
+		filename string
+		ext      string
+		ctype    string
+	}{
+		{"/download?id=42", "", ".pdf", "application/pdf"},
+		{"/named", "счет 42.pdf", ".pdf", "application/pdf"},
+		{"/sneaky", "scan.pdf", ".pdf", "application/pdf"},
+		{"/octet", "", ".pdf", "application/pdf"},
+		{"/download.php?id=42", "", ".pdf", "application/pdf"}, // Тип по содержимому, .php - скрипт.
+		{"/get.aspx?doc=1", "", ".pdf", "application/pdf"},
+		{"/redirect", "", ".jpg", "application/pdf"},
+	}
+	for _, tt := range tests {
+		dest := filepath.Join(t.TempDir(), "001")
+		meta, err := d.Download(context.Background(), srv.URL+tt.path, dest)
+		if err != nil {
+			t.Errorf("%s: unexpected error %v", tt.path, err)
+			continue
+		}
+		if meta.Filename != tt.filename || meta.Ext != tt.ext || meta.ContentType != tt.ctype {
+			t.Errorf("%s: expected %q %q %q, got %+v", tt.path, tt.filename, tt.ext, tt.ctype, meta)
+		}
+		if meta.Size != int64(len(pdf)) {
+			t.Errorf("%s: expected size %d, got %d", tt.path, len(pdf), meta.Size)
+		}
+		if sum := sha256.Sum256(pdf); meta.SHA256 != hex.EncodeToString(sum[:]) {
+			t.Errorf("%s: expected sha256 of the body, got %q", tt.path, meta.SHA256)
+		}
+	}
+
+	meta, err := d.Download(context.Background(), srv.URL+"/redirect", filepath.Join(t.TempDir(), "001"))
+	if err != nil || meta.FinalURL != srv.URL+"/files/report.jpg" {
+		t.Errorf("Expected final url after redirect, got %q, %v", meta.FinalURL, err)
+	}
+
+	dest := filepath.Join(t.TempDir(), "001")
+	if _, err := d.Download(context.Background(), srv.URL+"/exe", dest); !errors.Is(err, errExtNotAllowed) {
+		t.Errorf("Expected errExtNotAllowed, got %v", err)
+	}
+	if _, err := os.Stat(dest); !os.IsNotExist(err) {
+		t.Error("Expected no file for rejected type")
+	}
+}
+
+func TestFilenameFrom(t *testing.T) {
+	tests := []struct {
+		header string
+		want   string
+	}{
+		{"", ""},
+		{"inline", ""},
+		{`attachment; filename="a.pdf"`, "a.pdf"},
+		{`attachment; filename=my report.pdf`, "my report.pdf"},
+		{`attachment; filename="C:\\temp\\a.pdf"`, "a.pdf"},
+		{`attachment; filename=".."`, ""},
+		{`attachment; filename="a:b?.pdf"`, "a_b_.pdf"},
+	}
+	for _, tt := range tests {
+		if got := filenameFrom(tt.header); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.header, tt.want, got)
+		}
+	}
+}
+
+// timeoutErr - сетевая ошибка с Timeout, как у net.Conn по дедлайну.
+type timeoutErr struct{}
+
+func (timeoutErr) Error() string   { return "i/o timeout" }
+func (timeoutErr) Timeout() bool   { return true }
+func (timeoutErr) Temporary() bool { return true }
+
+func TestErrorClass(t *testing.T) {
+	tests := []struct {
+		err  error
+		want string
+	}{
+		{fmt.Errorf("%w: example.com", errHostUnavailable), "host_unavailable"},
+		{FailTransport(errors.New("no CA")).(failTransport).err, "misconfigured"},
+		{fmt.Errorf("%w: .exe", errExtNotAllowed), "extension"},
+		{fmt.Errorf("%w: 100", errTooLarge), "too_large"},
+		{&statusError{code: 503, status: "503 Service Unavailable"}, "http_5xx"},
+		{&statusError{code: 404, status: "404 Not Found"}, "http_4xx"},
+		{fmt.Errorf("get: %w", context.Canceled), "canceled"},
+		{context.DeadlineExceeded, "timeout"},
+		{&net.DNSError{Err: "no such host", Name: "nope.example"}, "dns"},
+		{&net.OpError{Op: "read", Err: timeoutErr{}}, "timeout"},
+		{&net.OpError{Op: "dial", Err: errors.New("connection refused")}, "network"},
+		{errors.New("something"), "other"},
+	}
+	for _, tt := range tests {
+		if got := errorClass(tt.err); got != tt.want {
+			t.Errorf("%v: expected %s, got %s", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestDownload_Metrics(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing.pdf" {
+			http.NotFound(w, r)
+			return
+		}
+		_, _ = w.Write([]byte("%PDF-1.4"))
+	}))
+	defer srv.Close()
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+
+	// Хост не из METRICS_HOSTS - в "other", не отдельной серией.
+	bytes := metrics.DownloadBytes.With(metrics.OtherHost).Value()
+	count := metrics.DownloadDuration.With(metrics.OtherHost).Count()
+	if err := fetchErr(t, d, srv.URL+"/a.pdf"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if got := metrics.DownloadBytes.With(metrics.OtherHost).Value() - bytes; got != 8 {
+		t.Errorf("Expected 8 bytes for other, got %v", got)
+	}
+	if got := metrics.DownloadDuration.With(metrics.OtherHost).Count() - count; got != 1 {
+		t.Errorf("Expected 1 observation for other, got %d", got)
+	}
+
+	metrics.SetHosts([]string{"127.0.0.1"})
+	t.Cleanup(func() { metrics.SetHosts(nil) })
+	bytes = metrics.DownloadBytes.With("127.0.0.1").Value()
+	errs := metrics.DownloadErrors.With("http_4xx").Value()
+	if err := fetchErr(t, d, srv.URL+"/a.pdf"); err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if err := fetchErr(t, d, srv.URL+"/missing.pdf"); err == nil {
+		t.Fatal("Expected 404")
+	}
+	if got := metrics.DownloadBytes.With("127.0.0.1").Value() - bytes; got != 8 {
+		t.Errorf("Expected 8 bytes for 127.0.0.1, got %v", got)
+	}
+	if got := metrics.DownloadErrors.With("http_4xx").Value() - errs; got != 1 {
+		t.Errorf("Expected 1 http_4xx error, got %v", got)
+	}
+}
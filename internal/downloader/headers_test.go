@@ -0,0 +1,93 @@
+package downloader
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWithHeaders(t *testing.T) {
+	// other - чужой хост, сюда токен попасть не должен.
+	var leaked string
+	other := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		leaked = r.Header.Get("X-Api-Key")
+		_, _ = w.Write([]byte("%PDF-other"))
+	}))
+	defer other.Close()
+
+	hits := 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/away.pdf":
+			http.Redirect(w, r, other.URL+"/a.pdf", http.StatusFound)
+		case r.URL.Path == "/moved.pdf":
+			http.Redirect(w, r, "/a.pdf", http.StatusFound)
+		case r.Header.Get("X-Api-Key") != "secret":
+			w.WriteHeader(http.StatusUnauthorized)
+		default:
+			hits++
+			w.Header().Set("ETag", `"v1"`)
+			_, _ = w.Write([]byte("%PDF-secret"))
+		}
+	}))
+	defer srv.Close()
+
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+	cache, err := NewCache(t.TempDir(), 1<<20)
+	if err != nil {
+		t.Fatalf("NewCache: %v", err)
+	}
+	d.SetCache(cache)
+	ctx := WithHeaders(context.Background(), http.Header{"X-Api-Key": {"secret"}})
+	fetch := func(ctx context.Context, url string) (Meta, error) {
+		return d.Download(ctx, url, filepath.Join(t.TempDir(), "001"))
+	}
+
+	if _, err := fetch(ctx, srv.URL+"/a.pdf"); err != nil {
+		t.Errorf("Expected download with header, got %v", err)
+	}
+	if _, err := fetch(context.Background(), srv.URL+"/a.pdf"); err == nil {
+		t.Error("Expected 401 without header")
+	}
+	// Тот же хост - заголовок остается.
+	if _, err := fetch(ctx, srv.URL+"/moved.pdf"); err != nil {
+		t.Errorf("Expected header to survive same host redirect, got %v", err)
+	}
+	if _, err := fetch(ctx, srv.URL+"/away.pdf"); err != nil {
+		t.Errorf("Unexpected error %v", err)
+	}
+	if leaked != "" {
+		t.Errorf("Expected header to be dropped on cross host redirect, got %q", leaked)
+	}
+	// Файлы за заголовком мимо кеша: каждый раз качаем заново.
+	if meta, err := fetch(ctx, srv.URL+"/a.pdf"); err != nil || meta.Cached {
+		t.Errorf("Expected fresh download, got cached=%v err=%v", meta.Cached, err)
+	}
+	if hits != 3 {
+		t.Errorf("Expected 3 downloads with header, got %d", hits)
+	}
+}
+
+func TestDownload_RedactsFinalURL(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/login.pdf" {
+			http.Redirect(w, r, "http://user:hunter2@"+r.Host+"/a.pdf", http.StatusFound)
+			return
+		}
+		_, _ = w.Write([]byte("%PDF-"))
+	}))
+	defer srv.Close()
+
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+	meta, err := d.Download(context.Background(), srv.URL+"/login.pdf", filepath.Join(t.TempDir(), "001"))
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if strings.Contains(meta.FinalURL, "hunter2") || !strings.HasSuffix(meta.FinalURL, "/a.pdf") {
+		t.Errorf("Expected redacted final url, got %q", meta.FinalURL)
+	}
+}
@@ -0,0 +1,195 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/metrics"
+)
+
+// HostPolicy - как загрузчик бережет чужие хосты, 0 - выключено.
+type HostPolicy struct {
+	FailureThreshold  int           // Сколько неудач подряд, чтобы перестать ходить на хост.
+	Cooldown          time.Duration // Сколько хост отдыхает, потом одна пробная загрузка.
+	RequestsPerMinute int           // Не чаще стольких запросов к одному хосту.
+}
+
+// errHostUnavailable - хост недавно падал, не ждем таймаут, а сразу отказываем.
+var errHostUnavailable = errors.New("host temporarily unavailable")
+
+// hostGuard - circuit breaker и лимит запросов на каждый хост.
+//
+// Breaker замкнут, пока хост отвечает. После FailureThreshold неудач подряд
+// (сеть, таймаут, 5xx, 429) он размыкается: Cooldown загрузки с хоста сразу
+// получают errHostUnavailable, а не висят по минуте. Потом пропускается
+// одна пробная загрузка (half-open): удалась - breaker снова замкнут,
+// нет - хост отдыхает еще Cooldown. 404 и прочие 4xx - хост живой, счет сбрасывается.
+type hostGuard struct {
+	mu     sync.Mutex
+	policy HostPolicy
+	hosts  map[string]*hostState
+	probes uint64 // Последний выданный номер пробы.
+}
+
+type hostState struct {
+	failures  int
+	openUntil time.Time // Нулевое - breaker замкнут.
+	probe     uint64    // Номер идущей пробной загрузки, 0 - ее нет. Остальным отказ.
+	next      time.Time // Раньше этого времени новый запрос не начинать.
+}
+
+// outcome - чем кончилась загрузка для breaker.
+type outcome int
+
+const (
+	hostOK      outcome = iota // Хост ответил.
+	hostFailed                 // Хост не ответил или ответил 5xx/429.
+	hostUnknown                // Не дошли до хоста или нас отменили, не в счет.
+)
+
+func newHostGuard() *hostGuard {
+	return &hostGuard{hosts: make(map[string]*hostState)}
+}
+
+func (g *hostGuard) setPolicy(p HostPolicy) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.policy = p
+	if p.FailureThreshold <= 0 {
+		// Breaker выключили - разомкнутые хосты больше не ждут.
+		for _, s := range g.hosts {
+			s.failures, s.openUntil, s.probe = 0, time.Time{}, 0
+		}
+	}
+}
+
+func (g *hostGuard) state(host string) *hostState {
+	s, ok := g.hosts[host]
+	if !ok {
+		s = &hostState{}
+		g.hosts[host] = s
+	}
+	return s
+}
+
+// allow - можно ли идти на хост. Ошибка - breaker разомкнут.
+// probe - номер пробной загрузки (half-open), 0 - обычная.
+// После allow без ошибки обязательно report с этим probe.
+func (g *hostGuard) allow(host string) (probe uint64, err error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.hosts[host]
+	if g.policy.FailureThreshold <= 0 || !ok || s.openUntil.IsZero() {
+		return 0, nil
+	}
+	if wait := time.Until(s.openUntil); wait > 0 {
+		return 0, fmt.Errorf("%w: %s, retry in %s", errHostUnavailable, host, wait.Round(time.Second))
+	}
+	if s.probe != 0 {
+		return 0, fmt.Errorf("%w: %s, checking if it is back", errHostUnavailable, host)
+	}
+	g.probes++
+	s.probe = g.probes
+	return s.probe, nil
+}
+
+// wait ждет своей очереди к хосту по RequestsPerMinute. Очередь
+// занимается сразу, так что несколько ждущих расходятся по интервалу.
+func (g *hostGuard) wait(ctx context.Context, host string) error {
+	g.mu.Lock()
+	rpm := g.policy.RequestsPerMinute
+	if rpm <= 0 {
+		g.mu.Unlock()
+		return nil
+	}
+	s := g.state(host)
+	now := time.Now()
+	at := s.next
+	if at.Before(now) {
+		at = now
+	}
+	s.next = at.Add(time.Minute / time.Duration(rpm))
+	g.mu.Unlock()
+
+	d := time.Until(at)
+	if d <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// report - чем кончилась загрузка, разрешенная allow.
+// Пробу снимает только она сама: загрузка, начатая до того, как breaker
+// разомкнулся, иначе пропустила бы вторую пробу, пока первая еще идет.
+// true - breaker только что разомкнулся.
+func (g *hostGuard) report(host string, o outcome, probe uint64) bool {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	s, ok := g.hosts[host]
+	if !ok {
+		if o != hostFailed || g.policy.FailureThreshold <= 0 {
+			return false
+		}
+		s = g.state(host)
+	}
+	isProbe := probe != 0 && s.probe == probe
+	if isProbe {
+		s.probe = 0
+	}
+	switch o {
+	case hostOK:
+		s.failures, s.openUntil = 0, time.Time{}
+		if s.next.Before(time.Now()) {
+			delete(g.hosts, host)
+		}
+	case hostFailed:
+		s.failures++
+		if g.policy.FailureThreshold > 0 && (isProbe || s.failures >= g.policy.FailureThreshold) {
+			opened := s.openUntil.IsZero()
+			s.openUntil = time.Now().Add(g.policy.Cooldown)
+			if opened {
+				metrics.DownloadCircuitOpened.With(metrics.Host(host)).Inc()
+			}
+			return opened
+		}
+	}
+	return false
+}
+
+// hostOutcome - в чем виноват хост. Наши отказы (тип, размер), отмена
+// и наши же дедлайны (ждали очередь или полосу) - не в счет,
+// а вот молчание сервера дольше Timeout - в счет.
+func hostOutcome(err error) outcome {
+	var se *statusError
+	switch {
+	case err == nil:
+		return hostOK
+	case errors.Is(err, errServerSilent):
+		return hostFailed
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return hostUnknown
+	case errors.As(err, &se):
+		if se.code >= 500 || se.code == http.StatusTooManyRequests {
+			return hostFailed
+		}
+		return hostOK
+	}
+	switch errorClass(err) {
+	case "network", "timeout", "dns":
+		return hostFailed
+	case "extension", "too_large":
+		return hostOK
+	}
+	return hostUnknown
+}
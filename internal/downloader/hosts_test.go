@@ -0,0 +1,200 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// flakyServer отвечает 503, пока down, на /missing.pdf - 404. hits считает запросы.
+type flakyServer struct {
+	*httptest.Server
+	down atomic.Bool
+	hits atomic.Int32
+}
+
+func newFlakyServer(t *testing.T) *flakyServer {
+	t.Helper()
+	s := &flakyServer{}
+	s.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		s.hits.Add(1)
+		switch {
+		case r.URL.Path == "/missing.pdf":
+			http.NotFound(w, r)
+		case s.down.Load():
+			w.WriteHeader(http.StatusServiceUnavailable)
+		default:
+			_, _ = w.Write([]byte("%PDF-1.4"))
+		}
+	}))
+	t.Cleanup(s.Close)
+	return s
+}
+
+func fetchErr(t *testing.T, d *HTTPDownloader, url string) error {
+	t.Helper()
+	_, err := d.Download(context.Background(), url, filepath.Join(t.TempDir(), "001"))
+	return err
+}
+
+func TestHostGuard_Breaker(t *testing.T) {
+	srv := newFlakyServer(t)
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+	d.SetHostPolicy(HostPolicy{FailureThreshold: 2, Cooldown: 100 * time.Millisecond})
+
+	srv.down.Store(true)
+	for i := 0; i < 2; i++ {
+		var se *statusError
+		if err := fetchErr(t, d, srv.URL+"/a.pdf"); !errors.As(err, &se) {
+			t.Fatalf("Expected 503, got %v", err)
+		}
+	}
+	// Breaker разомкнут: до сервера запрос не доходит.
+	if err := fetchErr(t, d, srv.URL+"/b.pdf"); !errors.Is(err, errHostUnavailable) {
+		t.Errorf("Expected errHostUnavailable, got %v", err)
+	}
+	if srv.hits.Load() != 2 {
+		t.Errorf("Expected 2 requests to the server, got %d", srv.hits.Load())
+	}
+
+	// Пробная загрузка не удалась - хост снова отдыхает.
+	time.Sleep(150 * time.Millisecond)
+	if err := fetchErr(t, d, srv.URL+"/a.pdf"); errors.Is(err, errHostUnavailable) || err == nil {
+		t.Errorf("Expected probe to reach the server, got %v", err)
+	}
+	if err := fetchErr(t, d, srv.URL+"/a.pdf"); !errors.Is(err, errHostUnavailable) {
+		t.Errorf("Expected errHostUnavailable after failed probe, got %v", err)
+	}
+
+	// Хост ожил: проба проходит, breaker снова замкнут.
+	srv.down.Store(false)
+	time.Sleep(150 * time.Millisecond)
+	for i := 0; i < 2; i++ {
+		if err := fetchErr(t, d, srv.URL+"/a.pdf"); err != nil {
+			t.Errorf("Expected host to be back, got %v", err)
+		}
+	}
+}
+
+func TestHostGuard_ClientErrorsDoNotCount(t *testing.T) {
+	srv := newFlakyServer(t)
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+	d.SetHostPolicy(HostPolicy{FailureThreshold: 2, Cooldown: time.Minute})
+
+	for i := 0; i < 3; i++ {
+		if err := fetchErr(t, d, srv.URL+"/missing.pdf"); errors.Is(err, errHostUnavailable) {
+			t.Fatalf("Expected 404 not to pause the host, got %v", err)
+		}
+	}
+	if srv.hits.Load() != 3 {
+		t.Errorf("Expected 3 requests to the server, got %d", srv.hits.Load())
+	}
+}
+
+func TestHostGuard_RequestsPerMinute(t *testing.T) {
+	srv := newFlakyServer(t)
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+	d.SetHostPolicy(HostPolicy{RequestsPerMinute: 600}) // Раз в 100ms.
+
+	start := time.Now()
+	for i := 0; i < 3; i++ {
+		if err := fetchErr(t, d, srv.URL+"/a.pdf"); err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+	}
+	if elapsed := time.Since(start); elapsed < 190*time.Millisecond {
+		t.Errorf("Expected requests spaced by 100ms, got %s for 3", elapsed)
+	}
+}
+
+func TestHostGuard_ProbeToken(t *testing.T) {
+	g := newHostGuard()
+	g.setPolicy(HostPolicy{FailureThreshold: 1, Cooldown: 50 * time.Millisecond})
+
+	// Загрузка началась, пока хост был живой.
+	early, err := g.allow("h")
+	if err != nil || early != 0 {
+		t.Fatalf("Expected a regular download, got %d %v", early, err)
+	}
+	failed, _ := g.allow("h")
+	if !g.report("h", hostFailed, failed) {
+		t.Fatal("Expected breaker to open")
+	}
+
+	time.Sleep(60 * time.Millisecond)
+	probe, err := g.allow("h")
+	if err != nil || probe == 0 {
+		t.Fatalf("Expected a probe, got %d %v", probe, err)
+	}
+	// Старая загрузка закончилась - проба от этого не снимается.
+	g.report("h", hostUnknown, early)
+	if _, err := g.allow("h"); !errors.Is(err, errHostUnavailable) {
+		t.Errorf("Expected second probe to be refused while the first runs, got %v", err)
+	}
+	g.report("h", hostOK, probe)
+	if p, err := g.allow("h"); err != nil || p != 0 {
+		t.Errorf("Expected host to be back, got %d %v", p, err)
+	}
+}
+
+func TestHostOutcome(t *testing.T) {
+	tests := []struct {
+		err  error
+		want outcome
+	}{
+		{nil, hostOK},
+		{&statusError{code: 404}, hostOK},
+		{&statusError{code: 503}, hostFailed},
+		{fmt.Errorf("%w for 30s: %w", errServerSilent, context.Canceled), hostFailed},
+		{fmt.Errorf("get: %w", context.DeadlineExceeded), hostUnknown},
+		{context.Canceled, hostUnknown},
+		{errExtNotAllowed, hostOK},
+	}
+	for _, tt := range tests {
+		if got := hostOutcome(tt.err); got != tt.want {
+			t.Errorf("%v: expected %d, got %d", tt.err, tt.want, got)
+		}
+	}
+}
+
+func TestHostGuard_OwnWaitsDoNotCount(t *testing.T) {
+	body := append([]byte("%PDF-"), bytes.Repeat([]byte{'x'}, 64<<10)...)
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	// Очередь к хосту дольше Timeout - не ошибка.
+	d := NewHTTPDownloader(50*time.Millisecond, 1<<20, []string{".pdf"})
+	d.SetHostPolicy(HostPolicy{FailureThreshold: 1, Cooldown: time.Minute, RequestsPerMinute: 600})
+	for i := 0; i < 3; i++ {
+		if err := fetchErr(t, d, srv.URL+"/a.pdf"); err != nil {
+			t.Fatalf("Expected rate limited download to succeed, got %v", err)
+		}
+	}
+
+	// Наш дедлайн вышел, пока ждали полосу, - хост живой, breaker не трогаем.
+	d.SetHostPolicy(HostPolicy{FailureThreshold: 1, Cooldown: time.Minute})
+	d.SetScheduler(NewScheduler(Limits{Bandwidth: 16 << 10}))
+	ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+	defer cancel()
+	if _, err := d.Download(ctx, srv.URL+"/a.pdf", filepath.Join(t.TempDir(), "001")); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	d.SetScheduler(nil)
+	if err := fetchErr(t, d, srv.URL+"/a.pdf"); err != nil {
+		t.Errorf("Expected host not to be paused after our own deadline, got %v", err)
+	}
+	if n := hits.Load(); n != 5 {
+		t.Errorf("Expected 5 requests to the server, got %d", n)
+	}
+}
@@ -0,0 +1,149 @@
+package downloader
+
+import (
+	"mime"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/naming"
+)
+
+// Meta - что удалось узнать о файле из ответа.
+type Meta struct {
+	FinalURL    string // url после редиректов.
+	ContentType string // Тип без параметров, если сервер не сказал - определенный по содержимому.
+	Filename    string // Имя из Content-Disposition, уже почищенное, может быть пустым.
+	Ext         string // Расширение файла в нижнем регистре, с точкой, см. fileExt.
+	Size        int64  // Сколько байт записано.
+	SHA256      string // sha256 записанного в hex, пусто - если скачать не удалось.
+	Cached      bool   // Сервер ответил 304, файл взят из кеша.
+}
+
+// sniffLen - сколько байт смотрит http.DetectContentType.
+const sniffLen = 512
+
+// Для частых типов расширение задаем сами: mime.ExtensionsByType
+// зависит от системы и для image/jpeg может вернуть .jfif.
+var extByType = map[string]string{
+	"application/pdf":          ".pdf",
+	"application/zip":          ".zip",
+	"application/json":         ".json",
+	"application/xml":          ".xml",
+	"application/msword":       ".doc",
+	"application/vnd.ms-excel": ".xls",
+	"application/vnd.openxmlformats-officedocument.wordprocessingml.document": ".docx",
+	"application/vnd.openxmlformats-officedocument.spreadsheetml.sheet":       ".xlsx",
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"text/plain": ".txt",
+	"text/csv":   ".csv",
+	"text/html":  ".html",
+	"text/xml":   ".xml",
+}
+
+// Расширения файлов, которым можно верить по url, сверх extByType.
+var fileExts = []string{
+	".jpeg", ".tif", ".tiff", ".bmp", ".svg", ".ico", ".heic", ".avif",
+	".rtf", ".odt", ".ods", ".odp", ".ppt", ".pptx", ".epub", ".djvu", ".md",
+	".7z", ".rar", ".gz", ".tgz", ".tar", ".bz2", ".xz",
+	".exe", ".msi", ".dmg", ".apk", ".iso", ".bin",
+	".mp3", ".wav", ".mp4", ".mov", ".avi",
+}
+
+// IsFileExt - расширение из пути url говорит, что за файл (документ,
+// картинка, архив), а не каким скриптом он отдается: у /download.php?id=42
+// .php - это сервер, тип файла скажет только ответ.
+func IsFileExt(ext string) bool {
+	ext = strings.ToLower(ext)
+	for _, e := range extByType {
+		if e == ext {
+			return true
+		}
+	}
+	return slices.Contains(fileExts, ext)
+}
+
+// extFromType - расширение по MIME типу, "" - не знаем такого.
+func extFromType(contentType string) string {
+	if ext, ok := extByType[contentType]; ok {
+		return ext
+	}
+	if exts, err := mime.ExtensionsByType(contentType); err == nil && len(exts) > 0 {
+		return exts[0]
+	}
+	return ""
+}
+
+// contentType - тип из заголовка, а если его нет или он ничего
+// не говорит (application/octet-stream) - по первым байтам.
+func contentType(header string, head []byte) string {
+	if header != "" {
+		if mt, _, err := mime.ParseMediaType(header); err == nil && mt != "application/octet-stream" {
+			return mt
+		}
+	}
+	if len(head) == 0 {
+		return ""
+	}
+	mt, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	return mt
+}
+
+// filenameFrom достает имя файла из Content-Disposition: filename* (RFC 5987,
+// mime.ParseMediaType его раскодирует) или filename. Путь отрезается,
+// имя чистится, так что "../../x.pdf" станет "x.pdf".
+func filenameFrom(header string) string {
+	if header == "" {
+		return ""
+	}
+	var name string
+	if _, params, err := mime.ParseMediaType(header); err == nil {
+		name = params["filename"]
+	} else {
+		// Кривой заголовок, например filename без кавычек и с пробелами.
+		// Берем как есть до ";".
+		_, rest, ok := strings.Cut(header, "filename=")
+		if !ok {
+			return ""
+		}
+		name, _, _ = strings.Cut(rest, ";")
+		name = strings.Trim(strings.TrimSpace(name), `"'`)
+	}
+	name = path.Base(strings.ReplaceAll(name, `\`, "/"))
+	if name == "." || name == "/" || strings.Trim(name, ". ") == "" {
+		return ""
+	}
+	return naming.CleanName(name)
+}
+
+// fileExt - расширение, по которому проверяется тип файла:
+// из имени в Content-Disposition, из пути url после редиректов
+// или исходного url, если это расширение файла (см. IsFileExt),
+// потом по MIME типу. Незнакомое расширение из url (.dwg) - последним,
+// когда по типу ничего не понять.
+func fileExt(m Meta, rawURL string) string {
+	if ext := path.Ext(m.Filename); ext != "" {
+		return strings.ToLower(ext)
+	}
+	var unknown string
+	for _, s := range []string{m.FinalURL, rawURL} {
+		if u, err := url.Parse(s); err == nil {
+			if ext := strings.ToLower(path.Ext(u.Path)); IsFileExt(ext) {
+				return ext
+			} else if unknown == "" {
+				unknown = ext
+			}
+		}
+	}
+	if m.ContentType != "application/octet-stream" {
+		if ext := extFromType(m.ContentType); ext != "" {
+			return ext
+		}
+	}
+	return unknown
+}
@@ -0,0 +1,206 @@
+package downloader
+
+import (
+	"context"
+	"io"
+	"sync"
+	"time"
+)
+
+// Limits - общие лимиты на загрузки, 0 - без ограничения.
+type Limits struct {
+	MaxConns        int   // Соединений всего.
+	MaxConnsPerHost int   // Соединений на один хост.
+	Bandwidth       int64 // Байт/с на весь сервис.
+	TaskBandwidth   int64 // Байт/с на одну таску.
+}
+
+// Scheduler - общий для всех тасок диспетчер загрузок: раздает слоты
+// на соединения (всего и на хост) и делит полосу токен-бакетами,
+// общим и потаскным. Канал у нас общий с продом, поэтому лимиты на сервис,
+// а не на таску: три таски по MAX_FILES url не должны забить его втроем.
+//
+// Очереди как таковой нет: освободившийся слот достается тому, кто первым
+// проснулся. Для десятка загрузок этого хватает.
+type Scheduler struct {
+	mu      sync.Mutex
+	limits  Limits
+	conns   int
+	hosts   map[string]int
+	freed   chan struct{} // Закрывается, когда освободился слот, и заменяется новым.
+	overall bucket
+}
+
+// Конструктор планировщика, лимиты можно потом поменять через SetLimits.
+func NewScheduler(l Limits) *Scheduler {
+	return &Scheduler{
+		limits: l,
+		hosts:  make(map[string]int),
+		freed:  make(chan struct{}),
+	}
+}
+
+// SetLimits меняет лимиты на лету. Уже занятые слоты не отбираются,
+// новая полоса действует сразу, в том числе для идущих загрузок.
+func (s *Scheduler) SetLimits(l Limits) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.limits = l
+	s.wake() // Лимит могли поднять, ждущим пора проверить еще раз.
+}
+
+// Limits - текущие лимиты.
+func (s *Scheduler) Limits() Limits {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.limits
+}
+
+// Active - сколько соединений занято сейчас.
+func (s *Scheduler) Active() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.conns
+}
+
+// acquire ждет слот на соединение с host. release обязательно вызвать.
+func (s *Scheduler) acquire(ctx context.Context, host string) (release func(), err error) {
+	for {
+		s.mu.Lock()
+		l := s.limits
+		if (l.MaxConns <= 0 || s.conns < l.MaxConns) && (l.MaxConnsPerHost <= 0 || s.hosts[host] < l.MaxConnsPerHost) {
+			s.conns++
+			s.hosts[host]++
+			s.mu.Unlock()
+			var once sync.Once
+			return func() { once.Do(func() { s.release(host) }) }, nil
+		}
+		freed := s.freed
+		s.mu.Unlock()
+
+		select {
+		case <-freed:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+func (s *Scheduler) release(host string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.conns--
+	if s.hosts[host]--; s.hosts[host] <= 0 {
+		delete(s.hosts, host)
+	}
+	s.wake()
+}
+
+// wake будит всех ждущих, под mu.
+func (s *Scheduler) wake() {
+	close(s.freed)
+	s.freed = make(chan struct{})
+}
+
+// reader ограничивает чтение r общей полосой и полосой таски из ctx.
+func (s *Scheduler) reader(ctx context.Context, r io.Reader) io.Reader {
+	return &throttledReader{ctx: ctx, r: r, s: s, task: taskFrom(ctx)}
+}
+
+// take - n байт прочитано, ждем, пока это позволят оба бакета.
+func (s *Scheduler) take(ctx context.Context, task *bucket, n int) error {
+	l := s.Limits()
+	if err := s.overall.take(ctx, n, l.Bandwidth); err != nil {
+		return err
+	}
+	if task != nil {
+		return task.take(ctx, n, l.TaskBandwidth)
+	}
+	return nil
+}
+
+// throttledReader читает не больше полосы: сначала читает, потом
+// отсыпает за прочитанное. Кусок за раз не больше секунды полосы,
+// чтобы один Read не занимал канал надолго.
+type throttledReader struct {
+	ctx  context.Context
+	r    io.Reader
+	s    *Scheduler
+	task *bucket
+}
+
+func (t *throttledReader) Read(p []byte) (int, error) {
+	l := t.s.Limits()
+	if rate := minRate(l.Bandwidth, l.TaskBandwidth, t.task != nil); rate > 0 && int64(len(p)) > rate {
+		p = p[:rate]
+	}
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if werr := t.s.take(t.ctx, t.task, n); werr != nil {
+			return n, werr
+		}
+	}
+	return n, err
+}
+
+// minRate - самый строгий из включенных лимитов, 0 - лимитов нет.
+func minRate(overall, task int64, hasTask bool) int64 {
+	if !hasTask || task <= 0 {
+		return overall
+	}
+	if overall <= 0 || task < overall {
+		return task
+	}
+	return overall
+}
+
+// bucket - токен-бакет на rate байт/с, копит не больше секунды полосы.
+// rate передается при каждом take, чтобы лимит можно было менять на лету.
+// Уходить в минус можно: прочитанное уже прочитано, долг отсыпается.
+type bucket struct {
+	mu     sync.Mutex
+	tokens float64
+	last   time.Time
+}
+
+func (b *bucket) take(ctx context.Context, n int, rate int64) error {
+	if rate <= 0 {
+		return nil
+	}
+	b.mu.Lock()
+	now := time.Now()
+	if b.last.IsZero() {
+		b.tokens = float64(rate)
+	} else {
+		b.tokens = min(b.tokens+now.Sub(b.last).Seconds()*float64(rate), float64(rate))
+	}
+	b.last = now
+	b.tokens -= float64(n)
+	wait := time.Duration(-b.tokens / float64(rate) * float64(time.Second))
+	b.mu.Unlock()
+
+	if wait <= 0 {
+		return nil
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+type taskKey struct{}
+
+// WithTask помечает ctx как контекст одной таски: все загрузки с ним
+// делят полосу TaskBandwidth. Без метки загрузка ограничена только общей.
+func WithTask(ctx context.Context) context.Context {
+	return context.WithValue(ctx, taskKey{}, &bucket{})
+}
+
+func taskFrom(ctx context.Context) *bucket {
+	b, _ := ctx.Value(taskKey{}).(*bucket)
+	return b
+}
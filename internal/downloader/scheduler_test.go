@@ -0,0 +1,173 @@
+package downloader
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// blocked - acquire не получил слот за короткое время.
+func blocked(t *testing.T, s *Scheduler, host string) bool {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	release, err := s.acquire(ctx, host)
+	if err == nil {
+		release()
+		return false
+	}
+	if !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("Expected DeadlineExceeded, got %v", err)
+	}
+	return true
+}
+
+func TestScheduler_Conns(t *testing.T) {
+	s := NewScheduler(Limits{MaxConns: 2, MaxConnsPerHost: 1})
+	ctx := context.Background()
+
+	releaseA, err := s.acquire(ctx, "a.example")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !blocked(t, s, "a.example") {
+		t.Error("Expected second connection to a.example to wait")
+	}
+	releaseB, err := s.acquire(ctx, "b.example")
+	if err != nil {
+		t.Fatalf("Unexpected error %v", err)
+	}
+	if !blocked(t, s, "c.example") {
+		t.Error("Expected third connection to wait for MaxConns")
+	}
+	if s.Active() != 2 {
+		t.Errorf("Expected 2 active connections, got %d", s.Active())
+	}
+
+	// Ждущий просыпается, как только слот освободился.
+	got := make(chan error, 1)
+	go func() {
+		release, err := s.acquire(ctx, "a.example")
+		if err == nil {
+			release()
+		}
+		got <- err
+	}()
+	releaseA()
+	releaseA() // Повторный release ничего не ломает.
+	select {
+	case err := <-got:
+		if err != nil {
+			t.Errorf("Unexpected error %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Expected waiter to get the freed slot")
+	}
+
+	// Подняли лимит - ждать больше нечего.
+	s.SetLimits(Limits{})
+	if blocked(t, s, "b.example") {
+		t.Error("Expected no limits after SetLimits")
+	}
+	releaseB()
+	if s.Active() != 0 {
+		t.Errorf("Expected 0 active connections, got %d", s.Active())
+	}
+}
+
+func TestScheduler_Bandwidth(t *testing.T) {
+	body := append([]byte("%PDF-"), bytes.Repeat([]byte{'x'}, 64<<10)...)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	fetch := func(d *HTTPDownloader, ctx context.Context) time.Duration {
+		t.Helper()
+		start := time.Now()
+		meta, err := d.Download(ctx, srv.URL+"/a.pdf", filepath.Join(t.TempDir(), "001"))
+		if err != nil {
+			t.Fatalf("Unexpected error %v", err)
+		}
+		if meta.Size != int64(len(body)) {
+			t.Errorf("Expected %d bytes, got %d", len(body), meta.Size)
+		}
+		return time.Since(start)
+	}
+
+	// 64KB при 32KB/s: первая секунда полосы есть сразу, на остальное - еще секунда.
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+	d.SetScheduler(NewScheduler(Limits{Bandwidth: 32 << 10}))
+	if elapsed := fetch(d, context.Background()); elapsed < 900*time.Millisecond {
+		t.Errorf("Expected about 1s with overall limit, got %s", elapsed)
+	}
+
+	// Полоса таски действует только на загрузки с WithTask.
+	d.SetScheduler(NewScheduler(Limits{TaskBandwidth: 32 << 10}))
+	if elapsed := fetch(d, context.Background()); elapsed > 500*time.Millisecond {
+		t.Errorf("Expected no limit without a task, got %s", elapsed)
+	}
+	if elapsed := fetch(d, WithTask(context.Background())); elapsed < 900*time.Millisecond {
+		t.Errorf("Expected about 1s with task limit, got %s", elapsed)
+	}
+}
+
+func TestDownload_TimeoutIgnoresQueueAndBandwidth(t *testing.T) {
+	body := append([]byte("%PDF-"), bytes.Repeat([]byte{'x'}, 64<<10)...)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write(body)
+	}))
+	defer srv.Close()
+
+	// Под лимитом полосы файл качается ~1s, втрое дольше Timeout.
+	d := NewHTTPDownloader(300*time.Millisecond, 1<<20, []string{".pdf"})
+	s := NewScheduler(Limits{MaxConns: 1, Bandwidth: 32 << 10})
+	d.SetScheduler(s)
+	start := time.Now()
+	if err := fetchErr(t, d, srv.URL+"/a.pdf"); err != nil {
+		t.Fatalf("Expected throttled download longer than Timeout to succeed, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed < 900*time.Millisecond {
+		t.Errorf("Expected throttled download, got %s", elapsed)
+	}
+
+	// В очереди за слотом дольше Timeout - тоже не повод падать.
+	s.SetLimits(Limits{MaxConns: 1})
+	release, err := s.acquire(context.Background(), "other.example")
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.AfterFunc(500*time.Millisecond, release)
+	if err := fetchErr(t, d, srv.URL+"/a.pdf"); err != nil {
+		t.Errorf("Expected queued download to succeed, got %v", err)
+	}
+}
+
+func TestDownload_ServerSilent(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/stalled.pdf" {
+			// Начал отдавать и замолчал.
+			_, _ = w.Write([]byte("%PDF-"))
+			w.(http.Flusher).Flush()
+		}
+		<-r.Context().Done()
+	}))
+	defer srv.Close()
+
+	d := NewHTTPDownloader(200*time.Millisecond, 1<<20, []string{".pdf"})
+	for _, path := range []string{"/no-headers.pdf", "/stalled.pdf"} {
+		start := time.Now()
+		err := fetchErr(t, d, srv.URL+path)
+		if !errors.Is(err, errServerSilent) || errorClass(err) != "timeout" {
+			t.Errorf("%s: expected errServerSilent, got %v", path, err)
+		}
+		if elapsed := time.Since(start); elapsed > 2*time.Second {
+			t.Errorf("%s: expected to give up after Timeout, took %s", path, elapsed)
+		}
+	}
+}
@@ -0,0 +1,154 @@
+package downloader
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// TransportConfig - как загрузчик ходит в сеть. Пустой - напрямую,
+// прокси из HTTP_PROXY/HTTPS_PROXY/NO_PROXY, как у любой Go программы.
+type TransportConfig struct {
+	Proxy         string   // http://, https:// или socks5://, можно с user:pass@.
+	NoProxy       []string // Куда ходить мимо Proxy, правила как в NO_PROXY.
+	CAFile        string   // PEM с корпоративными CA, в дополнение к системным.
+	CertFile      string   // Клиентский сертификат для mTLS, PEM.
+	KeyFile       string   // Ключ к нему.
+	MinTLSVersion string   // 1.0-1.3, пусто - 1.2.
+}
+
+// tlsVersions - допустимые MinTLSVersion.
+var tlsVersions = map[string]uint16{
+	"1.0": tls.VersionTLS10,
+	"1.1": tls.VersionTLS11,
+	"1.2": tls.VersionTLS12,
+	"1.3": tls.VersionTLS13,
+}
+
+// NewTransport собирает транспорт для всех загрузок. Он один на сервис,
+// так что keep-alive соединения переиспользуются между файлами и тасками.
+// Ошибка - кривой прокси, нечитаемый CA или сертификат.
+func NewTransport(c TransportConfig) (*http.Transport, error) {
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.MaxIdleConnsPerHost = 8
+	t.IdleConnTimeout = 90 * time.Second
+
+	if c.Proxy != "" {
+		proxyURL, err := url.Parse(c.Proxy)
+		if err != nil {
+			return nil, fmt.Errorf("invalid proxy url: %w", err)
+		}
+		switch proxyURL.Scheme {
+		case "http", "https", "socks5":
+		default:
+			return nil, fmt.Errorf("unsupported proxy scheme %q, want http, https or socks5", proxyURL.Scheme)
+		}
+		rules := c.NoProxy
+		t.Proxy = func(r *http.Request) (*url.URL, error) {
+			if bypassProxy(r.URL, rules) {
+				return nil, nil
+			}
+			return proxyURL, nil
+		}
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if c.MinTLSVersion != "" {
+		v, ok := tlsVersions[c.MinTLSVersion]
+		if !ok {
+			return nil, fmt.Errorf("unsupported TLS version %q, want 1.0-1.3", c.MinTLSVersion)
+		}
+		tlsConfig.MinVersion = v
+	}
+	if c.CAFile != "" {
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool() // На Windows без системного пула - только свои CA.
+		}
+		pem, err := os.ReadFile(c.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA file: %w", err)
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates found in CA file %s", c.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if c.CertFile != "" || c.KeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(c.CertFile, c.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	t.TLSClientConfig = tlsConfig
+	return t, nil
+}
+
+// FailTransport - транспорт, на котором любая загрузка падает с err.
+// Если настроенный транспорт не собрался, качать напрямую в обход
+// прокси нельзя: пусть лучше загрузки падают с понятной ошибкой.
+func FailTransport(err error) http.RoundTripper {
+	return failTransport{fmt.Errorf("%w: %w", errMisconfigured, err)}
+}
+
+type failTransport struct{ err error }
+
+func (f failTransport) RoundTrip(*http.Request) (*http.Response, error) {
+	return nil, f.err
+}
+
+// bypassProxy - идти ли на u мимо прокси. Правила как в NO_PROXY:
+// "*" - все; example.com и .example.com - сам домен и поддомены;
+// IP и подсети (10.0.0.0/8); с :порт - только этот порт.
+// localhost и loopback всегда напрямую, как и у ProxyFromEnvironment.
+func bypassProxy(u *url.URL, rules []string) bool {
+	host := strings.ToLower(u.Hostname())
+	port := u.Port()
+	if port == "" {
+		port = map[string]string{"http": "80", "https": "443"}[u.Scheme]
+	}
+	ip := net.ParseIP(host)
+	if host == "localhost" || ip != nil && ip.IsLoopback() {
+		return true
+	}
+	for _, rule := range rules {
+		rule = strings.ToLower(strings.TrimSpace(rule))
+		if rule == "" {
+			continue
+		}
+		if rule == "*" {
+			return true
+		}
+		if _, cidr, err := net.ParseCIDR(rule); err == nil {
+			if ip != nil && cidr.Contains(ip) {
+				return true
+			}
+			continue
+		}
+		ruleHost, rulePort := rule, ""
+		if h, p, err := net.SplitHostPort(rule); err == nil {
+			ruleHost, rulePort = h, p
+		}
+		if rulePort != "" && rulePort != port {
+			continue
+		}
+		if ruleIP := net.ParseIP(ruleHost); ruleIP != nil {
+			if ip != nil && ruleIP.Equal(ip) {
+				return true
+			}
+			continue
+		}
+		ruleHost = strings.TrimPrefix(strings.TrimPrefix(ruleHost, "*"), ".")
+		if host == ruleHost || strings.HasSuffix(host, "."+ruleHost) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,176 @@
+package downloader
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"errors"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTransport_Proxy(t *testing.T) {
+	// Прокси получает запрос с полным url и отвечает сам.
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Host != "files.example" {
+			http.Error(w, "unexpected host "+r.URL.Host, http.StatusBadGateway)
+			return
+		}
+		_, _ = w.Write([]byte("%PDF-proxied"))
+	}))
+	defer proxy.Close()
+
+	rt, err := NewTransport(TransportConfig{Proxy: proxy.URL})
+	if err != nil {
+		t.Fatalf("NewTransport: %v", err)
+	}
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+	d.SetTransport(rt)
+	if err := fetchErr(t, d, "http://files.example/a.pdf"); err != nil {
+		t.Errorf("Expected download through proxy, got %v", err)
+	}
+
+	if _, err := NewTransport(TransportConfig{Proxy: "ftp://proxy:21"}); err == nil {
+		t.Error("Expected error for ftp proxy")
+	}
+}
+
+func TestBypassProxy(t *testing.T) {
+	rules := []string{"internal.corp", ".example.org", "10.0.0.0/8", "192.168.1.5", "api.partner.com:8443"}
+	tests := []struct {
+		url    string
+		bypass bool
+	}{
+		{"http://internal.corp/a.pdf", true},
+		{"http://files.internal.corp/a.pdf", true},
+		{"http://notinternal.corp/a.pdf", false},
+		{"https://cdn.example.org/a.pdf", true},
+		{"http://10.1.2.3/a.pdf", true},
+		{"http://192.168.1.5:8080/a.pdf", true},
+		{"http://192.168.1.6/a.pdf", false},
+		{"https://api.partner.com:8443/a.pdf", true},
+		{"https://api.partner.com/a.pdf", false},
+		{"http://localhost:8080/a.pdf", true},
+		{"http://127.0.0.1/a.pdf", true},
+		{"https://example.com/a.pdf", false},
+	}
+	for _, tt := range tests {
+		u, _ := url.Parse(tt.url)
+		if got := bypassProxy(u, rules); got != tt.bypass {
+			t.Errorf("%s: expected bypass %v, got %v", tt.url, tt.bypass, got)
+		}
+	}
+	u, _ := url.Parse("https://anything.example/a.pdf")
+	if !bypassProxy(u, []string{"*"}) {
+		t.Error("Expected * to bypass everything")
+	}
+}
+
+// writeClientCert пишет самоподписанный клиентский сертификат и ключ в PEM.
+func writeClientCert(t *testing.T, dir string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tmpl := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "archiver"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+	}
+	der, err := x509.CreateCertificate(rand.Reader, tmpl, tmpl, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, _ = x509.ParseCertificate(der)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	certFile, keyFile = filepath.Join(dir, "client.pem"), filepath.Join(dir, "client-key.pem")
+	writePEM(t, certFile, "CERTIFICATE", der)
+	writePEM(t, keyFile, "EC PRIVATE KEY", keyDER)
+	return certFile, keyFile, cert
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+	if err := os.WriteFile(path, pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransport_MTLS(t *testing.T) {
+	dir := t.TempDir()
+	certFile, keyFile, clientCert := writeClientCert(t, dir)
+
+	srv := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("%PDF-secret"))
+	}))
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	srv.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs, MaxVersion: tls.VersionTLS12}
+	srv.StartTLS()
+	defer srv.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	writePEM(t, caFile, "CERTIFICATE", srv.Certificate().Raw)
+
+	download := func(c TransportConfig) error {
+		t.Helper()
+		rt, err := NewTransport(c)
+		if err != nil {
+			t.Fatalf("NewTransport: %v", err)
+		}
+		d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+		d.SetTransport(rt)
+		return fetchErr(t, d, srv.URL+"/a.pdf")
+	}
+
+	if err := download(TransportConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile}); err != nil {
+		t.Errorf("Expected download with client certificate, got %v", err)
+	}
+	if err := download(TransportConfig{CAFile: caFile}); err == nil {
+		t.Error("Expected server to reject download without client certificate")
+	}
+	if err := download(TransportConfig{CertFile: certFile, KeyFile: keyFile}); err == nil {
+		t.Error("Expected unknown server CA to be rejected")
+	}
+	// Сервер умеет максимум TLS 1.2.
+	if err := download(TransportConfig{CAFile: caFile, CertFile: certFile, KeyFile: keyFile, MinTLSVersion: "1.3"}); err == nil {
+		t.Error("Expected TLS 1.2 server to be rejected with min version 1.3")
+	}
+}
+
+func TestTransport_Misconfigured(t *testing.T) {
+	_, err := NewTransport(TransportConfig{CAFile: filepath.Join(t.TempDir(), "missing.pem")})
+	if err == nil {
+		t.Fatal("Expected error for missing CA file")
+	}
+
+	d := NewHTTPDownloader(5*time.Second, 1<<20, []string{".pdf"})
+	d.SetTransport(FailTransport(err))
+	d.SetHostPolicy(HostPolicy{FailureThreshold: 1, Cooldown: time.Minute})
+	for i := 0; i < 2; i++ {
+		_, err := d.Download(context.Background(), "https://example.com/a.pdf", filepath.Join(t.TempDir(), "001"))
+		if !errors.Is(err, errMisconfigured) || errorClass(err) != "misconfigured" {
+			t.Errorf("Expected misconfigured transport error, got %v", err)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package health
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// Check - одна проверка готовности, nil - всё хорошо.
+type Check func(ctx context.Context) error
+
+type namedCheck struct {
+	name  string
+	check Check
+}
+
+// Checker - набор проверок для /readyz.
+type Checker struct {
+	mu     sync.RWMutex
+	checks []namedCheck
+}
+
+// Конструктор чекера.
+func NewChecker() *Checker {
+	return &Checker{}
+}
+
+// Add добавляет проверку с именем name.
+func (c *Checker) Add(name string, check Check) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.checks = append(c.checks, namedCheck{name: name, check: check})
+}
+
+// Run выполняет все проверки по очереди.
+// Возвращает общий результат и результат каждой проверки ("ok" или текст ошибки).
+func (c *Checker) Run(ctx context.Context) (bool, map[string]string) {
+	c.mu.RLock()
+	checks := make([]namedCheck, len(c.checks))
+	copy(checks, c.checks)
+	c.mu.RUnlock()
+
+	ok := true
+	results := make(map[string]string, len(checks))
+	for _, nc := range checks {
+		if err := nc.check(ctx); err != nil {
+			ok = false
+			results[nc.name] = err.Error()
+			continue
+		}
+		results[nc.name] = "ok"
+	}
+	return ok, results
+}
+
+// Writable проверяет, что в dir можно создать файл.
+func Writable(dir string) Check {
+	return func(ctx context.Context) error {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+		f, err := os.CreateTemp(dir, ".readyz-*")
+		if err != nil {
+			return err
+		}
+		name := f.Name()
+		_ = f.Close()
+		return os.Remove(filepath.Clean(name))
+	}
+}
+
+// FreeSpace проверяет, что на диске с dir свободно не меньше minBytes.
+func FreeSpace(dir string, minBytes int64) Check {
+	return func(ctx context.Context) error {
+		free, err := freeSpace(dir)
+		if err != nil {
+			return err
+		}
+		if free < minBytes {
+			return fmt.Errorf("low disk space: %d bytes free, need %d", free, minBytes)
+		}
+		return nil
+	}
+}
@@ -0,0 +1,41 @@
+package health
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestChecker_Run(t *testing.T) {
+	c := NewChecker()
+	c.Add("good", func(ctx context.Context) error { return nil })
+	c.Add("bad", func(ctx context.Context) error { return errors.New("broken") })
+
+	ok, results := c.Run(context.Background())
+
+	if ok {
+		t.Error("Expected not ok when one check fails")
+	}
+	if results["good"] != "ok" {
+		t.Errorf("Expected 'ok' for good check, got '%s'", results["good"])
+	}
+	if results["bad"] != "broken" {
+		t.Errorf("Expected 'broken' for bad check, got '%s'", results["bad"])
+	}
+}
+
+func TestWritable(t *testing.T) {
+	if err := Writable(t.TempDir())(context.Background()); err != nil {
+		t.Errorf("Expected temp dir to be writable, got %v", err)
+	}
+}
+
+func TestFreeSpace(t *testing.T) {
+	dir := t.TempDir()
+	if err := FreeSpace(dir, 1)(context.Background()); err != nil {
+		t.Errorf("Expected at least 1 byte free, got %v", err)
+	}
+	if err := FreeSpace(dir, 1<<62)(context.Background()); err == nil {
+		t.Error("Expected error for unrealistic threshold")
+	}
+}
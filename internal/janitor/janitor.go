@@ -0,0 +1,208 @@
+package janitor
+
+import (
+	"io/fs"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/task"
+)
+
+// Store - то, что janitor знает о тасках.
+// Tasks - снимок текущих тасок,
+// RemoveTask - удалить таску вместе с её директорией.
+type Store interface {
+	Tasks() []*task.Task
+	RemoveTask(taskID string) error
+}
+
+// Policy - политика хранения.
+// TTL - сколько живет таска в статусе (0 - бессрочно),
+// MaxDiskUsage - бюджет на диск в байтах (0 - без ограничения),
+// Interval - как часто проверять.
+type Policy struct {
+	TTL          map[task.TaskStatus]time.Duration
+	MaxDiskUsage int64
+	Interval     time.Duration
+}
+
+// Janitor - одна горутина на весь сервис, вместо горутины на каждую таску.
+type Janitor struct {
+	root   string
+	policy Policy
+	store  Store
+	logger *slog.Logger
+
+	stop    chan struct{}
+	done    chan struct{}
+	once    sync.Once
+	started bool
+}
+
+// Конструктор janitor-а:
+// root - TmpPath, где лежат директории тасок,
+// policy - политика хранения,
+// store - источник тасок (TaskManager),
+// logger - логгер.
+func NewJanitor(root string, policy Policy, store Store, logger *slog.Logger) *Janitor {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	if policy.Interval <= 0 {
+		policy.Interval = time.Minute
+	}
+	return &Janitor{
+		root:   root,
+		policy: policy,
+		store:  store,
+		logger: logger,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+}
+
+// Start убирает осиротевшие директории и запускает периодическую уборку.
+func (j *Janitor) Start() {
+	j.SweepOrphans()
+	j.started = true
+	go j.loop()
+}
+
+// Stop останавливает уборку и ждет завершения текущего прохода.
+func (j *Janitor) Stop() {
+	j.once.Do(func() {
+		close(j.stop)
+	})
+	if j.started {
+		<-j.done
+	}
+}
+
+func (j *Janitor) loop() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.policy.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			j.Sweep(time.Now())
+		}
+	}
+}
+
+// SweepOrphans удаляет директории в root, которые не принадлежат ни одной таске.
+// Например, остались после рестарта. Трогаем только директории с именем-uuid,
+// чтобы не снести чужое, если TmpPath общий.
+func (j *Janitor) SweepOrphans() {
+	entries, err := os.ReadDir(j.root)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			j.logger.Error("failed to read tmp dir", "path", j.root, "error", err)
+		}
+		return
+	}
+
+	known := make(map[string]bool)
+	for _, t := range j.store.Tasks() {
+		known[t.TaskID] = true
+	}
+
+	for _, e := range entries {
+		if !e.IsDir() || known[e.Name()] {
+			continue
+		}
+		if _, err := uuid.Parse(e.Name()); err != nil {
+			continue
+		}
+		dir := filepath.Join(j.root, e.Name())
+		if err := os.RemoveAll(dir); err != nil {
+			j.logger.Error("failed to remove orphan directory", "path", dir, "error", err)
+			continue
+		}
+		j.logger.Info("removed orphan directory", "path", dir)
+	}
+}
+
+// candidate - таска, которую можно удалить.
+type candidate struct {
+	id         string
+	accessedAt time.Time
+	size       int64
+}
+
+// Sweep - один проход: сначала TTL, потом бюджет на диск (LRU).
+// Таски в processing не трогаем никогда.
+func (j *Janitor) Sweep(now time.Time) {
+	var finished []candidate
+	var total int64
+
+	for _, t := range j.store.Tasks() {
+		status := t.GetStatus()
+		updatedAt, accessedAt := t.GetTimes()
+
+		if ttl := j.policy.TTL[status]; ttl > 0 && status != task.StatusProcessing && now.Sub(updatedAt) > ttl {
+			j.remove(t.TaskID, "ttl expired")
+			continue
+		}
+
+		if j.policy.MaxDiskUsage <= 0 {
+			continue
+		}
+		size := dirSize(filepath.Join(j.root, t.TaskID))
+		total += size
+		if status.IsFinished() {
+			finished = append(finished, candidate{id: t.TaskID, accessedAt: accessedAt, size: size})
+		}
+	}
+
+	if j.policy.MaxDiskUsage <= 0 || total <= j.policy.MaxDiskUsage {
+		return
+	}
+
+	// Дольше всех не трогали - удаляем первыми.
+	sort.Slice(finished, func(a, b int) bool {
+		return finished[a].accessedAt.Before(finished[b].accessedAt)
+	})
+	for _, c := range finished {
+		if total <= j.policy.MaxDiskUsage {
+			break
+		}
+		j.remove(c.id, "disk budget exceeded")
+		total -= c.size
+	}
+}
+
+func (j *Janitor) remove(taskID, reason string) {
+	if err := j.store.RemoveTask(taskID); err != nil {
+		j.logger.Error("failed to remove task", "task_id", taskID, "error", err)
+		return
+	}
+	j.logger.Info("removed task", "task_id", taskID, "reason", reason)
+}
+
+// dirSize - размер директории, ошибки игнорируются (директории может и не быть).
+func dirSize(dir string) int64 {
+	var size int64
+	_ = filepath.WalkDir(dir, func(_ string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if !d.IsDir() {
+			if info, err := d.Info(); err == nil {
+				size += info.Size()
+			}
+		}
+		return nil
+	})
+	return size
+}
@@ -0,0 +1,136 @@
+package janitor
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/task"
+)
+
+// Простая реализация Store для тестов.
+type fakeStore struct {
+	root  string
+	tasks map[string]*task.Task
+}
+
+func (s *fakeStore) Tasks() []*task.Task {
+	tasks := make([]*task.Task, 0, len(s.tasks))
+	for _, t := range s.tasks {
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
+
+func (s *fakeStore) RemoveTask(taskID string) error {
+	delete(s.tasks, taskID)
+	return os.RemoveAll(filepath.Join(s.root, taskID))
+}
+
+func newStoreTask(t *testing.T, s *fakeStore, status task.TaskStatus, size int, age time.Duration) *task.Task {
+	t.Helper()
+	tk := task.NewTask(uuid.New().String(), nil, 3)
+	tk.Status = status
+	tk.UpdatedAt = time.Now().Add(-age)
+	tk.AccessedAt = time.Now().Add(-age)
+	s.tasks[tk.TaskID] = tk
+
+	dir := filepath.Join(s.root, tk.TaskID)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatalf("Failed to create dir: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "archive.zip"), make([]byte, size), 0644); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+	return tk
+}
+
+func TestSweep_TTL(t *testing.T) {
+	root := t.TempDir()
+	store := &fakeStore{root: root, tasks: make(map[string]*task.Task)}
+
+	expired := newStoreTask(t, store, task.StatusCompleted, 10, 2*time.Hour)
+	fresh := newStoreTask(t, store, task.StatusCompleted, 10, time.Minute)
+	processing := newStoreTask(t, store, task.StatusProcessing, 10, 2*time.Hour)
+
+	j := NewJanitor(root, Policy{
+		TTL: map[task.TaskStatus]time.Duration{
+			task.StatusCompleted:  time.Hour,
+			task.StatusProcessing: time.Hour, // Должно игнорироваться.
+		},
+	}, store, nil)
+	j.Sweep(time.Now())
+
+	if _, ok := store.tasks[expired.TaskID]; ok {
+		t.Error("Expected expired task to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(root, expired.TaskID)); !os.IsNotExist(err) {
+		t.Error("Expected expired task directory to be removed")
+	}
+	if _, ok := store.tasks[fresh.TaskID]; !ok {
+		t.Error("Expected fresh task to be kept")
+	}
+	if _, ok := store.tasks[processing.TaskID]; !ok {
+		t.Error("Expected processing task to be kept")
+	}
+}
+
+func TestSweep_DiskBudgetLRU(t *testing.T) {
+	root := t.TempDir()
+	store := &fakeStore{root: root, tasks: make(map[string]*task.Task)}
+
+	oldest := newStoreTask(t, store, task.StatusCompleted, 100, 3*time.Minute)
+	middle := newStoreTask(t, store, task.StatusFailed, 100, 2*time.Minute)
+	newest := newStoreTask(t, store, task.StatusCompleted, 100, time.Minute)
+
+	j := NewJanitor(root, Policy{MaxDiskUsage: 250}, store, nil)
+	j.Sweep(time.Now())
+
+	if _, ok := store.tasks[oldest.TaskID]; ok {
+		t.Error("Expected least recently used task to be evicted")
+	}
+	if _, ok := store.tasks[middle.TaskID]; !ok {
+		t.Error("Expected middle task to be kept")
+	}
+	if _, ok := store.tasks[newest.TaskID]; !ok {
+		t.Error("Expected newest task to be kept")
+	}
+}
+
+func TestSweepOrphans(t *testing.T) {
+	root := t.TempDir()
+	store := &fakeStore{root: root, tasks: make(map[string]*task.Task)}
+
+	known := newStoreTask(t, store, task.StatusCompleted, 10, time.Minute)
+	orphan := filepath.Join(root, uuid.New().String())
+	foreign := filepath.Join(root, "not-a-task")
+	for _, dir := range []string{orphan, foreign} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatalf("Failed to create dir: %v", err)
+		}
+	}
+
+	NewJanitor(root, Policy{}, store, nil).SweepOrphans()
+
+	if _, err := os.Stat(orphan); !os.IsNotExist(err) {
+		t.Error("Expected orphan directory to be removed")
+	}
+	if _, err := os.Stat(foreign); err != nil {
+		t.Error("Expected non-uuid directory to be kept")
+	}
+	if _, err := os.Stat(filepath.Join(root, known.TaskID)); err != nil {
+		t.Error("Expected known task directory to be kept")
+	}
+}
+
+func TestStartStop(t *testing.T) {
+	store := &fakeStore{root: t.TempDir(), tasks: make(map[string]*task.Task)}
+	j := NewJanitor(store.root, Policy{Interval: time.Millisecond}, store, nil)
+	j.Start()
+	time.Sleep(5 * time.Millisecond)
+	j.Stop()
+	j.Stop() // Повторный Stop не должен паниковать.
+}
@@ -0,0 +1,108 @@
+package logging
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"strings"
+)
+
+// New создает логгер:
+// level - debug, info, warn, error,
+// format - text или json,
+// w - куда писать.
+func New(level, format string, w io.Writer) (*slog.Logger, error) {
+	lvl, err := ParseLevel(level)
+	if err != nil {
+		return nil, err
+	}
+	opts := &slog.HandlerOptions{Level: lvl}
+
+	switch strings.ToLower(format) {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("unknown log format %q", format)
+}
+
+// ParseLevel переводит строку из конфига в slog.Level.
+func ParseLevel(level string) (slog.Level, error) {
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(level)); err != nil {
+		return slog.LevelInfo, fmt.Errorf("unknown log level %q", level)
+	}
+	return lvl, nil
+}
+
+type ctxKey struct{}
+
+// WithLogger кладет логгер в контекст.
+// Так атрибуты (request_id, task_id, url) едут вместе с контекстом
+// через TaskManager в загрузчик и архиватор.
+func WithLogger(ctx context.Context, logger *slog.Logger) context.Context {
+	return context.WithValue(ctx, ctxKey{}, logger)
+}
+
+// FromContext достает логгер из контекста, если его нет - slog.Default().
+func FromContext(ctx context.Context) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return slog.Default()
+}
+
+// With добавляет атрибуты к логгеру из контекста и возвращает новый контекст.
+func With(ctx context.Context, args ...any) context.Context {
+	return WithLogger(ctx, FromContext(ctx).With(args...))
+}
+
+// FromContextOr - как FromContext, но если в контексте логгера нет, возвращает fallback.
+func FromContextOr(ctx context.Context, fallback *slog.Logger) *slog.Logger {
+	if ctx != nil {
+		if logger, ok := ctx.Value(ctxKey{}).(*slog.Logger); ok {
+			return logger
+		}
+	}
+	return fallback
+}
+
+// RedactURL - url для логов и трейсов: пароль из user:pass@ заменен, как в
+// (*url.URL).Redacted. Одно имя без пароля тоже прячем, в нем часто токен.
+// Кривой url, который не разобрался, все равно чистим: до последней @ в хосте.
+func RedactURL(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return redactAuthority(rawURL)
+	}
+	if u.User == nil {
+		return rawURL
+	}
+	if _, ok := u.User.Password(); !ok {
+		u.User = url.User("xxxxx")
+	}
+	return u.Redacted()
+}
+
+// redactAuthority заменяет все до последней @ в authority ("//...") на xxxxx.
+func redactAuthority(rawURL string) string {
+	start := strings.Index(rawURL, "//")
+	if start < 0 {
+		return rawURL
+	}
+	start += 2
+	end := len(rawURL)
+	if i := strings.IndexAny(rawURL[start:], "/?#"); i >= 0 {
+		end = start + i
+	}
+	at := strings.LastIndex(rawURL[start:end], "@")
+	if at < 0 {
+		return rawURL
+	}
+	return rawURL[:start] + "xxxxx" + rawURL[start+at:]
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"strings"
+	"sync/atomic"
+)
+
+// OtherHost - лейбл host для хостов не из SetHosts.
+const OtherHost = "other"
+
+// hostRules - хосты, которые попадают в лейбл host, см. SetHosts.
+var hostRules atomic.Pointer[[]string]
+
+// SetHosts задает, какие хосты видны в лейбле host. Url присылают клиенты,
+// и с хостом как есть любой вызывающий API раздул бы реестр новыми сериями.
+// example.com подходит и для поддоменов, лейбл - само правило;
+// остальные хосты идут в OtherHost.
+func SetHosts(rules []string) {
+	clean := make([]string, 0, len(rules))
+	for _, r := range rules {
+		r = strings.TrimPrefix(strings.ToLower(strings.TrimSpace(r)), ".")
+		if r != "" {
+			clean = append(clean, r)
+		}
+	}
+	hostRules.Store(&clean)
+}
+
+// Host - значение лейбла host для хоста, всегда из ограниченного набора.
+func Host(host string) string {
+	rules := hostRules.Load()
+	if rules == nil {
+		return OtherHost
+	}
+	host = strings.ToLower(host)
+	for _, r := range *rules {
+		if host == r || strings.HasSuffix(host, "."+r) {
+			return r
+		}
+	}
+	return OtherHost
+}
@@ -0,0 +1,25 @@
+package metrics
+
+import "testing"
+
+func TestHost(t *testing.T) {
+	t.Cleanup(func() { SetHosts(nil) })
+	if got := Host("example.com"); got != OtherHost {
+		t.Errorf("Expected %s without rules, got %s", OtherHost, got)
+	}
+
+	SetHosts([]string{" Example.com", ".cdn.partner.org", ""})
+	tests := []struct{ host, want string }{
+		{"example.com", "example.com"},
+		{"files.EXAMPLE.com", "example.com"},
+		{"notexample.com", OtherHost},
+		{"a.cdn.partner.org", "cdn.partner.org"},
+		{"partner.org", OtherHost},
+		{"invalid", OtherHost},
+	}
+	for _, tt := range tests {
+		if got := Host(tt.host); got != tt.want {
+			t.Errorf("%s: expected %s, got %s", tt.host, tt.want, got)
+		}
+	}
+}
@@ -0,0 +1,36 @@
+package metrics
+
+// Default - реестр сервиса, отдается на /metrics.
+var Default = NewRegistry()
+
+// Метрики сервиса. Объявлены здесь, чтобы все имена были в одном месте.
+var (
+	TasksCreated = Default.NewCounter("archiver_tasks_created_total",
+		"Tasks created.")
+	TasksCompleted = Default.NewCounter("archiver_tasks_completed_total",
+		"Tasks completed with an archive.")
+	TasksFailed = Default.NewCounter("archiver_tasks_failed_total",
+		"Tasks failed without an archive.")
+	TasksCancelled = Default.NewCounter("archiver_tasks_cancelled_total",
+		"Tasks cancelled by the client.")
+	TasksRejectedBusy = Default.NewCounter("archiver_tasks_rejected_busy_total",
+		"Task creations rejected because all slots were taken.")
+
+	DownloadDuration = Default.NewHistogramVec("archiver_download_duration_seconds",
+		"Time spent downloading a single file.", []float64{.1, .25, .5, 1, 2.5, 5, 10, 30, 60}, "host")
+	DownloadBytes = Default.NewCounterVec("archiver_download_bytes_total",
+		"Bytes downloaded.", "host")
+	DownloadErrors = Default.NewCounterVec("archiver_download_errors_total",
+		"Failed downloads by error class.", "class")
+	DownloadCacheHits = Default.NewCounterVec("archiver_download_cache_hits_total",
+		"Downloads served from the local cache after a 304 Not Modified.", "host")
+	DownloadWait = Default.NewHistogram("archiver_download_wait_seconds",
+		"Time a download waited for its turn at the host and a free connection slot.", DefBuckets)
+	DownloadCircuitOpened = Default.NewCounterVec("archiver_download_circuit_opened_total",
+		"Times downloads from a host were paused after consecutive failures.", "host")
+
+	ArchiveDuration = Default.NewHistogram("archiver_archive_build_duration_seconds",
+		"Time spent building a zip archive.", DefBuckets)
+	ArchiveSize = Default.NewHistogram("archiver_archive_size_bytes",
+		"Size of built zip archives.", SizeBuckets)
+)
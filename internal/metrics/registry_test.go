@@ -0,0 +1,54 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistry_WriteTo(t *testing.T) {
+	r := NewRegistry()
+	c := r.NewCounterVec("test_total", "Test counter.", "host")
+	c.With("a.com").Inc()
+	c.With(`b"c`).Add(2)
+	h := r.NewHistogram("test_seconds", "Test histogram.", []float64{1, 0.5})
+	h.Observe(0.3)
+	h.Observe(0.7)
+	h.Observe(5)
+	r.NewGaugeFunc("test_gauge", "Test gauge.", func() float64 { return 42 })
+
+	var sb strings.Builder
+	if _, err := r.WriteTo(&sb); err != nil {
+		t.Fatalf("WriteTo failed: %v", err)
+	}
+	out := sb.String()
+
+	expected := []string{
+		"# TYPE test_total counter",
+		`test_total{host="a.com"} 1`,
+		`test_total{host="b\"c"} 2`,
+		"# TYPE test_seconds histogram",
+		`test_seconds_bucket{le="0.5"} 1`,
+		`test_seconds_bucket{le="1"} 2`,
+		`test_seconds_bucket{le="+Inf"} 3`,
+		"test_seconds_sum 6",
+		"test_seconds_count 3",
+		"# TYPE test_gauge gauge",
+		"test_gauge 42",
+	}
+	for _, line := range expected {
+		if !strings.Contains(out, line+"\n") {
+			t.Errorf("Expected line %q in output:\n%s", line, out)
+		}
+	}
+}
+
+func TestRegistry_DuplicatePanics(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("dup_total", "")
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected panic on duplicate metric")
+		}
+	}()
+	r.NewCounter("dup_total", "")
+}
@@ -0,0 +1,168 @@
+package naming
+
+import (
+	"fmt"
+	"path"
+	"strings"
+	"unicode/utf8"
+)
+
+// Что делать, если два файла хотят лечь в архив под одним именем.
+// Первый всегда остается как есть, меняются следующие.
+const (
+	CollisionSuffix = "suffix" // image.jpg, image-2.jpg, image-3.jpg.
+	CollisionHost   = "host"   // image.jpg, cdn.example.com-image.jpg.
+	CollisionHash   = "hash"   // image.jpg, image-1a2b3c4d.jpg.
+)
+
+// DefaultCollision - стратегия по умолчанию.
+const DefaultCollision = CollisionSuffix
+
+// hashLen - сколько знаков хеша дописывается при CollisionHash.
+const hashLen = 8
+
+// ParseCollision проверяет стратегию, пустая - DefaultCollision.
+func ParseCollision(s string) (string, error) {
+	switch s {
+	case "":
+		return DefaultCollision, nil
+	case CollisionSuffix, CollisionHost, CollisionHash:
+		return s, nil
+	default:
+		return "", fmt.Errorf("unknown collision strategy %q, want %s, %s or %s",
+			s, CollisionSuffix, CollisionHost, CollisionHash)
+	}
+}
+
+// Dedup раздает уникальные имена в одном архиве.
+// Имена сравниваются без учета регистра: на Windows и macOS
+// "Scan.pdf" и "scan.pdf" при распаковке перезапишут друг друга.
+// Файл с именем уже существующей папки ("docs" и "docs/a.pdf") тоже коллизия,
+// в любом порядке: если "docs" уже файл, папка docs/ становится docs-2/
+// для всех следующих файлов из нее.
+//
+// Результат зависит только от порядка вызовов, так что при одном
+// и том же наборе файлов имена всегда одни и те же.
+type Dedup struct {
+	strategy string
+	files    map[string]bool
+	dirs     map[string]bool
+	moved    map[string]string // Папка, чье имя занял файл -> куда она переехала.
+}
+
+// Конструктор Dedup:
+// strategy - CollisionSuffix, CollisionHost или CollisionHash (пустая - по умолчанию).
+func NewDedup(strategy string) *Dedup {
+	if strategy == "" {
+		strategy = DefaultCollision
+	}
+	return &Dedup{strategy: strategy, files: make(map[string]bool), dirs: make(map[string]bool), moved: make(map[string]string)}
+}
+
+// Name возвращает свободное имя для name (путь в архиве) и занимает его.
+// Из v нужны Host для CollisionHost и Hash для CollisionHash,
+// если их нет - сразу суффикс.
+func (d *Dedup) Name(name string, v Vars) string {
+	name = d.moveDirs(name)
+	if d.free(name) {
+		return d.take(name)
+	}
+
+	dir, file := path.Split(name)
+	stem, ext := SplitExt(file)
+	switch {
+	case d.strategy == CollisionHost && v.Host != "":
+		if c := dir + CleanName(v.Host+"-"+file); d.free(c) {
+			return d.take(c)
+		}
+		stem = v.Host + "-" + stem
+	case d.strategy == CollisionHash && v.Hash != "":
+		h := v.Hash[:min(hashLen, len(v.Hash))]
+		if c := dir + CleanName(fitStem(stem, ext, len(h)+1)+"-"+h+ext); d.free(c) {
+			return d.take(c)
+		}
+		stem += "-" + h
+	}
+
+	// Запасной вариант для всех стратегий, у него коллизий не бывает.
+	for n := 2; ; n++ {
+		suffix := fmt.Sprintf("-%d", n)
+		if c := dir + CleanName(fitStem(stem, ext, len(suffix))+suffix+ext); d.free(c) {
+			return d.take(c)
+		}
+	}
+}
+
+// free - имя не занято ни файлом, ни папкой, и ни одна папка над ним не занята файлом.
+func (d *Dedup) free(name string) bool {
+	key := strings.ToLower(name)
+	if d.files[key] || d.dirs[key] {
+		return false
+	}
+	for dir := path.Dir(key); dir != "."; dir = path.Dir(dir) {
+		if d.files[dir] {
+			return false
+		}
+	}
+	return true
+}
+
+// moveDirs уводит name из папок, чье имя уже занято файлом: "docs" - файл,
+// значит "docs/a.pdf" станет "docs-2/a.pdf". Переезд запоминается,
+// так что вся папка оказывается в одном месте.
+func (d *Dedup) moveDirs(name string) string {
+	dir, file := path.Split(name)
+	if dir == "" {
+		return name
+	}
+	var orig, resolved string
+	for _, seg := range strings.Split(strings.TrimSuffix(dir, "/"), "/") {
+		orig = path.Join(orig, seg)
+		key := strings.ToLower(orig)
+		if to, ok := d.moved[key]; ok {
+			resolved = to
+			continue
+		}
+		next := path.Join(resolved, seg)
+		if d.files[strings.ToLower(next)] {
+			for n := 2; ; n++ {
+				suffix := fmt.Sprintf("-%d", n)
+				c := path.Join(resolved, CleanName(fitStem(seg, "", len(suffix))+suffix))
+				if lc := strings.ToLower(c); !d.files[lc] && !d.dirs[lc] {
+					next = c
+					break
+				}
+			}
+			d.moved[key] = next
+		}
+		resolved = next
+	}
+	return resolved + "/" + file
+}
+
+// take занимает имя и все папки над ним.
+func (d *Dedup) take(name string) string {
+	key := strings.ToLower(name)
+	d.files[key] = true
+	for dir := path.Dir(key); dir != "."; dir = path.Dir(dir) {
+		d.dirs[dir] = true
+	}
+	return name
+}
+
+// fitStem укорачивает stem, чтобы после добавки extra байт имя
+// влезло в maxSegment: иначе CleanName отрезал бы как раз добавку.
+func fitStem(stem, ext string, extra int) string {
+	limit := maxSegment - len(ext) - extra
+	if limit < 1 {
+		limit = 1
+	}
+	if len(stem) <= limit {
+		return stem
+	}
+	stem = stem[:limit]
+	for !utf8.ValidString(stem) {
+		stem = stem[:len(stem)-1]
+	}
+	return stem
+}
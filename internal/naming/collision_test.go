@@ -0,0 +1,91 @@
+package naming
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDedup(t *testing.T) {
+	type file struct {
+		name string
+		host string
+	}
+	files := []file{
+		{"image.jpg", "a.example.com"},
+		{"image.jpg", "b.example.com"},
+		{"Image.JPG", "c.example.com"},
+		{"docs/a.pdf", "a.example.com"},
+		{"docs", "a.example.com"},
+		{"image-2.jpg", "a.example.com"},
+	}
+	hash := "1a2b3c4d5e6f"
+	tests := []struct {
+		strategy string
+		want     []string
+	}{
+		{CollisionSuffix, []string{"image.jpg", "image-2.jpg", "Image-3.JPG", "docs/a.pdf", "docs-2", "image-2-2.jpg"}},
+		{CollisionHost, []string{"image.jpg", "b.example.com-image.jpg", "c.example.com-Image.JPG", "docs/a.pdf", "a.example.com-docs", "image-2.jpg"}},
+		{CollisionHash, []string{"image.jpg", "image-1a2b3c4d.jpg", "Image-1a2b3c4d-2.JPG", "docs/a.pdf", "docs-1a2b3c4d", "image-2.jpg"}},
+	}
+	for _, tt := range tests {
+		d := NewDedup(tt.strategy)
+		var got []string
+		for _, f := range files {
+			got = append(got, d.Name(f.name, Vars{Host: f.host, Hash: hash}))
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("%s: expected %v, got %v", tt.strategy, tt.want, got)
+		}
+	}
+}
+
+func TestDedup_FileThenDir(t *testing.T) {
+	d := NewDedup(CollisionSuffix)
+	var got []string
+	for _, name := range []string{"docs", "docs/a.pdf", "Docs/b.pdf", "docs-2", "docs/sub/c.pdf", "x/docs", "x/docs/d.pdf", "docs"} {
+		got = append(got, d.Name(name, Vars{}))
+	}
+	// Файл docs уже есть: папка docs/ переезжает целиком, и в архиве
+	// нет файла и папки с одним именем.
+	want := []string{"docs", "docs-2/a.pdf", "docs-2/b.pdf", "docs-2-2", "docs-2/sub/c.pdf", "x/docs", "x/docs-2/d.pdf", "docs-3"}
+	if strings.Join(got, " ") != strings.Join(want, " ") {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+}
+
+func TestDedup_Deterministic(t *testing.T) {
+	names := func() []string {
+		d := NewDedup("")
+		var out []string
+		for i := 0; i < 5; i++ {
+			out = append(out, d.Name("a/image.jpg", Vars{}))
+		}
+		return out
+	}
+	first, second := names(), names()
+	if strings.Join(first, " ") != strings.Join(second, " ") {
+		t.Errorf("Expected same names on every run, got %v and %v", first, second)
+	}
+	if first[4] != "a/image-5.jpg" {
+		t.Errorf("Expected a/image-5.jpg, got %q", first[4])
+	}
+}
+
+func TestDedup_LongName(t *testing.T) {
+	d := NewDedup(CollisionSuffix)
+	long := strings.Repeat("x", 300) + ".jpg"
+	first := d.Name(CleanName(long), Vars{})
+	second := d.Name(CleanName(long), Vars{})
+	if first == second || len(second) > maxSegment || !strings.HasSuffix(second, "-2.jpg") {
+		t.Errorf("Expected distinct names within %d bytes, got %q and %q", maxSegment, first, second)
+	}
+}
+
+func TestParseCollision(t *testing.T) {
+	if s, err := ParseCollision(""); err != nil || s != DefaultCollision {
+		t.Errorf("Expected default strategy, got %q %v", s, err)
+	}
+	if _, err := ParseCollision("overwrite"); err == nil {
+		t.Error("Expected error for unknown strategy")
+	}
+}
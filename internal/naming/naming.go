@@ -0,0 +1,248 @@
+// Package naming - имена файлов внутри архива: шаблоны и чистка путей.
+//
+// Всё, что приходит от клиента или с чужого сервера (путь, имя из url),
+// проходит через CleanPath/CleanName, поэтому в архив не попадут
+// "../../etc/passwd", абсолютные пути и символы, которые не любит Windows.
+package naming
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// DefaultTemplate - имя как в url, так было всегда.
+const DefaultTemplate = "{name}"
+
+// Лимит на длину одного сегмента пути, больше не разрешает большинство ФС.
+const maxSegment = 255
+
+// ErrInvalidPath - путь нельзя положить в архив.
+var ErrInvalidPath = errors.New("invalid path")
+
+// ErrInvalidTemplate - кривой шаблон имени.
+var ErrInvalidTemplate = errors.New("invalid name template")
+
+// Vars - из чего собирается имя.
+type Vars struct {
+	Index int    // Номер url в таске, с 1.
+	Host  string // Хост url.
+	Name  string // Имя файла из url, с расширением.
+	Hash  string // sha256 содержимого, hex.
+}
+
+// Template - шаблон имени, например "{index:2}-{host}-{name}".
+//
+// Подстановки:
+//
+//	{index}    номер url с 1, {index:3} - с ведущими нулями до 3 знаков
+//	{host}     хост url
+//	{name}     имя файла из url
+//	{stem}     имя без расширения
+//	{ext}      расширение с точкой
+//	{hash}     первые 12 знаков sha256 содержимого, {hash:N} - первые N
+type Template struct {
+	raw   string
+	parts []part
+}
+
+type part struct {
+	text  string // Просто текст, если name пустое.
+	name  string
+	width int
+}
+
+// ParseTemplate разбирает шаблон. Пустой - DefaultTemplate.
+func ParseTemplate(s string) (*Template, error) {
+	if s == "" {
+		s = DefaultTemplate
+	}
+	t := &Template{raw: s}
+	rest := s
+	for rest != "" {
+		open := strings.IndexByte(rest, '{')
+		if open < 0 {
+			t.parts = append(t.parts, part{text: rest})
+			break
+		}
+		if open > 0 {
+			t.parts = append(t.parts, part{text: rest[:open]})
+		}
+		end := strings.IndexByte(rest[open:], '}')
+		if end < 0 {
+			return nil, fmt.Errorf("%w: unclosed { in %q", ErrInvalidTemplate, s)
+		}
+		p, err := parsePlaceholder(rest[open+1 : open+end])
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidTemplate, err)
+		}
+		t.parts = append(t.parts, p)
+		rest = rest[open+end+1:]
+	}
+	if strings.Contains(s, "/") || strings.Contains(s, `\`) {
+		return nil, fmt.Errorf("%w: use per-url paths for folders, not / in the template", ErrInvalidTemplate)
+	}
+	return t, nil
+}
+
+func parsePlaceholder(s string) (part, error) {
+	name, arg, hasArg := strings.Cut(s, ":")
+	p := part{name: name}
+	switch name {
+	case "index", "hash":
+	case "host", "name", "stem", "ext":
+		if hasArg {
+			return p, fmt.Errorf("{%s} takes no width", name)
+		}
+	default:
+		return p, fmt.Errorf("unknown placeholder {%s}", name)
+	}
+	if hasArg {
+		w, err := strconv.Atoi(arg)
+		if err != nil || w < 1 || w > 64 {
+			return p, fmt.Errorf("bad width in {%s}", s)
+		}
+		p.width = w
+	}
+	return p, nil
+}
+
+// String - исходный шаблон.
+func (t *Template) String() string {
+	return t.raw
+}
+
+// Execute собирает имя файла (один сегмент, уже почищенный).
+func (t *Template) Execute(v Vars) string {
+	stem, ext := SplitExt(v.Name)
+	var b strings.Builder
+	for _, p := range t.parts {
+		switch p.name {
+		case "":
+			b.WriteString(p.text)
+		case "index":
+			s := strconv.Itoa(v.Index)
+			if pad := p.width - len(s); pad > 0 {
+				s = strings.Repeat("0", pad) + s
+			}
+			b.WriteString(s)
+		case "host":
+			b.WriteString(v.Host)
+		case "name":
+			b.WriteString(v.Name)
+		case "stem":
+			b.WriteString(stem)
+		case "ext":
+			b.WriteString(ext)
+		case "hash":
+			n := p.width
+			if n == 0 {
+				n = 12
+			}
+			b.WriteString(v.Hash[:min(n, len(v.Hash))])
+		}
+	}
+	return CleanName(b.String())
+}
+
+// FromURL - хост и имя файла из url: последний сегмент пути, без query,
+// %XX раскодированы. Если имени нет (https://example.com/) - "file".
+func FromURL(rawURL string) (host, name string) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return "", "file"
+	}
+	name = path.Base(u.Path)
+	if name == "/" || name == "." {
+		name = ""
+	}
+	return CleanName(u.Hostname()), CleanName(name)
+}
+
+// SplitExt: "scan.tar.gz" -> "scan.tar", ".gz"; у ".env" расширения нет.
+func SplitExt(name string) (stem, ext string) {
+	ext = path.Ext(name)
+	if ext == name {
+		return name, ""
+	}
+	return strings.TrimSuffix(name, ext), ext
+}
+
+// CleanPath проверяет путь внутри архива от клиента и приводит его в порядок:
+// разделитель "/", без пустых сегментов и ".", сегменты через CleanName.
+// ".." и абсолютные пути - ErrInvalidPath, а не тихая чистка:
+// клиент явно хотел чего-то странного.
+// Путь, который кончается на "/", - это папка, "/" остается.
+func CleanPath(p string) (string, error) {
+	p = strings.ReplaceAll(p, `\`, "/")
+	if strings.HasPrefix(p, "/") || (len(p) >= 2 && p[1] == ':') {
+		return "", fmt.Errorf("%w: %q is absolute", ErrInvalidPath, p)
+	}
+	dir := strings.HasSuffix(p, "/")
+
+	var segments []string
+	for _, s := range strings.Split(p, "/") {
+		switch s {
+		case "", ".":
+			continue
+		case "..":
+			return "", fmt.Errorf("%w: %q leaves the archive", ErrInvalidPath, p)
+		}
+		segments = append(segments, CleanName(s))
+	}
+	if len(segments) == 0 {
+		return "", fmt.Errorf("%w: %q is empty", ErrInvalidPath, p)
+	}
+	clean := strings.Join(segments, "/")
+	if dir {
+		clean += "/"
+	}
+	return clean, nil
+}
+
+// CleanName делает из строки безопасное имя одного файла:
+// управляющие символы, / \ : * ? " < > | заменяются на "_",
+// точки и пробелы по краям убираются, зарезервированные в Windows
+// имена (CON, NUL, COM1...) получают "_" в начале, длина режется до 255 байт.
+// Пустое имя - "file".
+func CleanName(s string) string {
+	s = strings.Map(func(r rune) rune {
+		if r == utf8.RuneError || unicode.IsControl(r) || strings.ContainsRune(`/\:*?"<>|`, r) {
+			return '_'
+		}
+		return r
+	}, s)
+	s = strings.Trim(s, ". ")
+	if s == "" {
+		return "file"
+	}
+	if stem, _ := SplitExt(s); isReserved(stem) {
+		s = "_" + s
+	}
+	if len(s) > maxSegment {
+		stem, ext := SplitExt(s)
+		if len(ext) > 16 {
+			stem, ext = s, ""
+		}
+		stem = stem[:maxSegment-len(ext)]
+		for !utf8.ValidString(stem) { // Не резать посреди символа.
+			stem = stem[:len(stem)-1]
+		}
+		s = stem + ext
+	}
+	return s
+}
+
+func isReserved(stem string) bool {
+	switch strings.ToUpper(stem) {
+	case "CON", "PRN", "AUX", "NUL":
+		return true
+	}
+	up := strings.ToUpper(stem)
+	return len(up) == 4 && (strings.HasPrefix(up, "COM") || strings.HasPrefix(up, "LPT")) && up[3] >= '1' && up[3] <= '9'
+}
@@ -0,0 +1,118 @@
+package naming
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestTemplate(t *testing.T) {
+	v := Vars{Index: 7, Host: "example.com", Name: "scan.pdf", Hash: "0123456789abcdef"}
+	tests := []struct {
+		tmpl string
+		want string
+	}{
+		{"", "scan.pdf"},
+		{"{index:2}-{name}", "07-scan.pdf"},
+		{"{index}_{host}_{stem}{ext}", "7_example.com_scan.pdf"},
+		{"{stem}-{hash}{ext}", "scan-0123456789ab.pdf"},
+		{"{hash:4}{ext}", "0123.pdf"},
+		{"report", "report"},
+		{"{stem}: {index}?", "scan_ 7_"},
+	}
+	for _, tt := range tests {
+		tmpl, err := ParseTemplate(tt.tmpl)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.tmpl, err)
+			continue
+		}
+		if got := tmpl.Execute(v); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.tmpl, tt.want, got)
+		}
+	}
+}
+
+func TestParseTemplate_Invalid(t *testing.T) {
+	for _, s := range []string{"{nope}", "{index", "{index:0}", "{host:3}", "dir/{name}", `dir\{name}`} {
+		if _, err := ParseTemplate(s); !errors.Is(err, ErrInvalidTemplate) {
+			t.Errorf("%q: expected ErrInvalidTemplate, got %v", s, err)
+		}
+	}
+}
+
+func TestCleanPath(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"invoice-2026-10/01-scan.pdf", "invoice-2026-10/01-scan.pdf"},
+		{"a//./b.pdf", "a/b.pdf"},
+		{`a\b.pdf`, "a/b.pdf"},
+		{"docs/", "docs/"},
+		{"a/b?.pdf", "a/b_.pdf"},
+		{"con/aux.txt", "_con/_aux.txt"},
+	}
+	for _, tt := range tests {
+		got, err := CleanPath(tt.in)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", tt.in, err)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.in, tt.want, got)
+		}
+	}
+}
+
+func TestCleanPath_ZipSlip(t *testing.T) {
+	for _, p := range []string{"../etc/passwd", "a/../../b", `..\b`, "/etc/passwd", `C:\x.pdf`, "", "./"} {
+		if got, err := CleanPath(p); !errors.Is(err, ErrInvalidPath) {
+			t.Errorf("%q: expected ErrInvalidPath, got %q, %v", p, got, err)
+		}
+	}
+}
+
+func TestCleanName(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"scan.pdf", "scan.pdf"},
+		{"download?id=77", "download_id=77"},
+		{"a:b*c\"d<e>f|g", "a_b_c_d_e_f_g"},
+		{" .hidden. ", "hidden"},
+		{"NUL.txt", "_NUL.txt"},
+		{"line\nbreak", "line_break"},
+		{"", "file"},
+		{"..", "file"},
+	}
+	for _, tt := range tests {
+		if got := CleanName(tt.in); got != tt.want {
+			t.Errorf("%q: expected %q, got %q", tt.in, tt.want, got)
+		}
+	}
+
+	long := CleanName(strings.Repeat("я", 200) + ".pdf")
+	if len(long) > maxSegment || !strings.HasSuffix(long, ".pdf") {
+		t.Errorf("Expected name cut to %d bytes with .pdf kept, got %d bytes", maxSegment, len(long))
+	}
+}
+
+func TestFromURL(t *testing.T) {
+	tests := []struct {
+		url  string
+		host string
+		name string
+	}{
+		{"https://example.com/files/scan.pdf?x=1", "example.com", "scan.pdf"},
+		{"https://example.com:8080/a%20b.pdf", "example.com", "a b.pdf"},
+		{"https://example.com/", "example.com", "file"},
+		{"https://example.com/..%2F..%2Fetc%2Fpasswd", "example.com", "passwd"},
+	}
+	for _, tt := range tests {
+		host, name := FromURL(tt.url)
+		if host != tt.host || name != tt.name {
+			t.Errorf("%s: expected %q %q, got %q %q", tt.url, tt.host, tt.name, host, name)
+		}
+	}
+}
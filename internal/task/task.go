@@ -1,8 +1,13 @@
 package task
 
 import (
+	"errors"
 	"fmt"
+	"maps"
+	"net/http"
+	"slices"
 	"sync"
+	"time"
 )
 
 type TaskStatus string
@@ -13,6 +18,7 @@ const (
 	StatusProcessing TaskStatus = "processing"
 	StatusCompleted  TaskStatus = "completed"
 	StatusFailed     TaskStatus = "failed"
+	StatusCancelled  TaskStatus = "cancelled"
 )
 
 // Ошибки
@@ -23,13 +29,52 @@ type FileError struct {
 	Error string `json:"error"`
 }
 
+// FileEntry - под каким именем файл лег в архив.
+type FileEntry struct {
+	URL         string `json:"url"`
+	Name        string `json:"name"`
+	RenamedFrom string `json:"renamed_from,omitempty"` // Имя до разрешения коллизии.
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+}
+
+// ErrTooManyURLs - в таске уже MaxFiles url.
+var ErrTooManyURLs = errors.New("too many urls")
+
 type Task struct {
 	TaskID   string      `json:"task_id"`
 	URLs     []string    `json:"urls"`
 	MaxFiles int         `json:"-"` // Не должно быть в json-е
 	Status   TaskStatus  `json:"status"`
 	Errors   []FileError `json:"errors"`
-	Mu       sync.RWMutex
+	// Почему таска failed целиком, если дело не в конкретном url (остановка сервиса).
+	FailureReason string `json:"failure_reason,omitempty"`
+	// Кто создал таску, задается клиентом, нужен для поиска.
+	Owner string `json:"owner,omitempty"`
+	// Как назвать архив и файлы в нем, задается при создании.
+	ArchiveName  string            `json:"archive_name,omitempty"`
+	NameTemplate string            `json:"name_template,omitempty"`
+	Paths        map[string]string `json:"paths,omitempty"` // url -> путь в архиве, "dir/" - папка.
+	Collision    string            `json:"collision,omitempty"`
+	Manifest     bool              `json:"manifest"` // Класть в архив manifest.json и README.txt.
+	// url -> какой sha256 ожидает клиент, файл с другим хешем не попадет в архив.
+	Checksums map[string]string `json:"checksums,omitempty"`
+	// url -> заголовки запроса за файлом (токены, cookie). Только в памяти:
+	// наружу уходят одни имена, значения стираются, когда таска доделана.
+	headers map[string]http.Header
+	// Что и под каким именем легло в архив, заполняется при обработке.
+	Files []FileEntry `json:"files,omitempty"`
+	// sha256 готового архива, для Digest и ETag при скачивании.
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+	// Время создания, последнего изменения статуса и последнего обращения,
+	// нужны janitor-у для TTL и LRU.
+	CreatedAt  time.Time `json:"created_at"`
+	UpdatedAt  time.Time `json:"updated_at"`
+	AccessedAt time.Time `json:"-"`
+	// W3C traceparent запроса, создавшего таску,
+	// обработка таски продолжает этот трейс.
+	TraceParent string `json:"-"`
+	Mu          sync.RWMutex
 	// Должна ли таска знать о пути к архиву? Ну по сути, task_id можно назвать путем.
 }
 
@@ -38,12 +83,16 @@ type Task struct {
 // urls - массив с url,
 // MaxFiles - максимальное количество файлов.
 func NewTask(taskID string, urls []string, MaxFiles int) *Task {
+	now := time.Now()
 	return &Task{
-		TaskID:   taskID,
-		URLs:     urls,
-		MaxFiles: MaxFiles,
-		Status:   StatusPending,
-		Errors:   make([]FileError, 0),
+		TaskID:     taskID,
+		URLs:       urls,
+		MaxFiles:   MaxFiles,
+		Status:     StatusPending,
+		Errors:     make([]FileError, 0),
+		CreatedAt:  now,
+		UpdatedAt:  now,
+		AccessedAt: now,
 	}
 }
 
@@ -52,7 +101,7 @@ func (t *Task) AddURL(url string) error {
 	t.Mu.Lock()
 	defer t.Mu.Unlock()
 	if len(t.URLs) == t.MaxFiles {
-		return fmt.Errorf("too many urls, max count is %d", t.MaxFiles)
+		return fmt.Errorf("%w, max count is %d", ErrTooManyURLs, t.MaxFiles)
 	}
 	t.URLs = append(t.URLs, url)
 	return nil
@@ -63,6 +112,32 @@ func (t *Task) SetStatus(status TaskStatus) {
 	t.Mu.Lock()
 	defer t.Mu.Unlock()
 	t.Status = status
+	t.UpdatedAt = time.Now()
+}
+
+// CompareAndSetStatus меняет статус, только если текущий равен old.
+// Нужен, чтобы processTask не перетер отмену своим completed.
+func (t *Task) CompareAndSetStatus(old, status TaskStatus) bool {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	if t.Status != old {
+		return false
+	}
+	t.Status = status
+	t.UpdatedAt = time.Now()
+	return true
+}
+
+// Touch отмечает обращение к таске (статус, скачивание архива).
+func (t *Task) Touch() {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	t.AccessedAt = time.Now()
+}
+
+// IsFinished - таска больше не будет меняться (completed, failed или cancelled).
+func (s TaskStatus) IsFinished() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
 }
 
 // AddError добавляет ошибки, не ограниченно по размеру,
@@ -73,6 +148,75 @@ func (t *Task) AddError(url, errMsg string) {
 	t.Errors = append(t.Errors, FileError{URL: url, Error: errMsg})
 }
 
+// SetFailureReason - почему таска failed, когда url ни при чем.
+func (t *Task) SetFailureReason(reason string) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	t.FailureReason = reason
+}
+
+// SetFiles запоминает, что и под каким именем легло в архив.
+func (t *Task) SetFiles(files []FileEntry) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	t.Files = files
+}
+
+// SetPath задает путь url внутри архива.
+func (t *Task) SetPath(url, path string) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	if t.Paths == nil {
+		t.Paths = make(map[string]string)
+	}
+	t.Paths[url] = path
+}
+
+// SetChecksum задает ожидаемый sha256 файла по url.
+func (t *Task) SetChecksum(url, sum string) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	if t.Checksums == nil {
+		t.Checksums = make(map[string]string)
+	}
+	t.Checksums[url] = sum
+}
+
+// SetHeaders задает заголовки запроса за файлом по url.
+func (t *Task) SetHeaders(url string, h http.Header) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	if t.headers == nil {
+		t.headers = make(map[string]http.Header)
+	}
+	t.headers[url] = h.Clone()
+}
+
+// Headers - копия заголовков для url, nil - их нет.
+func (t *Task) Headers(url string) http.Header {
+	t.Mu.RLock()
+	defer t.Mu.RUnlock()
+	return t.headers[url].Clone()
+}
+
+// ForgetHeaders стирает значения заголовков, имена остаются для статуса.
+func (t *Task) ForgetHeaders() {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	for _, h := range t.headers {
+		for name := range h {
+			h[name] = nil
+		}
+	}
+}
+
+// SetArchiveSHA256 запоминает хеш собранного архива.
+func (t *Task) SetArchiveSHA256(sum string) {
+	t.Mu.Lock()
+	defer t.Mu.Unlock()
+	t.ArchiveSHA256 = sum
+}
+
 // ----- Геттеры -----
 
 // GetStatus возвращает статус таски.
@@ -82,6 +226,13 @@ func (t *Task) GetStatus() TaskStatus {
 	return t.Status
 }
 
+// GetTimes возвращает время последнего изменения статуса и последнего обращения.
+func (t *Task) GetTimes() (updatedAt, accessedAt time.Time) {
+	t.Mu.RLock()
+	defer t.Mu.RUnlock()
+	return t.UpdatedAt, t.AccessedAt
+}
+
 // GetURLs возвращает копиб URLs таски.
 func (t *Task) GetURLs() []string {
 	t.Mu.RLock()
@@ -91,6 +242,20 @@ func (t *Task) GetURLs() []string {
 	return urls
 }
 
+// GetPaths возвращает копию путей в архиве.
+func (t *Task) GetPaths() map[string]string {
+	t.Mu.RLock()
+	defer t.Mu.RUnlock()
+	return maps.Clone(t.Paths)
+}
+
+// GetChecksums возвращает копию ожидаемых хешей.
+func (t *Task) GetChecksums() map[string]string {
+	t.Mu.RLock()
+	defer t.Mu.RUnlock()
+	return maps.Clone(t.Checksums)
+}
+
 // GetErrors возвращает копию ошибок такси.
 func (t *Task) GetErrors() []FileError {
 	t.Mu.RLock()
@@ -99,3 +264,84 @@ func (t *Task) GetErrors() []FileError {
 	copy(errs, t.Errors)
 	return errs
 }
+
+// Snapshot - копия публичных полей таски без мьютекса,
+// её можно спокойно отдавать наружу и сериализовать.
+type Snapshot struct {
+	TaskID string      `json:"task_id"`
+	URLs   []string    `json:"urls"`
+	Status TaskStatus  `json:"status"`
+	Errors []FileError `json:"errors"`
+	Owner  string      `json:"owner,omitempty"`
+
+	FailureReason string    `json:"failure_reason,omitempty"`
+	MaxFiles      int       `json:"max_files"`
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+
+	ArchiveName  string            `json:"archive_name,omitempty"`
+	NameTemplate string            `json:"name_template,omitempty"`
+	Paths        map[string]string `json:"paths,omitempty"`
+	Collision    string            `json:"collision,omitempty"`
+	Manifest     bool              `json:"manifest"`
+	Checksums    map[string]string `json:"checksums,omitempty"`
+	Files        []FileEntry       `json:"files,omitempty"`
+
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"`
+
+	// url -> имя заголовка -> RedactedValue, сами значения наружу не отдаются.
+	Headers map[string]map[string]string `json:"headers,omitempty"`
+}
+
+// RedactedValue - что показывается вместо значения заголовка.
+const RedactedValue = "***"
+
+// Snapshot возвращает копию таски.
+func (t *Task) Snapshot() Snapshot {
+	t.Mu.RLock()
+	defer t.Mu.RUnlock()
+	urls := make([]string, len(t.URLs))
+	copy(urls, t.URLs)
+	errs := make([]FileError, len(t.Errors))
+	copy(errs, t.Errors)
+	return Snapshot{
+		TaskID:    t.TaskID,
+		URLs:      urls,
+		Status:    t.Status,
+		Errors:    errs,
+		Owner:     t.Owner,
+		MaxFiles:  t.MaxFiles,
+		CreatedAt: t.CreatedAt,
+		UpdatedAt: t.UpdatedAt,
+
+		FailureReason: t.FailureReason,
+
+		ArchiveName:  t.ArchiveName,
+		NameTemplate: t.NameTemplate,
+		Paths:        maps.Clone(t.Paths),
+		Collision:    t.Collision,
+		Manifest:     t.Manifest,
+		Checksums:    maps.Clone(t.Checksums),
+		Files:        slices.Clone(t.Files),
+
+		ArchiveSHA256: t.ArchiveSHA256,
+
+		Headers: redactHeaders(t.headers),
+	}
+}
+
+// redactHeaders - имена заголовков без значений, под RLock.
+func redactHeaders(headers map[string]http.Header) map[string]map[string]string {
+	if len(headers) == 0 {
+		return nil
+	}
+	redacted := make(map[string]map[string]string, len(headers))
+	for url, h := range headers {
+		names := make(map[string]string, len(h))
+		for name := range h {
+			names[name] = RedactedValue
+		}
+		redacted[url] = names
+	}
+	return redacted
+}
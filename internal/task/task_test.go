@@ -1,6 +1,9 @@
 package task
 
 import (
+	"encoding/json"
+	"net/http"
+	"strings"
 	"testing"
 )
 
@@ -76,6 +79,21 @@ func TestSetStatus(t *testing.T) {
 	}
 }
 
+func TestCompareAndSetStatus(t *testing.T) {
+	task := NewTask("test-task", []string{}, 5)
+	task.SetStatus(StatusCancelled)
+
+	if task.CompareAndSetStatus(StatusProcessing, StatusCompleted) {
+		t.Error("Expected CAS to fail for cancelled task")
+	}
+	if task.GetStatus() != StatusCancelled {
+		t.Errorf("Expected status %s, got %s", StatusCancelled, task.GetStatus())
+	}
+	if !task.CompareAndSetStatus(StatusCancelled, StatusFailed) {
+		t.Error("Expected CAS to succeed")
+	}
+}
+
 func TestAddError(t *testing.T) {
 	task := NewTask("test-task", []string{}, 5)
 	url := "http://example.com/badfile.txt"
@@ -205,3 +223,53 @@ func TestConcurrentAccess(t *testing.T) {
 	_ = errors
 	_ = status
 }
+
+func TestSnapshot(t *testing.T) {
+	task := NewTask("test-task", []string{"http://example.com/a.pdf"}, 3)
+	task.AddError("http://example.com/b.pdf", "not found")
+
+	snap := task.Snapshot()
+	if snap.TaskID != "test-task" || snap.Status != StatusPending || snap.MaxFiles != 3 {
+		t.Errorf("Unexpected snapshot: %+v", snap)
+	}
+
+	// Снимок не должен меняться вместе с таской.
+	_ = task.AddURL("http://example.com/c.pdf")
+	if len(snap.URLs) != 1 {
+		t.Errorf("Expected snapshot to keep 1 URL, got %d", len(snap.URLs))
+	}
+	if len(snap.Errors) != 1 {
+		t.Errorf("Expected 1 error, got %d", len(snap.Errors))
+	}
+}
+
+func TestHeaders_Redacted(t *testing.T) {
+	url := "http://example.com/a.pdf"
+	task := NewTask("test-task", []string{url}, 3)
+	task.SetHeaders(url, http.Header{"Authorization": {"Bearer secret"}})
+
+	if got := task.Headers(url).Get("Authorization"); got != "Bearer secret" {
+		t.Errorf("Expected header value for download, got %q", got)
+	}
+	snap := task.Snapshot()
+	if snap.Headers[url]["Authorization"] != RedactedValue {
+		t.Errorf("Expected redacted header in snapshot, got %v", snap.Headers)
+	}
+	for _, v := range []any{task, snap} {
+		data, err := json.Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if strings.Contains(string(data), "secret") {
+			t.Errorf("Expected no header value in json, got %s", data)
+		}
+	}
+
+	task.ForgetHeaders()
+	if got := task.Headers(url).Get("Authorization"); got != "" {
+		t.Errorf("Expected header value to be forgotten, got %q", got)
+	}
+	if task.Snapshot().Headers[url]["Authorization"] != RedactedValue {
+		t.Error("Expected header name to stay in snapshot")
+	}
+}
@@ -0,0 +1,59 @@
+package taskmanager
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Ошибки API TaskManager-а, проверять через errors.Is.
+// Актор отвечает ими через ReplyCh, так что вызывающий получает
+// ту же ошибку, что вернул обработчик.
+var (
+	// ErrBusy - все слоты заняты, нужно подождать.
+	ErrBusy = errors.New("server busy")
+	// ErrShuttingDown - сервис останавливается и новые таски не принимает.
+	ErrShuttingDown = errors.New("task manager is shutting down")
+	// ErrTaskNotFound - таски нет (или её уже убрал janitor).
+	ErrTaskNotFound = errors.New("task not found")
+	// ErrTaskFull - в таске уже MaxFiles url.
+	ErrTaskFull = errors.New("task is full")
+	// ErrTaskSealed - таска уже запущена или завершена, url добавлять нельзя.
+	ErrTaskSealed = errors.New("task is sealed")
+	// ErrTaskEmpty - запускать нечего, в таске нет url.
+	ErrTaskEmpty = errors.New("task has no urls")
+	// ErrInvalidQuery - кривой фильтр, сортировка или курсор в ListTasks.
+	ErrInvalidQuery = errors.New("invalid query")
+	// ErrInvalidOptions - кривые TaskOptions: шаблон имени, путь для url, которого нет.
+	ErrInvalidOptions = errors.New("invalid task options")
+	// ErrURLRejected - url не прошел проверку, подробности в *URLRejectedError.
+	ErrURLRejected = errors.New("url rejected")
+)
+
+// Причины, по которым url может быть отклонен.
+const (
+	ReasonInvalidURL        = "invalid url"
+	ReasonUnsupportedScheme = "unsupported scheme"
+	ReasonExtNotAllowed     = "extension not allowed"
+	ReasonInvalidPath       = "invalid path in archive"
+	ReasonCredentialsInURL  = "credentials in url"
+)
+
+// URLRejectedError - url отклонен, достается через errors.As.
+// errors.Is(err, ErrURLRejected) тоже работает.
+type URLRejectedError struct {
+	URL    string
+	Reason string
+	Detail string // Например, само расширение.
+}
+
+func (e *URLRejectedError) Error() string {
+	if e.Detail != "" {
+		return fmt.Sprintf("url %q rejected: %s: %s", e.URL, e.Reason, e.Detail)
+	}
+	return fmt.Sprintf("url %q rejected: %s", e.URL, e.Reason)
+}
+
+// Is позволяет проверять errors.Is(err, ErrURLRejected).
+func (e *URLRejectedError) Is(target error) bool {
+	return target == ErrURLRejected
+}
@@ -0,0 +1,174 @@
+package taskmanager
+
+import (
+	"encoding/base64"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/task"
+)
+
+// Лимиты на размер страницы.
+const (
+	DefaultPageSize = 50
+	MaxPageSize     = 500
+)
+
+// Поля, по которым можно сортировать, "-" впереди - по убыванию.
+const (
+	SortCreatedAsc  = "created_at"
+	SortCreatedDesc = "-created_at"
+	SortUpdatedAsc  = "updated_at"
+	SortUpdatedDesc = "-updated_at"
+)
+
+// Query - фильтры и пагинация для ListTasks.
+// Пустые поля не фильтруют.
+type Query struct {
+	Statuses      []task.TaskStatus
+	Owner         string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	HasErrors     *bool
+	Sort          string // По умолчанию SortCreatedDesc, новые сверху.
+	Limit         int    // По умолчанию DefaultPageSize.
+	Cursor        string // NextCursor предыдущей страницы.
+}
+
+// Page - страница результата.
+// NextCursor пустой, если дальше ничего нет.
+type Page struct {
+	Tasks      []task.Snapshot
+	NextCursor string
+}
+
+// normalize проверяет запрос и проставляет значения по умолчанию.
+func (q *Query) normalize() error {
+	switch q.Sort {
+	case "":
+		q.Sort = SortCreatedDesc
+	case SortCreatedAsc, SortCreatedDesc, SortUpdatedAsc, SortUpdatedDesc:
+	default:
+		return fmt.Errorf("%w: unknown sort %q", ErrInvalidQuery, q.Sort)
+	}
+	switch {
+	case q.Limit == 0:
+		q.Limit = DefaultPageSize
+	case q.Limit < 0:
+		return fmt.Errorf("%w: negative limit", ErrInvalidQuery)
+	case q.Limit > MaxPageSize:
+		q.Limit = MaxPageSize
+	}
+	return nil
+}
+
+func (q *Query) match(s task.Snapshot) bool {
+	if len(q.Statuses) > 0 && !slices.Contains(q.Statuses, s.Status) {
+		return false
+	}
+	if q.Owner != "" && s.Owner != q.Owner {
+		return false
+	}
+	if !q.CreatedAfter.IsZero() && !s.CreatedAt.After(q.CreatedAfter) {
+		return false
+	}
+	if !q.CreatedBefore.IsZero() && !s.CreatedAt.Before(q.CreatedBefore) {
+		return false
+	}
+	if q.HasErrors != nil && (len(s.Errors) > 0) != *q.HasErrors {
+		return false
+	}
+	return true
+}
+
+// sortKey - значение поля сортировки.
+func sortKey(sort string, s task.Snapshot) time.Time {
+	if strings.TrimPrefix(sort, "-") == SortUpdatedAsc {
+		return s.UpdatedAt
+	}
+	return s.CreatedAt
+}
+
+// compare - порядок выдачи, при равенстве времени по id, чтобы порядок был стабильный.
+func compare(sort string, aKey time.Time, aID string, bKey time.Time, bID string) int {
+	c := aKey.Compare(bKey)
+	if c == 0 {
+		c = strings.Compare(aID, bID)
+	}
+	if strings.HasPrefix(sort, "-") {
+		return -c
+	}
+	return c
+}
+
+// cursor - позиция последнего элемента страницы.
+// Курсор по значению, а не по смещению: новые таски не сдвигают страницы.
+type cursor struct {
+	sort string
+	key  time.Time
+	id   string
+}
+
+func (c cursor) encode() string {
+	raw := c.sort + "|" + strconv.FormatInt(c.key.UnixNano(), 10) + "|" + c.id
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(s, sort string) (cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return cursor{}, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+	}
+	parts := strings.SplitN(string(raw), "|", 3)
+	if len(parts) != 3 {
+		return cursor{}, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+	}
+	if parts[0] != sort {
+		return cursor{}, fmt.Errorf("%w: cursor is for sort %q", ErrInvalidQuery, parts[0])
+	}
+	nanos, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil {
+		return cursor{}, fmt.Errorf("%w: bad cursor", ErrInvalidQuery)
+	}
+	return cursor{sort: sort, key: time.Unix(0, nanos), id: parts[2]}, nil
+}
+
+// query фильтрует, сортирует и режет снимки на страницу.
+func query(snaps []task.Snapshot, q Query) (Page, error) {
+	if err := q.normalize(); err != nil {
+		return Page{}, err
+	}
+	var after *cursor
+	if q.Cursor != "" {
+		c, err := decodeCursor(q.Cursor, q.Sort)
+		if err != nil {
+			return Page{}, err
+		}
+		after = &c
+	}
+
+	matched := make([]task.Snapshot, 0, len(snaps))
+	for _, s := range snaps {
+		if !q.match(s) {
+			continue
+		}
+		if after != nil && compare(q.Sort, sortKey(q.Sort, s), s.TaskID, after.key, after.id) <= 0 {
+			continue
+		}
+		matched = append(matched, s)
+	}
+	slices.SortFunc(matched, func(a, b task.Snapshot) int {
+		return compare(q.Sort, sortKey(q.Sort, a), a.TaskID, sortKey(q.Sort, b), b.TaskID)
+	})
+
+	page := Page{Tasks: matched}
+	if len(matched) > q.Limit {
+		page.Tasks = matched[:q.Limit]
+		last := page.Tasks[q.Limit-1]
+		page.NextCursor = cursor{sort: q.Sort, key: sortKey(q.Sort, last), id: last.TaskID}.encode()
+	}
+	return page, nil
+}
@@ -0,0 +1,111 @@
+package taskmanager
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/task"
+)
+
+func testSnapshots() []task.Snapshot {
+	base := time.Date(2025, 8, 6, 12, 0, 0, 0, time.UTC)
+	return []task.Snapshot{
+		{TaskID: "a", Status: task.StatusCompleted, Owner: "alice", CreatedAt: base, UpdatedAt: base.Add(5 * time.Minute)},
+		{TaskID: "b", Status: task.StatusFailed, Owner: "bob", CreatedAt: base.Add(time.Minute), UpdatedAt: base.Add(2 * time.Minute),
+			Errors: []task.FileError{{URL: "http://example.com/1.pdf", Error: "404"}}},
+		{TaskID: "c", Status: task.StatusPending, Owner: "alice", CreatedAt: base.Add(2 * time.Minute), UpdatedAt: base.Add(2 * time.Minute)},
+		{TaskID: "d", Status: task.StatusPending, CreatedAt: base.Add(2 * time.Minute), UpdatedAt: base.Add(3 * time.Minute)},
+	}
+}
+
+func ids(snaps []task.Snapshot) []string {
+	res := make([]string, len(snaps))
+	for i, s := range snaps {
+		res[i] = s.TaskID
+	}
+	return res
+}
+
+func TestQuery_FiltersAndSort(t *testing.T) {
+	base := time.Date(2025, 8, 6, 12, 0, 0, 0, time.UTC)
+	yes, no := true, false
+	tests := []struct {
+		name string
+		q    Query
+		want []string
+	}{
+		{"default newest first", Query{}, []string{"d", "c", "b", "a"}},
+		{"created asc", Query{Sort: SortCreatedAsc}, []string{"a", "b", "c", "d"}},
+		{"updated desc", Query{Sort: SortUpdatedDesc}, []string{"a", "d", "c", "b"}},
+		{"status", Query{Statuses: []task.TaskStatus{task.StatusPending, task.StatusFailed}}, []string{"d", "c", "b"}},
+		{"owner", Query{Owner: "alice"}, []string{"c", "a"}},
+		{"created after", Query{CreatedAfter: base.Add(time.Minute)}, []string{"d", "c"}},
+		{"created before", Query{CreatedBefore: base.Add(time.Minute)}, []string{"a"}},
+		{"has errors", Query{HasErrors: &yes}, []string{"b"}},
+		{"no errors", Query{HasErrors: &no, Owner: "alice"}, []string{"c", "a"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			page, err := query(testSnapshots(), tt.q)
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if got := ids(page.Tasks); !slices.Equal(got, tt.want) {
+				t.Errorf("Expected %v, got %v", tt.want, got)
+			}
+			if page.NextCursor != "" {
+				t.Errorf("Expected no next cursor, got %q", page.NextCursor)
+			}
+		})
+	}
+}
+
+func TestQuery_Pagination(t *testing.T) {
+	snaps := testSnapshots()
+	q := Query{Limit: 3}
+	var got []string
+	pages := 0
+	for {
+		page, err := query(snaps, q)
+		if err != nil {
+			t.Fatalf("Unexpected error: %v", err)
+		}
+		pages++
+		got = append(got, ids(page.Tasks)...)
+		if page.NextCursor == "" {
+			break
+		}
+		q.Cursor = page.NextCursor
+		// Новая таска между страницами не должна сдвигать выдачу.
+		snaps = append(snaps, task.Snapshot{TaskID: "new", Status: task.StatusPending, CreatedAt: time.Now()})
+	}
+	if want := []string{"d", "c", "b", "a"}; !slices.Equal(got, want) || pages != 2 {
+		t.Errorf("Expected %v in 2 pages, got %v in %d", want, got, pages)
+	}
+}
+
+func TestQuery_Invalid(t *testing.T) {
+	page, err := query(testSnapshots(), Query{Limit: 1})
+	if err != nil || page.NextCursor == "" {
+		t.Fatalf("Expected next cursor, got %+v, %v", page, err)
+	}
+
+	tests := []struct {
+		name string
+		q    Query
+	}{
+		{"unknown sort", Query{Sort: "owner"}},
+		{"negative limit", Query{Limit: -1}},
+		{"garbage cursor", Query{Cursor: "%%%"}},
+		{"cursor for other sort", Query{Sort: SortUpdatedAsc, Cursor: page.NextCursor}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := query(testSnapshots(), tt.q); !errors.Is(err, ErrInvalidQuery) {
+				t.Errorf("Expected ErrInvalidQuery, got %v", err)
+			}
+		})
+	}
+}
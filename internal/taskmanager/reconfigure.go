@@ -0,0 +1,169 @@
+package taskmanager
+
+import (
+	"context"
+	"slices"
+	"strings"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/downloader"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/config"
+)
+
+// Reconfigure применяет новый конфиг на лету. Меняются только config.LiveKeys
+// (MAX_TASKS, MAX_FILES, MAX_FILE_SIZE_MB, ALLOWED_EXT, ARCHIVE_MANIFEST и лимиты
+// загрузок DOWNLOAD_*, TASK_BANDWIDTH_KB, HOST_*), остальное остается как было,
+// такие ключи возвращаются в restart - нужен перезапуск.
+//
+// Запущенные таски не трогаются: у pending тасок остается свой MaxFiles,
+// загрузки, которые уже идут, докачиваются со старыми лимитами размера,
+// а новая полоса действует на них сразу.
+// Если новый MAX_TASKS меньше занятых слотов, новые таски не создаются,
+// пока старые не завершатся.
+// Ошибки: config.ErrInvalidConfig.
+func (tm *TaskManager) Reconfigure(ctx context.Context, cfg *config.Config) (restart []string, err error) {
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	err = tm.UpdateConfig(ctx, func(next *config.Config) error {
+		was, now := next.Values(), cfg.Values()
+		for key, value := range now {
+			if was[key] != value && !slices.Contains(config.LiveKeys, key) {
+				restart = append(restart, key)
+			}
+		}
+		slices.Sort(restart)
+
+		next.MaxTasks = cfg.MaxTasks
+		next.MaxFiles = cfg.MaxFiles
+		next.MaxFileSize = cfg.MaxFileSize
+		next.AllowedExtensions = slices.Clone(cfg.AllowedExtensions)
+		next.ArchiveManifest = cfg.ArchiveManifest
+		next.DownloadMaxConns = cfg.DownloadMaxConns
+		next.DownloadMaxConnsPerHost = cfg.DownloadMaxConnsPerHost
+		next.DownloadBandwidth = cfg.DownloadBandwidth
+		next.TaskBandwidth = cfg.TaskBandwidth
+		next.HostFailureThreshold = cfg.HostFailureThreshold
+		next.HostCooldown = cfg.HostCooldown
+		next.HostRequestsPerMin = cfg.HostRequestsPerMin
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(restart) > 0 {
+		tm.loggerFor(ctx).Warn("config changes need a restart", "keys", restart)
+	}
+	return restart, nil
+}
+
+// UpdateConfig правит действующий конфиг: update получает копию текущего,
+// потом она проверяется и применяется. Прочитать, поправить и применить -
+// один шаг в акторе, так что SIGHUP и PATCH /admin/config одновременно
+// не затрут правки друг друга. Менять в update стоит только config.LiveKeys.
+// Ошибки: config.ErrInvalidConfig и то, что вернул update.
+func (tm *TaskManager) UpdateConfig(ctx context.Context, update func(cfg *config.Config) error) error {
+	res, err := tm.ask(ctx, "reconfigure", TaskCommand{Ctx: ctx, UpdateConfig: update})
+	if err != nil {
+		return err
+	}
+	next, err := replyAs[*config.Config](res)
+	if err != nil {
+		return err
+	}
+	tm.loggerFor(ctx).Info("config applied",
+		"max_tasks", next.MaxTasks,
+		"max_files", next.MaxFiles,
+		"max_file_size", next.MaxFileSize,
+		"allowed_ext", next.AllowedExtensions,
+		"download_limits", downloadLimits(next),
+		"host_policy", hostPolicy(next))
+	return nil
+}
+
+// Config - текущий конфиг, копия.
+func (tm *TaskManager) Config() config.Config {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return *copyConfig(tm.cfg)
+}
+
+// handleReconfigure правит и подменяет конфиг. В акторе, чтобы create и add_url
+// видели либо старые лимиты, либо новые, но не смесь, а две правки шли по очереди.
+func (tm *TaskManager) handleReconfigure(ctx context.Context, payload any) error {
+	cmd, ok := payload.(TaskCommand)
+	if !ok || cmd.UpdateConfig == nil {
+		return nil
+	}
+	tm.mu.RLock()
+	next := copyConfig(tm.cfg)
+	tm.mu.RUnlock()
+	err := cmd.UpdateConfig(next)
+	if err == nil {
+		err = next.Validate()
+	}
+	if err != nil {
+		cmd.ReplyCh <- err
+		return nil
+	}
+
+	tm.mu.Lock()
+	tm.cfg = next
+	tm.maxTasks = next.MaxTasks
+	tm.mu.Unlock()
+
+	if d, ok := tm.downloader.(interface {
+		SetLimits(maxSize int64, allowedExts []string)
+	}); ok {
+		d.SetLimits(next.MaxFileSize, next.AllowedExtensions)
+	}
+	if d, ok := tm.downloader.(interface{ SetHostPolicy(downloader.HostPolicy) }); ok {
+		d.SetHostPolicy(hostPolicy(next))
+	}
+	tm.sched.SetLimits(downloadLimits(next))
+	cmd.ReplyCh <- copyConfig(next)
+	return nil
+}
+
+// downloadLimits - лимиты планировщика загрузок из конфига.
+func downloadLimits(cfg *config.Config) downloader.Limits {
+	return downloader.Limits{
+		MaxConns:        cfg.DownloadMaxConns,
+		MaxConnsPerHost: cfg.DownloadMaxConnsPerHost,
+		Bandwidth:       cfg.DownloadBandwidth,
+		TaskBandwidth:   cfg.TaskBandwidth,
+	}
+}
+
+// hostPolicy - защита от падающих хостов из конфига.
+func hostPolicy(cfg *config.Config) downloader.HostPolicy {
+	return downloader.HostPolicy{
+		FailureThreshold:  cfg.HostFailureThreshold,
+		Cooldown:          cfg.HostCooldown,
+		RequestsPerMinute: cfg.HostRequestsPerMin,
+	}
+}
+
+// transportConfig - как ходить в сеть за файлами, из конфига.
+func transportConfig(cfg *config.Config) downloader.TransportConfig {
+	var noProxy []string
+	for _, rule := range strings.Split(cfg.DownloadNoProxy, ",") {
+		if rule = strings.TrimSpace(rule); rule != "" {
+			noProxy = append(noProxy, rule)
+		}
+	}
+	return downloader.TransportConfig{
+		Proxy:         cfg.DownloadProxy,
+		NoProxy:       noProxy,
+		CAFile:        cfg.DownloadCAFile,
+		CertFile:      cfg.DownloadClientCert,
+		KeyFile:       cfg.DownloadClientKey,
+		MinTLSVersion: cfg.DownloadTLSMinVersion,
+	}
+}
+
+// copyConfig - копия конфига вместе со слайсами.
+func copyConfig(cfg *config.Config) *config.Config {
+	c := *cfg
+	c.AllowedExtensions = slices.Clone(cfg.AllowedExtensions)
+	return &c
+}
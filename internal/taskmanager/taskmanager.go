@@ -2,9 +2,19 @@ package taskmanager
 
 import (
 	"context"
-	"log"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -13,7 +23,11 @@ import (
 	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/actor"
 	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/archiver"
 	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/downloader"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/metrics"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/naming"
 	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/task"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/tracing"
 	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/config"
 )
 
@@ -23,33 +37,117 @@ type TaskManager struct {
 	tasks      map[string]*task.Task
 	mu         sync.RWMutex // Приватный мьютекс.
 	maxTasks   int8         // Примитивная оптимизация, вроде map так улучшили, int на int8 заменили
-	logger     *log.Logger
-	cfg        *config.Config // bad practic
+	logger     *slog.Logger
+	cfg        *config.Config // bad practic. Меняется только в акторе под mu, см. Reconfigure.
+	tmpPath    string         // Из cfg, но не меняется на лету, поэтому без блокировок.
 	downloader downloader.Downloader
-	archiver   archiver.Archiver
+	sched      *downloader.Scheduler // Общие лимиты на соединения и полосу, меняются в Reconfigure.
+	// Транспорт загрузок не собрался (CA, сертификат): загрузки падают, /readyz красный.
+	transportErr error
+	archiver     archiver.Archiver
+
+	// Graceful shutdown: draining - новые таски не принимаем,
+	// wg - запущенные processTask.
+	draining bool
+	wg       sync.WaitGroup
+
+	// Корневой контекст всей работы TM, stop отменяет его в Shutdown,
+	// если запущенные таски не уложились. У каждой запущенной таски
+	// свой дочерний, его отменяют CancelTask и RemoveTask.
+	ctx     context.Context
+	stop    context.CancelFunc
+	cancels map[string]context.CancelFunc // task_id -> отмена processTask, под mu.
+}
+
+// abortWait - сколько Shutdown ждет прерванные таски,
+// чтобы они успели убрать за собой временные файлы.
+const abortWait = 5 * time.Second
+
+// Stats - сводка по таскам для /status.
+type Stats struct {
+	Pending    int `json:"pending"`
+	Processing int `json:"processing"`
+	Completed  int `json:"completed"`
+	Failed     int `json:"failed"`
+	Cancelled  int `json:"cancelled"`
+	MaxTasks   int `json:"max_tasks"`
+	SlotsFree  int `json:"slots_free"`
 }
 
 type TaskCommand struct {
+	Ctx     context.Context // Контекст вызывающего: логгер с request_id и т.п.
 	TaskID  string
 	URLs    []string
-	ReplyCh chan any // Канал для сообщений.
+	Options TaskOptions // Для create.
+	Query   Query       // Для list.
+	ReplyCh chan any    // Канал для сообщений.
+	// Для reconfigure: правит копию текущего конфига, вызывается в акторе.
+	UpdateConfig func(cfg *config.Config) error
 }
 
+// TaskOptions - необязательные параметры таски при создании.
+// При добавлении url используются только Paths, Checksums и Headers.
+type TaskOptions struct {
+	Owner        string            // Кто создал, для поиска.
+	ArchiveName  string            // Имя архива при скачивании, по умолчанию archive.zip.
+	NameTemplate string            // Шаблон имен файлов, см. naming.ParseTemplate.
+	Paths        map[string]string // url -> путь в архиве, "dir/" - только папка, имя по шаблону.
+	Collision    string            // Как разводить одинаковые имена, см. naming.CollisionSuffix.
+	Manifest     *bool             // Класть ли manifest.json и README.txt, nil - как в ARCHIVE_MANIFEST.
+	Checksums    map[string]string // url -> ожидаемый sha256 (hex, можно с "sha256:").
+	// url -> заголовок -> значение: токены, cookie для закрытых источников.
+	// Хранятся только в памяти, в статусе видны одни имена.
+	Headers map[string]map[string]string
+}
+
+// DefaultArchiveName - имя архива, если клиент не задал свое.
+const DefaultArchiveName = "archive.zip"
+
 // Конструктор TM:
-// maxTasks - максимальное количество тасок(задач),
-// logger - логгер,
-// debug - флаг для деббаг мода, передается в приватное поле actor.
-func NewTaskManager(maxTasks int8, logger *log.Logger, debug bool) *TaskManager {
-	cfg := config.NewConfig() // По хорошему,
-	// это должно быть в main.go, но я плохой :)
+// cfg - конфиг сервиса (MaxTasks, MaxFiles, TmpPath и т.д.),
+// logger - логгер, если в контексте вызова есть свой (с request_id), используется он.
+func NewTaskManager(cfg *config.Config, logger *slog.Logger) *TaskManager {
+	if logger == nil {
+		logger = slog.Default()
+	}
+	cfg = copyConfig(cfg) // Чтобы чужие изменения конфига не пролезли мимо Reconfigure.
+	ctx, stop := context.WithCancel(context.Background())
 	tm := &TaskManager{
-		tasks:      make(map[string]*task.Task),
-		maxTasks:   maxTasks,
-		logger:     logger,
-		cfg:        cfg,
-		downloader: downloader.NewHTTPDownloader(30*time.Second, cfg.MaxFileSize, cfg.AllowedExtensions),
-		archiver:   archiver.NewZipArchiver(),
+		ctx:      ctx,
+		stop:     stop,
+		cancels:  make(map[string]context.CancelFunc),
+		tasks:    make(map[string]*task.Task),
+		maxTasks: cfg.MaxTasks,
+		logger:   logger,
+		cfg:      cfg,
+		tmpPath:  cfg.TmpPath,
+		archiver: archiver.NewZipArchiver(),
+		sched:    downloader.NewScheduler(downloadLimits(cfg)),
+	}
+	d := downloader.NewHTTPDownloader(30*time.Second, cfg.MaxFileSize, cfg.AllowedExtensions)
+	d.SetScheduler(tm.sched)
+	d.SetHostPolicy(hostPolicy(cfg))
+	if rt, err := downloader.NewTransport(transportConfig(cfg)); err != nil {
+		logger.Error("download transport misconfigured, downloads will fail", "error", err)
+		tm.transportErr = err
+		d.SetTransport(downloader.FailTransport(err))
+	} else {
+		d.SetTransport(rt)
+	}
+	if cfg.CacheMaxSize > 0 {
+		dir := cfg.CacheDir
+		if dir == "" {
+			dir = filepath.Join(cfg.TmpPath, "cache")
+		}
+		// Без кеша сервис работает, просто качает все заново.
+		if cache, err := downloader.NewCache(dir, cfg.CacheMaxSize); err != nil {
+			logger.Warn("download cache disabled", "path", dir, "error", err)
+		} else {
+			d.SetCache(cache)
+			logger.Info("download cache enabled", "path", dir, "max_size", cfg.CacheMaxSize, "size", cache.Size())
+		}
 	}
+	tm.downloader = d
 	// Вообще, нужно давать нормальные имена, типа:
 	// get, post, тот же CRUD, но мне было сложно придумать нормальные,
 	// универсальные имена.
@@ -57,8 +155,15 @@ func NewTaskManager(maxTasks int8, logger *log.Logger, debug bool) *TaskManager
 		"create":  tm.handleCreate,
 		"add_url": tm.handleAddURL,
 		"status":  tm.handleStatus,
+		"list":    tm.handleList,
+		"start":   tm.handleStart,
+		"cancel":  tm.handleCancel,
+		"stats":   tm.handleStats,
+		"ping":    tm.handlePing,
+
+		"reconfigure": tm.handleReconfigure,
 	}
-	tm.actor = actor.NewActor(10, actorHandlers, logger, debug)
+	tm.actor = actor.NewActor(10, actorHandlers, logger.With("component", "actor"))
 	return tm
 }
 
@@ -66,52 +171,130 @@ func NewTaskManager(maxTasks int8, logger *log.Logger, debug bool) *TaskManager
 func (tm *TaskManager) handleCreate(ctx context.Context, payload any) error {
 	cmd, ok := payload.(TaskCommand)
 	if !ok {
-		tm.logger.Printf("Invalid payload type in handleCreate: expected TaskCommand, got %T", payload)
+		tm.logger.Error("invalid payload type", "handler", "create", "type", fmt.Sprintf("%T", payload))
+		return nil
+	}
+	logger := tm.loggerFor(cmd.Ctx)
+	if cmd.Ctx != nil && cmd.Ctx.Err() != nil {
+		// Вызывающий уже не ждет ответа, таска создалась бы впустую и заняла слот.
+		logger.Debug("create skipped: caller gone")
 		return nil
 	}
 
-	tm.mu.Lock()
-	defer tm.mu.Unlock()
-
-	if int8(len(tm.tasks)) >= tm.maxTasks {
-		tm.logger.Printf("Task creation rejected: max tasks limit reached (%d)", tm.maxTasks)
+	t, err := tm.newTask(ctx, cmd)
+	if err != nil {
+		if errors.Is(err, ErrBusy) {
+			logger.Warn("task creation rejected: max tasks limit reached", "max_tasks", tm.maxTasks)
+			metrics.TasksRejectedBusy.Inc()
+		}
 		select {
-		case cmd.ReplyCh <- "busy":
+		case cmd.ReplyCh <- err:
 		case <-ctx.Done(): // Не самая читаемая запись, но с каналами по другому не получится.
-			tm.logger.Printf("Context cancelled while sending 'busy' response")
+			logger.Warn("context cancelled while sending reply", "reply", err)
 			return ctx.Err()
 		}
 		return nil
 	}
 
-	id := uuid.New().String() // Просто хотел попробовать uuid.
-	t := task.NewTask(id, cmd.URLs, tm.cfg.MaxFiles)
-	tm.tasks[id] = t
-
 	select {
-	case cmd.ReplyCh <- id:
-		tm.logger.Printf("Successfully created task %s with %d initial URLs", id, len(cmd.URLs))
+	case cmd.ReplyCh <- t.TaskID:
+		metrics.TasksCreated.Inc()
+		logger.Info("task created", "task_id", t.TaskID, "urls", len(cmd.URLs))
 	case <-ctx.Done():
 		// Если контекст завершен, удаляем.
-		delete(tm.tasks, id)
-		tm.logger.Printf("Context cancelled, rolled back task creation for ID: %s", id)
+		tm.mu.Lock()
+		delete(tm.tasks, t.TaskID)
+		tm.mu.Unlock()
+		logger.Warn("context cancelled, task creation rolled back", "task_id", t.TaskID)
 		return ctx.Err()
 	}
 
+	// Если url сразу передали все - стартуем.
+	tm.maybeStart(t, logger.With("task_id", t.TaskID))
 	return nil
 }
 
+// newTask проверяет лимиты и url и регистрирует таску.
+func (tm *TaskManager) newTask(ctx context.Context, cmd TaskCommand) (*task.Task, error) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+
+	if tm.draining {
+		return nil, ErrShuttingDown
+	}
+
+	// Занятость считаем только по незавершенным таскам,
+	// завершенные просто ждут janitor-а и слот не занимают.
+	if int8(tm.activeCount()) >= tm.maxTasks {
+		return nil, ErrBusy
+	}
+
+	for _, u := range cmd.URLs {
+		if err := tm.validateURL(u); err != nil {
+			return nil, err
+		}
+	}
+	if len(cmd.URLs) > tm.cfg.MaxFiles {
+		return nil, ErrTaskFull
+	}
+	opts := cmd.Options
+	tmpl, err := naming.ParseTemplate(opts.NameTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOptions, err)
+	}
+	paths, err := cleanPaths(cmd.URLs, opts.Paths)
+	if err != nil {
+		return nil, err
+	}
+	checksums, err := cleanChecksums(cmd.URLs, opts.Checksums)
+	if err != nil {
+		return nil, err
+	}
+	headers, err := cleanHeaders(cmd.URLs, opts.Headers)
+	if err != nil {
+		return nil, err
+	}
+	collision, err := naming.ParseCollision(opts.Collision)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidOptions, err)
+	}
+
+	id := uuid.New().String() // Просто хотел попробовать uuid.
+	// Копия: processTask выкидывает из URLs то, что не скачалось,
+	// и не должен трогать слайс вызывающего.
+	t := task.NewTask(id, slices.Clone(cmd.URLs), tm.cfg.MaxFiles)
+	t.Owner = opts.Owner
+	t.ArchiveName = archiveName(opts.ArchiveName)
+	t.NameTemplate = tmpl.String()
+	t.Paths = paths
+	t.Collision = collision
+	t.Checksums = checksums
+	for u, h := range headers {
+		t.SetHeaders(u, h)
+	}
+	t.Manifest = tm.cfg.ArchiveManifest
+	if opts.Manifest != nil {
+		t.Manifest = *opts.Manifest
+	}
+	if sc := tracing.SpanContextFromContext(ctx); sc.IsValid() {
+		t.TraceParent = sc.Traceparent()
+	}
+	tm.tasks[id] = t
+	return t, nil
+}
+
 // handleAddURL обработка добавления url.
 func (tm *TaskManager) handleAddURL(ctx context.Context, payload any) error {
 	cmd, ok := payload.(TaskCommand)
 	if !ok {
-		tm.logger.Printf("Invalid payload type in handleCreate: expected TaskCommand, got %T", payload)
+		tm.logger.Error("invalid payload type", "handler", "add_url", "type", fmt.Sprintf("%T", payload))
 		return nil
 	}
+	logger := tm.loggerFor(cmd.Ctx).With("task_id", cmd.TaskID)
 
 	select {
 	case <-ctx.Done():
-		tm.logger.Printf("Context cancelled before processing add_url for task %s", cmd.TaskID)
+		logger.Warn("context cancelled before processing add_url")
 		return ctx.Err()
 	default:
 	}
@@ -122,33 +305,24 @@ func (tm *TaskManager) handleAddURL(ctx context.Context, payload any) error {
 
 	// Проверка существования таски.
 	if !exists {
-		tm.logger.Printf("Task not found: %s", cmd.TaskID)
+		logger.Info("task not found")
 		select {
-		case cmd.ReplyCh <- "not_found":
+		case cmd.ReplyCh <- ErrTaskNotFound:
 		case <-ctx.Done():
-			tm.logger.Printf("Context cancelled while sending 'not_found' for task %s", cmd.TaskID)
+			logger.Warn("context cancelled while sending reply", "reply", "not_found")
 			return ctx.Err()
 		}
 		return nil
 	}
 
 	// Добавление url, вообще, подразумевается, что их от одного.
-	var firstError error
-	for _, url := range cmd.URLs {
-		err := t.AddURL(url)
-		if err != nil {
-			tm.logger.Printf("Failed to add URL %s to task %s: %v", url, cmd.TaskID, err)
-			if firstError == nil {
-				firstError = err
-			}
-		}
-	}
-
-	if firstError != nil {
+	// Но если пришло несколько - добавляем все или ничего.
+	if err := tm.addURLs(t, cmd.URLs, cmd.Options); err != nil {
+		logger.Info("failed to add urls", "urls", len(cmd.URLs), "error", err)
 		select {
-		case cmd.ReplyCh <- firstError:
+		case cmd.ReplyCh <- err:
 		case <-ctx.Done():
-			tm.logger.Printf("Context cancelled while sending error response for task %s", cmd.TaskID)
+			logger.Warn("context cancelled while sending reply", "reply", "error")
 			return ctx.Err()
 		}
 		return nil
@@ -158,101 +332,440 @@ func (tm *TaskManager) handleAddURL(ctx context.Context, payload any) error {
 	select {
 	case cmd.ReplyCh <- "ok":
 	case <-ctx.Done():
-		tm.logger.Printf("Context cancelled while sending 'ok' response for task %s", cmd.TaskID)
+		logger.Warn("context cancelled while sending reply", "reply", "ok")
 		return ctx.Err()
 	}
 
 	// По тз, если пользователь добавил 3 url, значит нужно начать
-	t.Mu.RLock()
-	urls := make([]string, len(t.URLs))
-	copy(urls, t.URLs)
-	currentStatus := t.GetStatus()
-	t.Mu.RUnlock()
+	tm.maybeStart(t, logger)
+	return nil
+}
 
-	urlCount := len(urls)
-	if urlCount >= tm.cfg.MaxFiles && currentStatus == task.StatusPending {
-		tm.logger.Printf("Auto-starting task %s: %d URLs reached threshold %d",
-			cmd.TaskID, urlCount, tm.cfg.MaxFiles)
-		go tm.processTask(cmd.TaskID, urls)
+// addURLs проверяет urls и добавляет их в таску, если влезают все.
+// Вызывается из актора, поэтому между проверкой статуса и добавлением
+// таска стартовать не может.
+func (tm *TaskManager) addURLs(t *task.Task, urls []string, opts TaskOptions) error {
+	if t.GetStatus() != task.StatusPending {
+		return ErrTaskSealed
+	}
+	for _, u := range urls {
+		if err := tm.validateURL(u); err != nil {
+			return err
+		}
+	}
+	if len(t.GetURLs())+len(urls) > t.MaxFiles {
+		return ErrTaskFull
+	}
+	paths, err := cleanPaths(urls, opts.Paths)
+	if err != nil {
+		return err
+	}
+	checksums, err := cleanChecksums(urls, opts.Checksums)
+	if err != nil {
+		return err
+	}
+	headers, err := cleanHeaders(urls, opts.Headers)
+	if err != nil {
+		return err
+	}
+	for _, u := range urls {
+		if err := t.AddURL(u); err != nil {
+			if errors.Is(err, task.ErrTooManyURLs) {
+				return ErrTaskFull
+			}
+			return err
+		}
+	}
+	for u, p := range paths {
+		t.SetPath(u, p)
+	}
+	for u, sum := range checksums {
+		t.SetChecksum(u, sum)
+	}
+	for u, h := range headers {
+		t.SetHeaders(u, h)
 	}
+	return nil
+}
 
+// validateURL - проверка при добавлении: http(s) и разрешенное расширение.
+// Загрузчик проверяет расширение еще раз, но лучше отказать сразу,
+// а не после того, как таска стартанула.
+func (tm *TaskManager) validateURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Host == "" {
+		return &URLRejectedError{URL: logging.RedactURL(rawURL), Reason: ReasonInvalidURL}
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return &URLRejectedError{URL: logging.RedactURL(rawURL), Reason: ReasonUnsupportedScheme, Detail: u.Scheme}
+	}
+	// user:pass@ разошелся бы по статусу, логам и manifest.json.
+	// Для закрытых источников есть заголовки, они только в памяти.
+	if u.User != nil {
+		return &URLRejectedError{URL: logging.RedactURL(rawURL), Reason: ReasonCredentialsInURL, Detail: "pass them in an Authorization header"}
+	}
+	// Url без расширения (/download?id=42), с query или со скриптом
+	// в пути (/download.php?id=42, /get.aspx) пропускаем: тип станет
+	// известен только из ответа, его проверит загрузчик.
+	ext := strings.ToLower(path.Ext(u.Path))
+	if u.RawQuery == "" && downloader.IsFileExt(ext) && !slices.Contains(tm.cfg.AllowedExtensions, ext) {
+		return &URLRejectedError{URL: logging.RedactURL(rawURL), Reason: ReasonExtNotAllowed, Detail: ext}
+	}
 	return nil
 }
 
-// Планировщик клининга
-// Вообще, можно добавить дату:время создания,
-// и клинить проверяя в processTask, но я не хотел размывать обязанности,
-// так что лучше выделить отдельно горутину для удаления.
-func (tm *TaskManager) scheduleCleanup(taskID string) {
-	tm.logger.Printf("Scheduled cleanup for task %s in 1 hour", taskID)
+// cleanPaths проверяет пути в архиве: только для urls из этого же запроса
+// и без выхода за пределы архива. Возвращает почищенные пути.
+func cleanPaths(urls []string, paths map[string]string) (map[string]string, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	clean := make(map[string]string, len(paths))
+	for u, p := range paths {
+		if !slices.Contains(urls, u) {
+			return nil, fmt.Errorf("%w: path for unknown url %q", ErrInvalidOptions, logging.RedactURL(u))
+		}
+		c, err := naming.CleanPath(p)
+		if err != nil {
+			return nil, &URLRejectedError{URL: u, Reason: ReasonInvalidPath, Detail: p}
+		}
+		clean[u] = c
+	}
+	return clean, nil
+}
+
+// cleanChecksums проверяет ожидаемые хеши: только для urls из этого же запроса,
+// sha256 в hex, "sha256:" в начале можно. Возвращает хеши в нижнем регистре.
+func cleanChecksums(urls []string, sums map[string]string) (map[string]string, error) {
+	if len(sums) == 0 {
+		return nil, nil
+	}
+	clean := make(map[string]string, len(sums))
+	for u, s := range sums {
+		if !slices.Contains(urls, u) {
+			return nil, fmt.Errorf("%w: checksum for unknown url %q", ErrInvalidOptions, logging.RedactURL(u))
+		}
+		s = strings.ToLower(strings.TrimSpace(s))
+		s = strings.TrimPrefix(s, "sha256:")
+		if b, err := hex.DecodeString(s); err != nil || len(b) != sha256.Size {
+			return nil, fmt.Errorf("%w: bad sha256 for url %q", ErrInvalidOptions, u)
+		}
+		clean[u] = s
+	}
+	return clean, nil
+}
 
-	go func() {
-		time.Sleep(1 * time.Hour)
+// Заголовки, которые клиент задать не может: их ставит сам http клиент,
+// они ломают загрузку (Range, Accept-Encoding - в архив лег бы кусок или gzip)
+// или предназначены прокси, а не источнику.
+var forbiddenHeaders = []string{
+	"Host", "Content-Length", "Transfer-Encoding", "Connection", "Keep-Alive", "Upgrade", "Te", "Trailer",
+	"Proxy-Authorization", "Proxy-Connection", "Range", "Accept-Encoding",
+	"If-None-Match", "If-Modified-Since",
+}
 
-		taskDir := filepath.Join(tm.cfg.TmpPath, taskID)
-		if _, err := os.Stat(taskDir); os.IsNotExist(err) {
-			tm.logger.Printf("Task %s directory already removed", taskID)
-			return
+const (
+	maxHeaders     = 20       // На один url.
+	maxHeaderValue = 8 * 1024 // Байт.
+)
+
+// cleanHeaders проверяет заголовки для url: только для urls из этого же
+// запроса, имена - токены из RFC 9110, без переводов строк в значениях.
+// Значения в ошибки не попадают.
+func cleanHeaders(urls []string, headers map[string]map[string]string) (map[string]http.Header, error) {
+	if len(headers) == 0 {
+		return nil, nil
+	}
+	clean := make(map[string]http.Header, len(headers))
+	for u, hs := range headers {
+		if !slices.Contains(urls, u) {
+			return nil, fmt.Errorf("%w: headers for unknown url %q", ErrInvalidOptions, logging.RedactURL(u))
 		}
+		if len(hs) > maxHeaders {
+			return nil, fmt.Errorf("%w: too many headers for url %q, max %d", ErrInvalidOptions, u, maxHeaders)
+		}
+		h := make(http.Header, len(hs))
+		for name, value := range hs {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if !validHeaderName(name) {
+				return nil, fmt.Errorf("%w: bad header name %q for url %q", ErrInvalidOptions, name, u)
+			}
+			if slices.Contains(forbiddenHeaders, name) {
+				return nil, fmt.Errorf("%w: header %s can not be set for url %q", ErrInvalidOptions, name, u)
+			}
+			if len(value) > maxHeaderValue || strings.ContainsAny(value, "\r\n\x00") {
+				return nil, fmt.Errorf("%w: bad value of header %s for url %q", ErrInvalidOptions, name, u)
+			}
+			h.Set(name, value)
+		}
+		clean[u] = h
+	}
+	return clean, nil
+}
 
-		if err := os.RemoveAll(taskDir); err != nil {
-			tm.logger.Printf("Failed to clean up task %s: %v", taskID, err)
-		} else {
-			tm.logger.Printf("Successfully cleaned up task %s directory", taskID)
-			// После клининга, удаляем таску.
-
-			// Вот тут, я не совсем понимаю задачу. Типо, я не хочу
-			// чтобы таски вообще не удалялись, но в задаче такого нет.
-			// И более того, в задаче не уточненно, как должно происходить скачивание.
-			// То есть, если пользователь отойдет, процесс завершиться, все файлы скачаются,
-			// и статус станет "completed", удалять таску нельзя, так как пользователь,
-			// все еще, должен получить url для скачивания. А если он уйдет на 10^999 лет,
-			// все это время хранить этот архив?
-			tm.mu.Lock()
-			delete(tm.tasks, taskID)
-			tm.mu.Unlock()
+// validHeaderName - имя заголовка из символов token (RFC 9110, 5.6.2).
+func validHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		switch {
+		case c >= 'a' && c <= 'z', c >= 'A' && c <= 'Z', c >= '0' && c <= '9':
+		case strings.ContainsRune("!#$%&'*+-.^_`|~", c):
+		default:
+			return false
 		}
+	}
+	return true
+}
+
+// archiveName - имя архива для Content-Disposition, всегда с .zip.
+func archiveName(name string) string {
+	if strings.TrimSpace(name) == "" {
+		return DefaultArchiveName
+	}
+	name = naming.CleanName(name)
+	if !strings.EqualFold(path.Ext(name), ".zip") {
+		name += ".zip"
+	}
+	return name
+}
+
+// maybeStart запускает обработку, если набралось MaxFiles url.
+func (tm *TaskManager) maybeStart(t *task.Task, logger *slog.Logger) {
+	// Порог свой у каждой таски: MAX_FILES могли поменять после ее создания.
+	if len(t.GetURLs()) < t.MaxFiles || t.GetStatus() != task.StatusPending {
+		return
+	}
+	logger.Info("auto-starting task", "threshold", t.MaxFiles)
+	if err := tm.startTask(t, logger); err != nil {
+		logger.Warn("task not started", "error", err)
+	}
+}
+
+// startTask запускает обработку таски в отдельной горутине.
+// Вызывается только из актора.
+func (tm *TaskManager) startTask(t *task.Task, logger *slog.Logger) error {
+	urls := t.GetURLs()
+	if len(urls) == 0 {
+		return ErrTaskEmpty
+	}
+
+	tm.mu.Lock()
+	if tm.draining {
+		// Остановка уже началась, новую работу не запускаем.
+		tm.mu.Unlock()
+		return ErrShuttingDown
+	}
+	// Статус ставим сразу, чтобы janitor не успел удалить таску до старта.
+	if !t.CompareAndSetStatus(task.StatusPending, task.StatusProcessing) {
+		tm.mu.Unlock()
+		return ErrTaskSealed
+	}
+	// Контекст запроса не используем, он умрет вместе с запросом.
+	// Таска живет в своем, дочернем от корневого, из запроса берем
+	// только логгер, чтобы request_id остался в логах таски,
+	// и трейс, в котором таску создали.
+	taskCtx, cancel := context.WithCancel(tm.ctx)
+	tm.cancels[t.TaskID] = cancel
+	tm.wg.Add(1)
+	tm.mu.Unlock()
+
+	logger.Info("starting task", "urls", len(urls))
+	taskCtx = logging.WithLogger(taskCtx, logger)
+	if sc, err := tracing.ParseTraceparent(t.TraceParent); err == nil {
+		taskCtx = tracing.ContextWithRemoteSpanContext(taskCtx, sc)
+	}
+	go func() {
+		defer tm.wg.Done()
+		defer tm.abort(t.TaskID, true)
+		tm.processTask(taskCtx, t.TaskID, urls)
 	}()
+	return nil
+}
+
+// abort отменяет контекст запущенной таски: загрузка и сборка архива
+// обрываются сразу. forget - processTask закончился, отмена больше не нужна.
+func (tm *TaskManager) abort(taskID string, forget bool) {
+	tm.mu.Lock()
+	defer tm.mu.Unlock()
+	if cancel, ok := tm.cancels[taskID]; ok {
+		cancel()
+		if forget {
+			delete(tm.cancels, taskID)
+		}
+	}
+}
+
+// handleStart - запустить таску, не дожидаясь MaxFiles url.
+func (tm *TaskManager) handleStart(ctx context.Context, payload any) error {
+	cmd, ok := payload.(TaskCommand)
+	if !ok {
+		tm.logger.Error("invalid payload type", "handler", "start", "type", fmt.Sprintf("%T", payload))
+		return nil
+	}
+	logger := tm.loggerFor(cmd.Ctx).With("task_id", cmd.TaskID)
+
+	tm.mu.RLock()
+	t, exists := tm.tasks[cmd.TaskID]
+	tm.mu.RUnlock()
+
+	var reply any = "ok"
+	if !exists {
+		reply = ErrTaskNotFound
+	} else if err := tm.startTask(t, logger); err != nil {
+		logger.Info("task not started", "error", err)
+		reply = err
+	}
+
+	select {
+	case cmd.ReplyCh <- reply:
+	case <-ctx.Done():
+		logger.Warn("context cancelled while sending reply", "reply", reply)
+		return ctx.Err()
+	}
+	return nil
+}
+
+// handleCancel - отменить таску. Отмена уже отмененной - не ошибка.
+// У запущенной таски обрывается текущая загрузка (или сборка архива),
+// скачанное удаляется.
+func (tm *TaskManager) handleCancel(ctx context.Context, payload any) error {
+	cmd, ok := payload.(TaskCommand)
+	if !ok {
+		tm.logger.Error("invalid payload type", "handler", "cancel", "type", fmt.Sprintf("%T", payload))
+		return nil
+	}
+	logger := tm.loggerFor(cmd.Ctx).With("task_id", cmd.TaskID)
+
+	tm.mu.RLock()
+	t, exists := tm.tasks[cmd.TaskID]
+	tm.mu.RUnlock()
+
+	var reply any = "ok"
+	switch {
+	case !exists:
+		reply = ErrTaskNotFound
+	case t.CompareAndSetStatus(task.StatusPending, task.StatusCancelled),
+		t.CompareAndSetStatus(task.StatusProcessing, task.StatusCancelled):
+		metrics.TasksCancelled.Inc()
+		tm.abort(cmd.TaskID, false)
+		t.ForgetHeaders()
+		logger.Info("task cancelled")
+	case t.GetStatus() != task.StatusCancelled:
+		reply = ErrTaskSealed
+	}
+
+	select {
+	case cmd.ReplyCh <- reply:
+	case <-ctx.Done():
+		logger.Warn("context cancelled while sending reply", "reply", reply)
+		return ctx.Err()
+	}
+	return nil
 }
 
 // Главный процесс.
-func (tm *TaskManager) processTask(taskID string, urls []string) {
+// ctx несет логгер с task_id, его отменяют CancelTask, RemoveTask и Shutdown.
+func (tm *TaskManager) processTask(ctx context.Context, taskID string, urls []string) {
+	logger := logging.FromContextOr(ctx, tm.logger)
+
 	tm.mu.RLock()
 	t, exists := tm.tasks[taskID]
 	tm.mu.RUnlock()
 	if !exists {
-		tm.logger.Printf("Task %s not found for processing", taskID)
+		logger.Warn("task not found for processing")
 		return
 	}
-	t.SetStatus(task.StatusProcessing)
-	tm.logger.Printf("Processing task %s", taskID)
+	logger.Info("processing task", "urls", len(urls))
+
+	// Архив не собрался (отмена, ошибка, остановка) - от таски на диске
+	// ничего не остается, скачанное уже никому не нужно.
+	defer func() {
+		// Токены нужны были только для загрузок.
+		t.ForgetHeaders()
+		if status := t.GetStatus(); status != task.StatusCompleted {
+			if err := os.RemoveAll(filepath.Join(tm.tmpPath, taskID)); err != nil {
+				logger.Warn("failed to clean up task directory", "status", status, "error", err)
+			}
+		}
+	}()
+
+	ctx, span := tracing.Start(ctx, "task.process", tracing.WithAttrs(
+		tracing.Attr{Key: "task.id", Value: taskID},
+		tracing.Attr{Key: "task.urls", Value: len(urls)},
+		tracing.Attr{Key: "task.queued_ms", Value: time.Since(t.CreatedAt).Milliseconds()},
+	))
+	defer span.End()
+	// Все загрузки таски делят одну полосу TASK_BANDWIDTH_KB.
+	ctx = downloader.WithTask(ctx)
 
 	// Директория для загрузок
-	taskDir := filepath.Join(tm.cfg.TmpPath, taskID, "downloads")
+	taskDir := filepath.Join(tm.tmpPath, taskID, "downloads")
 	if err := os.MkdirAll(taskDir, 0755); err != nil {
-		t.SetStatus(task.StatusFailed)
-		tm.logger.Printf("Failed to create dir for task %s: %v", taskID, err)
-		tm.scheduleCleanup(taskID)
+		tm.fail(t)
+		logger.Error("failed to create task directory", "error", err)
+		return
+	}
+
+	// Шаблон проверен при создании таски.
+	tmpl, err := naming.ParseTemplate(t.NameTemplate)
+	if err != nil {
+		tm.fail(t)
+		logger.Error("bad name template", "template", t.NameTemplate, "error", err)
 		return
 	}
+	paths := t.GetPaths()
+	checksums := t.GetChecksums()
+	dedup := naming.NewDedup(t.Collision)
+	var files []task.FileEntry
+	// В манифест попадают все url, и скачанные, и нет.
+	manifest := archiver.Manifest{TaskID: taskID, Files: make([]archiver.ManifestFile, 0, len(urls))}
+	if t.Manifest {
+		// Имена манифеста заняты заранее: свой manifest.json клиента
+		// переименуется, а не перезапишет наш.
+		dedup.Name(archiver.ReadmeName, naming.Vars{})
+		dedup.Name(archiver.ManifestName, naming.Vars{})
+	}
 
-	var downloadedFiles []string
+	var downloadedFiles []archiver.Entry
 	successfulDownloads := 0
 	failedDownloads := 0
 
 	// Пытаемся скачать urls
-	for _, url := range urls {
-		fileName := filepath.Base(url)
-		destPath := filepath.Join(taskDir, fileName)
+	for i, url := range urls {
+		if status := t.GetStatus(); status != task.StatusProcessing || ctx.Err() != nil {
+			logger.Info("task stopped, stopping downloads", "status", status)
+			return
+		}
+		// На диске файл называется по номеру, имя в архиве - отдельно:
+		// имя из url может быть любым, а путь на диске должен быть безопасным.
+		destPath := filepath.Join(taskDir, fmt.Sprintf("%03d", i+1))
 
-		ctx, cancel := context.WithTimeout(context.Background(), 60*time.Second)
-		err := tm.downloader.Download(ctx, url, destPath)
-		cancel()
+		// Общего дедлайна на файл нет: очередь к хосту, слот и полоса
+		// могут занять сколько угодно, а молчащий сервер загрузчик
+		// бросит сам по своему таймауту.
+		dlCtx := downloader.WithHeaders(logging.With(ctx, "url", logging.RedactURL(url)), t.Headers(url))
+		meta, err := tm.downloader.Download(dlCtx, url, destPath)
+		if err != nil && ctx.Err() != nil {
+			// Таску отменили или сервис останавливается, url тут ни при чем.
+			logger.Info("download aborted", "url", logging.RedactURL(url), "status", t.GetStatus())
+			return
+		}
+		if want, ok := checksums[url]; ok && err == nil && meta.SHA256 != want {
+			err = fmt.Errorf("%w: expected sha256 %s, got %s", errChecksumMismatch, want, meta.SHA256)
+		}
+		downloadedAt := time.Now().UTC()
+		mf := archiver.ManifestFile{URL: url, FinalURL: meta.FinalURL}
 
 		if err != nil {
 			failedDownloads++
+			mf.Error = err.Error()
+			manifest.Files = append(manifest.Files, mf)
 			t.AddError(url, err.Error())
-			tm.logger.Printf("Failed to download %s for task %s: %v", url, taskID, err)
+			logger.Warn("download failed", "url", logging.RedactURL(url), "error", err)
+			// Недокачанный файл или файл с чужим хешем в архив не попадет.
+			_ = os.Remove(destPath)
 			// Удаление url из urls,
 			// чтобы не забивать "очередь".
 			t.Mu.Lock()
@@ -266,30 +779,129 @@ func (tm *TaskManager) processTask(taskID string, urls []string) {
 			continue
 		}
 
+		name, vars := entryName(tmpl, i+1, url, paths[url], meta)
+		// Одинаковые имена (image.jpg с двух хостов) иначе молча
+		// перезаписали бы друг друга при распаковке.
+		entry := task.FileEntry{URL: url, Name: dedup.Name(name, vars), Size: meta.Size, SHA256: meta.SHA256}
+		if entry.Name != name {
+			entry.RenamedFrom = name
+			logger.Info("file renamed to avoid collision", "url", logging.RedactURL(url), "from", name, "to", entry.Name)
+		}
+		files = append(files, entry)
+		mf.Name, mf.Size, mf.SHA256, mf.ContentType = entry.Name, meta.Size, meta.SHA256, meta.ContentType
+		mf.DownloadedAt = &downloadedAt
+		manifest.Files = append(manifest.Files, mf)
 		successfulDownloads++
-		downloadedFiles = append(downloadedFiles, destPath)
+		downloadedFiles = append(downloadedFiles, archiver.Entry{Name: entry.Name, Path: destPath})
 	}
+	t.SetFiles(files)
+
+	span.SetAttr("task.downloaded", successfulDownloads)
+	span.SetAttr("task.failed", failedDownloads)
 
 	if len(downloadedFiles) == 0 {
-		t.SetStatus(task.StatusFailed)
-		tm.logger.Printf("Task %s failed", taskID)
-		tm.scheduleCleanup(taskID)
+		span.RecordError(errors.New("nothing downloaded"))
+		tm.fail(t)
+		logger.Error("task failed: nothing downloaded", "failed", failedDownloads)
 		return
 	}
 
 	// Архивирование.
-	archivePath := filepath.Join(tm.cfg.TmpPath, taskID, "archive.zip")
-	err := tm.archiver.CreateZip(downloadedFiles, archivePath)
+	if t.Manifest {
+		manifest.CreatedAt = time.Now().UTC()
+		entries, err := manifest.Entries()
+		if err != nil {
+			tm.fail(t)
+			logger.Error("failed to build manifest", "error", err)
+			return
+		}
+		downloadedFiles = append(entries, downloadedFiles...)
+	}
+	archivePath := filepath.Join(tm.tmpPath, taskID, "archive.zip")
+	err = tm.archiver.CreateZip(ctx, downloadedFiles, archivePath)
+	if err != nil && ctx.Err() != nil {
+		logger.Info("archiving aborted", "status", t.GetStatus())
+		return
+	}
 	if err != nil {
-		t.SetStatus(task.StatusFailed)
-		tm.logger.Printf("Task %s: archiving failed: %v", taskID, err)
-		tm.scheduleCleanup(taskID)
+		tm.fail(t)
+		span.RecordError(err)
+		logger.Error("archiving failed", "error", err)
 		return
 	}
+	// Хеш архива отдается в статусе и в Digest/ETag при скачивании.
+	sum, err := fileSHA256(archivePath)
+	if err != nil {
+		tm.fail(t)
+		span.RecordError(err)
+		logger.Error("failed to hash archive", "error", err)
+		return
+	}
+	t.SetArchiveSHA256(sum)
 
-	t.SetStatus(task.StatusCompleted)
-	tm.logger.Printf("Task %s: completed, archive ready", taskID)
-	tm.scheduleCleanup(taskID)
+	// Таску могли отменить, пока собирался архив.
+	if !t.CompareAndSetStatus(task.StatusProcessing, task.StatusCompleted) {
+		logger.Info("task finished after cancel, archive discarded", "status", t.GetStatus())
+		return
+	}
+	metrics.TasksCompleted.Inc()
+	logger.Info("task completed", "downloaded", successfulDownloads, "failed", failedDownloads)
+}
+
+// entryName - имя файла в архиве и из чего оно собрано.
+// Имя файла ({name} в шаблоне) берется из Content-Disposition, иначе из пути url;
+// если у него нет расширения (или это скрипт вроде .php), ставится то,
+// что определил загрузчик (например, по Content-Type): /download?id=42
+// и /download.php?id=42 станут download.pdf.
+// target - путь из TaskOptions.Paths: полный путь берется как есть
+// (без расширения - тоже добавляется), "dir/" или пусто -
+// имя по шаблону, в папке dir.
+// {hash} - sha256, посчитанный загрузчиком.
+func entryName(tmpl *naming.Template, index int, rawURL, target string, meta downloader.Meta) (string, naming.Vars) {
+	host, name := naming.FromURL(rawURL)
+	if meta.Filename != "" {
+		name = meta.Filename
+	}
+	// У download.php расширение скрипта, а не файла: меняем на настоящее.
+	if stem, ext := naming.SplitExt(name); ext == "" || (ext != meta.Ext && !downloader.IsFileExt(ext)) {
+		name = stem + meta.Ext
+	}
+	v := naming.Vars{Index: index, Host: host, Name: name, Hash: meta.SHA256}
+
+	if target != "" && !strings.HasSuffix(target, "/") {
+		if path.Ext(target) == "" {
+			// Сегмент мог быть уже 255 байт: с расширением имя снова
+			// через CleanName, иначе addFileToZip отверг бы его.
+			dir, file := path.Split(target)
+			target = dir + naming.CleanName(file+meta.Ext)
+		}
+		return target, v
+	}
+	return target + tmpl.Execute(v), v
+}
+
+// fileSHA256 - sha256 файла в hex, для архива.
+func fileSHA256(name string) (string, error) {
+	f, err := os.Open(name)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// errChecksumMismatch - файл скачался, но sha256 не тот, что ждал клиент.
+var errChecksumMismatch = errors.New("checksum mismatch")
+
+// fail помечает запущенную таску failed, если её не отменили.
+func (tm *TaskManager) fail(t *task.Task) {
+	if t.CompareAndSetStatus(task.StatusProcessing, task.StatusFailed) {
+		metrics.TasksFailed.Inc()
+	}
 }
 
 func (tm *TaskManager) handleStatus(ctx context.Context, payload any) error {
@@ -301,47 +913,348 @@ func (tm *TaskManager) handleStatus(ctx context.Context, payload any) error {
 	t, exists := tm.tasks[cmd.TaskID]
 	tm.mu.RUnlock()
 	if !exists {
-		cmd.ReplyCh <- "not_found" // это не нужно логировать здесь
+		cmd.ReplyCh <- ErrTaskNotFound // это не нужно логировать здесь
 		return nil
 	}
-	cmd.ReplyCh <- t.GetStatus()
+	t.Touch()
+	cmd.ReplyCh <- t.Snapshot()
 	return nil
 }
 
+// handleList - поиск по таскам. Снимок берется в акторе,
+// так что create/add_url/cancel не могут вклиниться посередине.
+func (tm *TaskManager) handleList(ctx context.Context, payload any) error {
+	cmd, ok := payload.(TaskCommand)
+	if !ok {
+		return nil
+	}
+	tm.mu.RLock()
+	snaps := make([]task.Snapshot, 0, len(tm.tasks))
+	for _, t := range tm.tasks {
+		snaps = append(snaps, t.Snapshot())
+	}
+	tm.mu.RUnlock()
+
+	page, err := query(snaps, cmd.Query)
+	if err != nil {
+		cmd.ReplyCh <- err
+		return nil
+	}
+	cmd.ReplyCh <- page
+	return nil
+}
+
+// activeCount - количество тасок в pending/processing, вызывать под tm.mu.
+func (tm *TaskManager) activeCount() int {
+	n := 0
+	for _, t := range tm.tasks {
+		if !t.GetStatus().IsFinished() {
+			n++
+		}
+	}
+	return n
+}
+
+// Tasks возвращает снимок тасок, нужен janitor-у.
+func (tm *TaskManager) Tasks() []*task.Task {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	tasks := make([]*task.Task, 0, len(tm.tasks))
+	for _, t := range tm.tasks {
+		tasks = append(tasks, t)
+	}
+	return tasks
+}
+
+// RemoveTask удаляет таску и её директорию.
+// Запущенная таска отменяется, а директорию processTask вычистит сам,
+// когда бросит загрузку: удалять ее отсюда, пока он пишет, бесполезно.
+func (tm *TaskManager) RemoveTask(taskID string) error {
+	tm.mu.Lock()
+	t, exists := tm.tasks[taskID]
+	delete(tm.tasks, taskID)
+	tm.mu.Unlock()
+
+	if exists && t.CompareAndSetStatus(task.StatusProcessing, task.StatusCancelled) {
+		metrics.TasksCancelled.Inc()
+		tm.abort(taskID, false)
+		return nil
+	}
+	return os.RemoveAll(filepath.Join(tm.tmpPath, taskID))
+}
+
+// ArchivePath возвращает путь к архиву завершенной таски
+// и отмечает обращение, чтобы janitor не выкинул архив, который качают.
+func (tm *TaskManager) ArchivePath(taskID string) (string, bool) {
+	tm.mu.RLock()
+	t, exists := tm.tasks[taskID]
+	tm.mu.RUnlock()
+	if !exists || t.GetStatus() != task.StatusCompleted {
+		return "", false
+	}
+	t.Touch()
+	return filepath.Join(tm.tmpPath, taskID, "archive.zip"), true
+}
+
+// loggerFor - логгер из контекста вызывающего, иначе логгер TaskManager-а.
+func (tm *TaskManager) loggerFor(ctx context.Context) *slog.Logger {
+	return logging.FromContextOr(ctx, tm.logger)
+}
+
 // TODO: DeleteTask
 // TODO: Ref
 // ----- API -----
 // Я устал писать
 
-func (tm *TaskManager) CreateTask(urls []string) (string, error) {
-	reply := make(chan any, 1)
-	tm.actor.Send("create", TaskCommand{URLs: urls, ReplyCh: reply})
-	res := <-reply
-	if id, ok := res.(string); ok && id != "busy" {
-		return id, nil
+// CreateTask создает таску, ctx ограничивает ожидание ответа актора.
+// Ошибки: ErrBusy, ErrShuttingDown, ErrTaskFull, ErrURLRejected, ErrInvalidOptions.
+func (tm *TaskManager) CreateTask(ctx context.Context, urls []string, opts TaskOptions) (string, error) {
+	res, err := tm.ask(ctx, "create", TaskCommand{Ctx: ctx, URLs: urls, Options: opts})
+	if err != nil {
+		return "", err
 	}
+	return replyAs[string](res)
+}
 
-	return "", context.DeadlineExceeded
+// AddURL добавляет urls в таску.
+// Ошибки: ErrTaskNotFound, ErrTaskSealed, ErrTaskFull, ErrURLRejected.
+func (tm *TaskManager) AddURL(ctx context.Context, taskID string, urls []string) error {
+	return tm.AddFiles(ctx, taskID, urls, TaskOptions{})
 }
 
-func (tm *TaskManager) AddURL(taskID string, urls []string) error {
-	reply := make(chan any, 1)
-	tm.actor.Send("add_url", TaskCommand{TaskID: taskID, URLs: urls, ReplyCh: reply})
-	res := <-reply
-	if res == "ok" {
+// AddFiles - как AddURL, плюс пути в архиве и ожидаемые хеши
+// для части urls (opts.Paths, opts.Checksums и opts.Headers, остальное не смотрится).
+// Ошибки: как у AddURL, и ErrInvalidOptions.
+func (tm *TaskManager) AddFiles(ctx context.Context, taskID string, urls []string, opts TaskOptions) error {
+	res, err := tm.ask(ctx, "add_url", TaskCommand{Ctx: ctx, TaskID: taskID, URLs: urls, Options: TaskOptions{Paths: opts.Paths, Checksums: opts.Checksums, Headers: opts.Headers}})
+	if err != nil {
+		return err
+	}
+	_, err = replyAs[string](res)
+	return err
+}
+
+// GetStatus возвращает статус таски.
+// Ошибки: ErrTaskNotFound.
+func (tm *TaskManager) GetStatus(ctx context.Context, taskID string) (task.TaskStatus, error) {
+	snap, err := tm.GetTask(ctx, taskID)
+	if err != nil {
+		return "", err
+	}
+	return snap.Status, nil
+}
+
+// GetTask возвращает снимок таски: статус, url, ошибки.
+// Ошибки: ErrTaskNotFound.
+func (tm *TaskManager) GetTask(ctx context.Context, taskID string) (task.Snapshot, error) {
+	res, err := tm.ask(ctx, "status", TaskCommand{Ctx: ctx, TaskID: taskID})
+	if err != nil {
+		return task.Snapshot{}, err
+	}
+	return replyAs[task.Snapshot](res)
+}
+
+// replyAs разбирает ответ актора: либо ошибка, либо значение типа T.
+func replyAs[T any](res any) (T, error) {
+	var zero T
+	switch v := res.(type) {
+	case error:
+		return zero, v
+	case T:
+		return v, nil
+	default:
+		return zero, fmt.Errorf("unexpected reply from actor: %T", res)
+	}
+}
+
+// ListTasks ищет таски по q и возвращает страницу.
+// Ошибки: ErrInvalidQuery.
+func (tm *TaskManager) ListTasks(ctx context.Context, q Query) (Page, error) {
+	res, err := tm.ask(ctx, "list", TaskCommand{Ctx: ctx, Query: q})
+	if err != nil {
+		return Page{}, err
+	}
+	return replyAs[Page](res)
+}
+
+// StartTask запускает таску, не дожидаясь MaxFiles url.
+// Ошибки: ErrTaskNotFound, ErrTaskEmpty, ErrTaskSealed, ErrShuttingDown.
+func (tm *TaskManager) StartTask(ctx context.Context, taskID string) error {
+	res, err := tm.ask(ctx, "start", TaskCommand{Ctx: ctx, TaskID: taskID})
+	if err != nil {
+		return err
+	}
+	_, err = replyAs[string](res)
+	return err
+}
+
+// CancelTask отменяет таску.
+// Ошибки: ErrTaskNotFound, ErrTaskSealed (таска уже завершилась).
+func (tm *TaskManager) CancelTask(ctx context.Context, taskID string) error {
+	res, err := tm.ask(ctx, "cancel", TaskCommand{Ctx: ctx, TaskID: taskID})
+	if err != nil {
+		return err
+	}
+	_, err = replyAs[string](res)
+	return err
+}
+
+// Shutdown останавливает TaskManager:
+// перестает принимать новые таски, ждет запущенные processTask,
+// пока не истечет ctx. Таски, которые не успели, помечаются failed,
+// чтобы никто не скачал недописанный архив, их загрузки обрываются,
+// и еще до abortWait они убирают за собой. Потом останавливает актора.
+func (tm *TaskManager) Shutdown(ctx context.Context) error {
+	tm.mu.Lock()
+	tm.draining = true
+	tm.mu.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		tm.wg.Wait()
+		close(done)
+	}()
+
+	var err error
+	select {
+	case <-done:
+		tm.logger.Info("all tasks finished")
+	case <-ctx.Done():
+		err = ctx.Err()
+		for _, t := range tm.Tasks() {
+			if t.CompareAndSetStatus(task.StatusProcessing, task.StatusFailed) {
+				t.SetFailureReason("interrupted by shutdown")
+				metrics.TasksFailed.Inc()
+				tm.logger.Warn("task interrupted by shutdown", "task_id", t.TaskID)
+			}
+		}
+		tm.stop()
+		select {
+		case <-done:
+		case <-time.After(abortWait):
+			tm.logger.Warn("tasks did not stop after abort")
+		}
+	}
+
+	tm.stop()
+	tm.actor.Stop()
+	return err
+}
+
+// Draining - идет остановка, новые таски не принимаются.
+func (tm *TaskManager) Draining() bool {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.draining
+}
+
+func (tm *TaskManager) handleStats(ctx context.Context, payload any) error {
+	cmd, ok := payload.(TaskCommand)
+	if !ok {
 		return nil
 	}
+	tm.mu.RLock()
+	stats := Stats{MaxTasks: int(tm.maxTasks)}
+	for _, t := range tm.tasks {
+		switch t.GetStatus() {
+		case task.StatusPending:
+			stats.Pending++
+		case task.StatusProcessing:
+			stats.Processing++
+		case task.StatusCompleted:
+			stats.Completed++
+		case task.StatusFailed:
+			stats.Failed++
+		case task.StatusCancelled:
+			stats.Cancelled++
+		}
+	}
+	tm.mu.RUnlock()
+	stats.SlotsFree = max(stats.MaxTasks-stats.Pending-stats.Processing, 0)
+	cmd.ReplyCh <- stats
+	return nil
+}
 
-	return context.Canceled
+func (tm *TaskManager) handlePing(ctx context.Context, payload any) error {
+	if cmd, ok := payload.(TaskCommand); ok {
+		cmd.ReplyCh <- "pong"
+	}
+	return nil
 }
 
-func (tm *TaskManager) GetStatus(taskID string) (task.TaskStatus, error) {
+// ask отправляет команду актору и ждет ответ не дольше ctx,
+// зависший актор не должен вешать вызывающего. Остановленный актор
+// уже не ответит - ErrShuttingDown сразу.
+func (tm *TaskManager) ask(ctx context.Context, action string, cmd TaskCommand) (any, error) {
 	reply := make(chan any, 1)
-	tm.actor.Send("status", TaskCommand{TaskID: taskID, ReplyCh: reply})
-	res := <-reply
-	if status, ok := res.(task.TaskStatus); ok {
-		return status, nil
+	cmd.ReplyCh = reply
+	if cmd.Ctx == nil {
+		cmd.Ctx = ctx
+	}
+	if err := tm.actor.SendContext(ctx, action, cmd); err != nil {
+		if errors.Is(err, actor.ErrStopped) {
+			return nil, ErrShuttingDown
+		}
+		return nil, err
+	}
+	select {
+	case res := <-reply:
+		return res, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case <-tm.actor.Done():
+		// Актор мог успеть ответить перед остановкой.
+		select {
+		case res := <-reply:
+			return res, nil
+		default:
+			return nil, ErrShuttingDown
+		}
 	}
+}
+
+// Ping проверяет, что цикл актора отвечает.
+func (tm *TaskManager) Ping(ctx context.Context) error {
+	_, err := tm.ask(ctx, "ping", TaskCommand{Ctx: ctx})
+	return err
+}
+
+// Stats возвращает сводку по таскам.
+func (tm *TaskManager) Stats(ctx context.Context) (Stats, error) {
+	res, err := tm.ask(ctx, "stats", TaskCommand{Ctx: ctx})
+	if err != nil {
+		return Stats{}, err
+	}
+	stats, _ := res.(Stats)
+	return stats, nil
+}
 
-	return "", context.Canceled
+// MailboxDepth - сколько команд ждет актора, для метрик.
+func (tm *TaskManager) MailboxDepth() int {
+	return tm.actor.Len()
+}
+
+// SlotsUsed - сколько слотов занято (pending + processing), для метрик.
+// Не через актора, чтобы скрейп работал, даже если актор завис.
+func (tm *TaskManager) SlotsUsed() int {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return tm.activeCount()
+}
+
+// CheckTransport - для /readyz: nil, если транспорт загрузок собрался.
+func (tm *TaskManager) CheckTransport(ctx context.Context) error {
+	return tm.transportErr
+}
+
+// DownloadConnections - сколько загрузок идет сейчас по всем таскам, для метрик.
+func (tm *TaskManager) DownloadConnections() int {
+	return tm.sched.Active()
+}
+
+// MaxTasks - всего слотов.
+func (tm *TaskManager) MaxTasks() int {
+	tm.mu.RLock()
+	defer tm.mu.RUnlock()
+	return int(tm.maxTasks)
 }
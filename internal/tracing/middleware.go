@@ -0,0 +1,68 @@
+package tracing
+
+import (
+	"net/http"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/logging"
+)
+
+// Middleware продолжает трейс из заголовка traceparent (или начинает новый),
+// открывает серверный спан на запрос и добавляет trace_id в логгер запроса.
+// Ставить после logging.Middleware, чтобы логгер с request_id уже был в контексте.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := r.Context()
+		if sc, err := ParseTraceparent(r.Header.Get(TraceparentHeader)); err == nil {
+			ctx = ContextWithRemoteSpanContext(ctx, sc)
+		}
+
+		ctx, span := Start(ctx, r.Method+" "+r.URL.Path, WithKind(KindServer), WithAttrs(
+			Attr{Key: "http.method", Value: r.Method},
+			Attr{Key: "http.target", Value: r.URL.Path},
+		))
+		defer span.End()
+
+		ctx = logging.With(ctx, "trace_id", span.SpanContext().TraceID.String())
+
+		rec := &statusWriter{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttr("http.status_code", rec.status)
+		if rec.status >= 500 {
+			span.RecordError(errorFromStatus(rec.status))
+		}
+	})
+}
+
+type statusWriter struct {
+	http.ResponseWriter
+	status      int
+	wroteHeader bool
+}
+
+func (w *statusWriter) WriteHeader(code int) {
+	if !w.wroteHeader {
+		w.status = code
+		w.wroteHeader = true
+	}
+	w.ResponseWriter.WriteHeader(code)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	w.wroteHeader = true
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+type statusError int
+
+func (e statusError) Error() string {
+	return http.StatusText(int(e))
+}
+
+func errorFromStatus(code int) error {
+	return statusError(code)
+}
@@ -0,0 +1,270 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Небольшая реализация спанов в духе OpenTelemetry, без SDK.
+// Спаны живут в контексте, экспортер решает, куда их отправить
+// (по умолчанию никуда).
+
+// TraceID и SpanID - идентификаторы W3C Trace Context.
+type (
+	TraceID [16]byte
+	SpanID  [8]byte
+)
+
+func (t TraceID) String() string { return hex.EncodeToString(t[:]) }
+func (s SpanID) String() string  { return hex.EncodeToString(s[:]) }
+
+// IsValid - нулевые id по спецификации невалидны.
+func (t TraceID) IsValid() bool { return t != TraceID{} }
+func (s SpanID) IsValid() bool  { return s != SpanID{} }
+
+// SpanContext - то, что передается между процессами (traceparent).
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Sampled bool
+}
+
+// IsValid - контекст можно использовать как родителя.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID.IsValid() && sc.SpanID.IsValid()
+}
+
+// SpanKind - как в OTLP.
+type SpanKind int
+
+const (
+	KindInternal SpanKind = 1
+	KindServer   SpanKind = 2
+	KindClient   SpanKind = 3
+)
+
+// Attr - атрибут спана, значение string, bool, int/int64 или float64.
+type Attr struct {
+	Key   string
+	Value any
+}
+
+// SpanData - законченный спан, то что получает экспортер.
+type SpanData struct {
+	Name        string
+	Kind        SpanKind
+	SpanContext SpanContext
+	Parent      SpanID
+	Start       time.Time
+	End         time.Time
+	Attrs       []Attr
+	Error       string // Пусто - ошибки не было.
+}
+
+// Span - спан в процессе записи. Методы безопасны для nil.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// SpanContext возвращает идентификаторы спана.
+func (s *Span) SpanContext() SpanContext {
+	if s == nil {
+		return SpanContext{}
+	}
+	return s.data.SpanContext
+}
+
+// SetAttr добавляет атрибут.
+func (s *Span) SetAttr(key string, value any) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Attrs = append(s.data.Attrs, Attr{Key: key, Value: value})
+}
+
+// RecordError помечает спан ошибкой, nil игнорируется.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End завершает спан и отдает его экспортеру. Повторный вызов ничего не делает.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	data := s.data
+	data.Attrs = append([]Attr(nil), s.data.Attrs...)
+	s.mu.Unlock()
+
+	if s.data.SpanContext.Sampled {
+		s.tracer.exporter.Export(data)
+	}
+}
+
+// Exporter получает законченные спаны.
+type Exporter interface {
+	Export(span SpanData)
+	Shutdown(ctx context.Context) error
+}
+
+// NoopExporter выбрасывает спаны, по умолчанию.
+type NoopExporter struct{}
+
+func (NoopExporter) Export(SpanData)                    {}
+func (NoopExporter) Shutdown(ctx context.Context) error { return nil }
+
+// Tracer создает спаны.
+type Tracer struct {
+	exporter Exporter
+}
+
+// Конструктор трейсера, exporter == nil - NoopExporter.
+func NewTracer(exporter Exporter) *Tracer {
+	if exporter == nil {
+		exporter = NoopExporter{}
+	}
+	return &Tracer{exporter: exporter}
+}
+
+// Shutdown дописывает оставшиеся спаны.
+func (t *Tracer) Shutdown(ctx context.Context) error {
+	return t.exporter.Shutdown(ctx)
+}
+
+// StartOption - опции старта спана.
+type StartOption func(*SpanData)
+
+// WithKind задает вид спана.
+func WithKind(kind SpanKind) StartOption {
+	return func(d *SpanData) { d.Kind = kind }
+}
+
+// WithAttrs задает атрибуты сразу при старте.
+func WithAttrs(attrs ...Attr) StartOption {
+	return func(d *SpanData) { d.Attrs = append(d.Attrs, attrs...) }
+}
+
+// WithStartTime - если спан начался раньше, чем его создали (ожидание в очереди).
+func WithStartTime(start time.Time) StartOption {
+	return func(d *SpanData) { d.Start = start }
+}
+
+// Start создает дочерний спан от спана в ctx (или от удаленного родителя),
+// если родителя нет - начинает новый трейс.
+func (t *Tracer) Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	parent := SpanContextFromContext(ctx)
+
+	data := SpanData{Name: name, Kind: KindInternal, Start: time.Now()}
+	data.SpanContext.SpanID = newSpanID()
+	if parent.IsValid() {
+		data.SpanContext.TraceID = parent.TraceID
+		data.SpanContext.Sampled = parent.Sampled
+		data.Parent = parent.SpanID
+	} else {
+		data.SpanContext.TraceID = newTraceID()
+		data.SpanContext.Sampled = true
+	}
+	for _, opt := range opts {
+		opt(&data)
+	}
+
+	span := &Span{tracer: t, data: data}
+	return ContextWithSpan(ctx, span), span
+}
+
+// ----- Глобальный трейсер, как slog.Default -----
+
+var defaultTracer atomic.Pointer[Tracer]
+
+func init() {
+	defaultTracer.Store(NewTracer(nil))
+}
+
+// SetDefault задает трейсер для пакетной функции Start.
+func SetDefault(t *Tracer) {
+	defaultTracer.Store(t)
+}
+
+// Default - текущий трейсер по умолчанию.
+func Default() *Tracer {
+	return defaultTracer.Load()
+}
+
+// Start - Default().Start.
+func Start(ctx context.Context, name string, opts ...StartOption) (context.Context, *Span) {
+	return Default().Start(ctx, name, opts...)
+}
+
+// ----- Контекст -----
+
+type spanKey struct{}
+type remoteKey struct{}
+
+// ContextWithSpan кладет спан в контекст.
+func ContextWithSpan(ctx context.Context, span *Span) context.Context {
+	return context.WithValue(ctx, spanKey{}, span)
+}
+
+// SpanFromContext достает текущий спан, может вернуть nil.
+func SpanFromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// ContextWithRemoteSpanContext - родитель пришел снаружи (traceparent)
+// или сохранен заранее (в таске).
+func ContextWithRemoteSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, remoteKey{}, sc)
+}
+
+// SpanContextFromContext - контекст текущего спана, или удаленного родителя.
+func SpanContextFromContext(ctx context.Context) SpanContext {
+	if ctx == nil {
+		return SpanContext{}
+	}
+	if span := SpanFromContext(ctx); span != nil {
+		return span.SpanContext()
+	}
+	sc, _ := ctx.Value(remoteKey{}).(SpanContext)
+	return sc
+}
+
+func newTraceID() TraceID {
+	var id TraceID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
+
+func newSpanID() SpanID {
+	var id SpanID
+	for !id.IsValid() {
+		_, _ = rand.Read(id[:])
+	}
+	return id
+}
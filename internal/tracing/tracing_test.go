@@ -0,0 +1,137 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestParseTraceparent(t *testing.T) {
+	header := "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+	sc, err := ParseTraceparent(header)
+
+	if err != nil {
+		t.Fatalf("Expected no error, got %v", err)
+	}
+	if sc.TraceID.String() != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Errorf("Unexpected trace id %s", sc.TraceID)
+	}
+	if sc.SpanID.String() != "00f067aa0ba902b7" {
+		t.Errorf("Unexpected span id %s", sc.SpanID)
+	}
+	if !sc.Sampled {
+		t.Error("Expected sampled flag")
+	}
+	if sc.Traceparent() != header {
+		t.Errorf("Expected round trip %s, got %s", header, sc.Traceparent())
+	}
+}
+
+func TestParseTraceparent_Invalid(t *testing.T) {
+	invalid := []string{
+		"",
+		"garbage",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01", // Нулевой trace id.
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01", // Нулевой span id.
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", // Запрещенная версия.
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", // Только нижний регистр.
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	}
+	for _, h := range invalid {
+		if _, err := ParseTraceparent(h); err == nil {
+			t.Errorf("Expected error for %q", h)
+		}
+	}
+}
+
+// recorder - экспортер, который запоминает спаны.
+type recorder struct {
+	mu    sync.Mutex
+	spans []SpanData
+}
+
+func (r *recorder) Export(s SpanData) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, s)
+}
+
+func (r *recorder) Shutdown(context.Context) error { return nil }
+
+func TestTracer_ParentChild(t *testing.T) {
+	rec := &recorder{}
+	tracer := NewTracer(rec)
+	remote, _ := ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+
+	ctx := ContextWithRemoteSpanContext(context.Background(), remote)
+	ctx, parent := tracer.Start(ctx, "parent")
+	_, child := tracer.Start(ctx, "child")
+	child.RecordError(errors.New("boom"))
+	child.End()
+	parent.End()
+	parent.End() // Повторный End не должен экспортировать еще раз.
+
+	if len(rec.spans) != 2 {
+		t.Fatalf("Expected 2 spans, got %d", len(rec.spans))
+	}
+	c, p := rec.spans[0], rec.spans[1]
+	if p.SpanContext.TraceID != remote.TraceID || p.Parent != remote.SpanID {
+		t.Error("Expected parent span to continue remote trace")
+	}
+	if c.SpanContext.TraceID != remote.TraceID || c.Parent != p.SpanContext.SpanID {
+		t.Error("Expected child span to be a child of parent")
+	}
+	if c.Error != "boom" {
+		t.Errorf("Expected error 'boom', got '%s'", c.Error)
+	}
+}
+
+func TestOTLPExporter(t *testing.T) {
+	bodies := make(chan []byte, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/traces" {
+			t.Errorf("Unexpected path %s", r.URL.Path)
+		}
+		body, _ := io.ReadAll(r.Body)
+		bodies <- body
+	}))
+	defer srv.Close()
+
+	exp := NewOTLPExporter(srv.URL, "test-service", nil)
+	tracer := NewTracer(exp)
+	_, span := tracer.Start(context.Background(), "work", WithAttrs(Attr{Key: "n", Value: 3}))
+	span.End()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := tracer.Shutdown(ctx); err != nil {
+		t.Fatalf("Shutdown failed: %v", err)
+	}
+
+	var req otlpRequest
+	select {
+	case body := <-bodies:
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Fatalf("Invalid JSON: %v", err)
+		}
+	default:
+		t.Fatal("Expected exporter to send spans on shutdown")
+	}
+	spans := req.ResourceSpans[0].ScopeSpans[0].Spans
+	if len(spans) != 1 || spans[0].Name != "work" {
+		t.Fatalf("Unexpected spans: %+v", spans)
+	}
+	if *req.ResourceSpans[0].Resource.Attributes[0].Value.StringValue != "test-service" {
+		t.Error("Expected service.name resource attribute")
+	}
+	if *spans[0].Attributes[0].Value.IntValue != "3" {
+		t.Error("Expected int attribute encoded as string")
+	}
+}
@@ -0,0 +1,154 @@
+// Package client - Go клиент для API архиватора (/api/v1).
+//
+//	c := client.NewClient("http://localhost:8080")
+//	t, err := c.CreateTask(ctx, "https://example.com/a.pdf")
+//	t, err = c.WaitForCompletion(ctx, t.TaskID)
+//	_, err = c.Download(ctx, t.TaskID, file)
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const apiPrefix = "/api/v1"
+
+// Client - клиент API, безопасен для использования из нескольких горутин.
+type Client struct {
+	baseURL      string
+	httpClient   *http.Client
+	maxRetries   int
+	retryWait    time.Duration
+	pollInterval time.Duration
+	owner        string
+}
+
+// Option - настройка клиента.
+type Option func(*Client)
+
+// WithHTTPClient - свой http.Client (таймауты, транспорт).
+func WithHTTPClient(hc *http.Client) Option {
+	return func(c *Client) { c.httpClient = hc }
+}
+
+// WithRetries - сколько раз повторять запрос на 429 и сколько ждать,
+// если сервер не прислал Retry-After.
+func WithRetries(n int, wait time.Duration) Option {
+	return func(c *Client) {
+		c.maxRetries = n
+		c.retryWait = wait
+	}
+}
+
+// WithPollInterval - как часто WaitForCompletion спрашивает статус.
+func WithPollInterval(d time.Duration) Option {
+	return func(c *Client) { c.pollInterval = d }
+}
+
+// WithOwner - владелец новых тасок, по нему потом можно искать в ListTasks.
+func WithOwner(owner string) Option {
+	return func(c *Client) { c.owner = owner }
+}
+
+// Конструктор клиента:
+// baseURL - адрес сервиса, например http://localhost:8080,
+// opts - настройки.
+func NewClient(baseURL string, opts ...Option) *Client {
+	c := &Client{
+		baseURL:      strings.TrimRight(baseURL, "/"),
+		httpClient:   http.DefaultClient,
+		maxRetries:   3,
+		retryWait:    time.Second,
+		pollInterval: time.Second,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// do выполняет запрос и повторяет его на 429.
+// Тело ответа закрывает вызывающий, если ошибки нет.
+func (c *Client) do(ctx context.Context, method, path string, in any) (*http.Response, error) {
+	var body []byte
+	if in != nil {
+		var err error
+		if body, err = json.Marshal(in); err != nil {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, method, c.baseURL+path, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		if in != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, err := c.httpClient.Do(req)
+		if err != nil {
+			return nil, err
+		}
+		if resp.StatusCode < 400 {
+			return resp, nil
+		}
+
+		apiErr := readError(resp)
+		if resp.StatusCode != http.StatusTooManyRequests || attempt >= c.maxRetries {
+			return nil, apiErr
+		}
+
+		wait := c.retryWait
+		if s, err := strconv.Atoi(resp.Header.Get("Retry-After")); err == nil && s >= 0 {
+			wait = time.Duration(s) * time.Second
+		}
+		select {
+		case <-time.After(wait):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+}
+
+// readError разбирает тело ошибки и закрывает его.
+func readError(resp *http.Response) *APIError {
+	defer resp.Body.Close()
+
+	var body struct {
+		Error APIError `json:"error"`
+	}
+	data, _ := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	apiErr := &body.Error
+	if err := json.Unmarshal(data, &body); err != nil || apiErr.Code == "" {
+		// Не наш формат, например прокси перед сервисом.
+		apiErr.Code = "http_" + strconv.Itoa(resp.StatusCode)
+		apiErr.Message = strings.TrimSpace(string(data))
+		if apiErr.Message == "" {
+			apiErr.Message = resp.Status
+		}
+	}
+	apiErr.StatusCode = resp.StatusCode
+	return apiErr
+}
+
+// doJSON выполняет запрос и декодирует ответ в out.
+func (c *Client) doJSON(ctx context.Context, method, path string, in, out any) error {
+	resp, err := c.do(ctx, method, path, in)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("archiver: decode response: %w", err)
+	}
+	return nil
+}
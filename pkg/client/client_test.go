@@ -0,0 +1,274 @@
+package client
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/api"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/internal/taskmanager"
+	"gitlab.com/Nikolay-Yakunin/2025-08-06/pkg/config"
+)
+
+// newTestClient поднимает настоящие обработчики сервиса на httptest.
+func newTestClient(t *testing.T, maxTasks int8) *Client {
+	t.Helper()
+	cfg := config.NewConfig()
+	cfg.TmpPath = t.TempDir()
+	cfg.MaxTasks = maxTasks
+	cfg.MaxFiles = 3
+	cfg.AllowedExtensions = []string{".pdf", ".jpg"}
+
+	tm := taskmanager.NewTaskManager(cfg, nil)
+	srv := httptest.NewServer(api.NewServer(tm, nil, "test").Handler())
+	t.Cleanup(func() {
+		srv.Close()
+		_ = tm.Shutdown(context.Background())
+	})
+	return NewClient(srv.URL, WithPollInterval(10*time.Millisecond), WithRetries(0, 0))
+}
+
+// newFileServer отдает файлы, которые будет качать сервис.
+func newFileServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a.pdf", "/b.jpg":
+			_, _ = w.Write([]byte("content of " + r.URL.Path))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestCreateStartWaitDownload(t *testing.T) {
+	c := newTestClient(t, 3)
+	files := newFileServer(t)
+	ctx := context.Background()
+
+	task, err := c.CreateTask(ctx, files.URL+"/a.pdf")
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	if task.Status != StatusPending {
+		t.Errorf("Expected pending, got %s", task.Status)
+	}
+	if task, err = c.AddURLs(ctx, task.TaskID, files.URL+"/b.jpg"); err != nil {
+		t.Fatalf("AddURLs: %v", err)
+	}
+	if len(task.URLs) != 2 {
+		t.Errorf("Expected 2 urls, got %v", task.URLs)
+	}
+	if _, err := c.Start(ctx, task.TaskID); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	task, err = c.WaitForCompletion(waitCtx, task.TaskID)
+	if err != nil {
+		t.Fatalf("WaitForCompletion: %v", err)
+	}
+	if task.Status != StatusCompleted {
+		t.Fatalf("Expected completed, got %s (%v)", task.Status, task.Errors)
+	}
+
+	var buf bytes.Buffer
+	n, err := c.Download(ctx, task.TaskID, &buf)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), n)
+	if err != nil {
+		t.Fatalf("Expected zip archive: %v", err)
+	}
+	// 2 файла и README.txt с manifest.json.
+	if len(zr.File) != 4 || zr.File[1].Name != "manifest.json" {
+		t.Errorf("Expected 2 files and the manifest in archive, got %d", len(zr.File))
+	}
+	// Download сверил архив с Digest, хеш тот же, что в статусе.
+	sum := sha256.Sum256(buf.Bytes())
+	if task.ArchiveSHA256 != hex.EncodeToString(sum[:]) {
+		t.Errorf("Expected archive_sha256 of the downloaded archive, got %q", task.ArchiveSHA256)
+	}
+}
+
+func TestCreateTaskWith_Names(t *testing.T) {
+	c := newTestClient(t, 3)
+	files := newFileServer(t)
+	ctx := context.Background()
+
+	task, err := c.CreateTaskWith(ctx, []string{files.URL + "/a.pdf"}, CreateOptions{
+		ArchiveName:  "scans",
+		NameTemplate: "{index:2}-{name}",
+		Paths:        map[string]string{files.URL + "/a.pdf": "invoice-2026-10/01-scan.pdf"},
+		Manifest:     new(bool),
+	})
+	if err != nil {
+		t.Fatalf("CreateTaskWith: %v", err)
+	}
+	if task.ArchiveName != "scans.zip" {
+		t.Errorf("Expected scans.zip, got %q", task.ArchiveName)
+	}
+	if _, err := c.AddFiles(ctx, task.TaskID, []string{files.URL + "/b.jpg"}, AddOptions{Paths: map[string]string{files.URL + "/b.jpg": "images/"}}); err != nil {
+		t.Fatalf("AddFiles: %v", err)
+	}
+	if _, err := c.Start(ctx, task.TaskID); err != nil {
+		t.Fatalf("Start: %v", err)
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, 5*time.Second)
+	defer cancel()
+	if task, err = c.WaitForCompletion(waitCtx, task.TaskID); err != nil || task.Status != StatusCompleted {
+		t.Fatalf("Expected completed, got %v %v", task, err)
+	}
+
+	var buf bytes.Buffer
+	n, err := c.Download(ctx, task.TaskID, &buf)
+	if err != nil {
+		t.Fatalf("Download: %v", err)
+	}
+	zr, err := zip.NewReader(bytes.NewReader(buf.Bytes()), n)
+	if err != nil {
+		t.Fatalf("Expected zip archive: %v", err)
+	}
+	want := []string{"invoice-2026-10/01-scan.pdf", "images/02-b.jpg"}
+	if len(zr.File) != len(want) {
+		t.Fatalf("Expected %d files, got %d", len(want), len(zr.File))
+	}
+	for i, f := range zr.File {
+		if f.Name != want[i] {
+			t.Errorf("Expected entry %q, got %q", want[i], f.Name)
+		}
+	}
+}
+
+func TestErrors(t *testing.T) {
+	c := newTestClient(t, 3)
+	ctx := context.Background()
+
+	if _, err := c.Status(ctx, "nope"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	task, err := c.CreateTask(ctx)
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	if _, err := c.Start(ctx, task.TaskID); !errors.Is(err, ErrTaskEmpty) {
+		t.Errorf("Expected ErrTaskEmpty, got %v", err)
+	}
+
+	_, err = c.AddURLs(ctx, task.TaskID, "http://example.com/a.exe")
+	var apiErr *APIError
+	if !errors.As(err, &apiErr) || !errors.Is(err, ErrURLRejected) {
+		t.Fatalf("Expected ErrURLRejected, got %v", err)
+	}
+	if apiErr.StatusCode != http.StatusUnprocessableEntity || apiErr.Details["reason"] == nil {
+		t.Errorf("Unexpected error: %+v", apiErr)
+	}
+
+	var buf bytes.Buffer
+	if _, err := c.Download(ctx, task.TaskID, &buf); !errors.Is(err, ErrArchiveNotReady) {
+		t.Errorf("Expected ErrArchiveNotReady, got %v", err)
+	}
+}
+
+func TestCancel(t *testing.T) {
+	c := newTestClient(t, 1)
+	ctx := context.Background()
+
+	task, err := c.CreateTask(ctx)
+	if err != nil {
+		t.Fatalf("CreateTask: %v", err)
+	}
+	// Единственный слот занят.
+	if _, err := c.CreateTask(ctx); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("Expected ErrServerBusy, got %v", err)
+	}
+
+	if task, err = c.Cancel(ctx, task.TaskID); err != nil {
+		t.Fatalf("Cancel: %v", err)
+	}
+	if task.Status != StatusCancelled {
+		t.Errorf("Expected cancelled, got %s", task.Status)
+	}
+	if task, err = c.WaitForCompletion(ctx, task.TaskID); err != nil || task.Status != StatusCancelled {
+		t.Errorf("Expected cancelled task, got %v, %v", task, err)
+	}
+	if _, err := c.CreateTask(ctx); err != nil {
+		t.Errorf("Expected free slot after cancel, got %v", err)
+	}
+
+	page, err := c.ListTasks(ctx, ListOptions{})
+	if err != nil {
+		t.Fatalf("ListTasks: %v", err)
+	}
+	if len(page.Tasks) != 2 || page.Tasks[1].TaskID != task.TaskID {
+		t.Errorf("Expected cancelled task last of 2, got %+v", page.Tasks)
+	}
+	page, err = c.ListTasks(ctx, ListOptions{Statuses: []Status{StatusCancelled}})
+	if err != nil {
+		t.Fatalf("ListTasks: %v", err)
+	}
+	if len(page.Tasks) != 1 || page.Tasks[0].TaskID != task.TaskID {
+		t.Errorf("Expected only cancelled task, got %+v", page.Tasks)
+	}
+}
+
+func TestRetryOn429(t *testing.T) {
+	var calls atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if calls.Add(1) < 3 {
+			w.Header().Set("Retry-After", "0")
+			w.WriteHeader(http.StatusTooManyRequests)
+			_, _ = w.Write([]byte(`{"error":{"code":"server_busy","message":"server busy"}}`))
+			return
+		}
+		w.WriteHeader(http.StatusCreated)
+		_, _ = w.Write([]byte(`{"task_id":"42","status":"pending"}`))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL, WithRetries(3, time.Millisecond))
+	task, err := c.CreateTask(context.Background())
+	if err != nil {
+		t.Fatalf("Expected retries to succeed, got %v", err)
+	}
+	if task.TaskID != "42" || calls.Load() != 3 {
+		t.Errorf("Expected task 42 after 3 calls, got %q after %d", task.TaskID, calls.Load())
+	}
+
+	// Без повторов 429 сразу отдается вызывающему.
+	calls.Store(0)
+	c = NewClient(srv.URL, WithRetries(0, 0))
+	if _, err := c.CreateTask(context.Background()); !errors.Is(err, ErrServerBusy) {
+		t.Errorf("Expected ErrServerBusy, got %v", err)
+	}
+}
+
+func TestDownload_DigestMismatch(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// sha-256 от "other", а не от того, что отдается.
+		w.Header().Set("Repr-Digest", "sha-256=:2SmKENGwc1g33EvYXaxkGw887yekfl1TpU8vP1svz/o=:")
+		_, _ = w.Write([]byte("zip"))
+	}))
+	defer srv.Close()
+
+	c := NewClient(srv.URL)
+	var buf bytes.Buffer
+	if _, err := c.Download(context.Background(), "42", &buf); !errors.Is(err, ErrDigestMismatch) {
+		t.Errorf("Expected ErrDigestMismatch, got %v", err)
+	}
+}
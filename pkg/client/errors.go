@@ -0,0 +1,41 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+)
+
+// APIError - ошибка, которую вернул сервис ({"error": {...}}).
+// Сравнивать удобно через errors.Is с ErrNotFound и т.п.
+type APIError struct {
+	StatusCode int            `json:"-"` // HTTP статус ответа.
+	Code       string         `json:"code"`
+	Message    string         `json:"message"`
+	Details    map[string]any `json:"details,omitempty"`
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("archiver: %s (%d %s)", e.Message, e.StatusCode, e.Code)
+}
+
+// Is сравнивает по коду ошибки: errors.Is(err, client.ErrTaskFull).
+func (e *APIError) Is(target error) bool {
+	t, ok := target.(*APIError)
+	return ok && t.Code == e.Code
+}
+
+// Ошибки API по кодам, только для errors.Is.
+var (
+	ErrInvalidRequest  = &APIError{Code: "invalid_request"}
+	ErrNotFound        = &APIError{Code: "not_found"}
+	ErrTaskFull        = &APIError{Code: "task_full"}
+	ErrTaskSealed      = &APIError{Code: "task_sealed"}
+	ErrTaskEmpty       = &APIError{Code: "task_empty"}
+	ErrURLRejected     = &APIError{Code: "url_rejected"}
+	ErrServerBusy      = &APIError{Code: "server_busy"}
+	ErrShuttingDown    = &APIError{Code: "shutting_down"}
+	ErrArchiveNotReady = &APIError{Code: "archive_not_ready"}
+)
+
+// ErrDigestMismatch - скачанный архив не совпал с sha256 из ответа сервиса.
+var ErrDigestMismatch = errors.New("archiver: archive digest mismatch")
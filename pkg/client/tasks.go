@@ -0,0 +1,327 @@
+package client
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Status - статус таски.
+type Status string
+
+// Статусы таски.
+const (
+	StatusPending    Status = "pending"
+	StatusProcessing Status = "processing"
+	StatusCompleted  Status = "completed"
+	StatusFailed     Status = "failed"
+	StatusCancelled  Status = "cancelled"
+)
+
+// IsFinished - таска больше не будет меняться.
+func (s Status) IsFinished() bool {
+	return s == StatusCompleted || s == StatusFailed || s == StatusCancelled
+}
+
+// FileError - url, который не удалось скачать.
+type FileError struct {
+	URL   string `json:"url"`
+	Error string `json:"error"`
+}
+
+// Task - состояние таски.
+type Task struct {
+	TaskID      string      `json:"task_id"`
+	Status      Status      `json:"status"`
+	URLs        []string    `json:"urls"`
+	MaxFiles    int         `json:"max_files"`
+	Errors      []FileError `json:"errors"`
+	Owner       string      `json:"owner,omitempty"`
+	CreatedAt   time.Time   `json:"created_at"`
+	UpdatedAt   time.Time   `json:"updated_at"`
+	DownloadURL string      `json:"download_url,omitempty"`
+	// Почему failed целиком, например "interrupted by shutdown".
+	FailureReason string `json:"failure_reason,omitempty"`
+
+	ArchiveName  string            `json:"archive_name,omitempty"`
+	NameTemplate string            `json:"name_template,omitempty"`
+	Paths        map[string]string `json:"paths,omitempty"`
+	Collision    string            `json:"collision,omitempty"`
+	Manifest     bool              `json:"manifest"`
+	Checksums    map[string]string `json:"checksums,omitempty"`
+	Files        []FileEntry       `json:"files,omitempty"`
+
+	ArchiveSHA256 string `json:"archive_sha256,omitempty"` // Есть у completed.
+	// url -> имена заголовков из CreateOptions.Headers, значения всегда "***".
+	Headers map[string]map[string]string `json:"headers,omitempty"`
+}
+
+// FileEntry - под каким именем url лег в архив.
+type FileEntry struct {
+	URL         string `json:"url"`
+	Name        string `json:"name"`
+	RenamedFrom string `json:"renamed_from,omitempty"` // Есть, если имя пришлось поменять из-за коллизии.
+	Size        int64  `json:"size"`
+	SHA256      string `json:"sha256"`
+}
+
+// Как разводить одинаковые имена в архиве, CreateOptions.Collision.
+const (
+	CollisionSuffix = "suffix" // image.jpg, image-2.jpg (по умолчанию).
+	CollisionHost   = "host"   // image.jpg, cdn.example.com-image.jpg.
+	CollisionHash   = "hash"   // image.jpg, image-1a2b3c4d.jpg.
+)
+
+// CreateOptions - необязательные параметры CreateTaskWith.
+type CreateOptions struct {
+	ArchiveName  string            // Имя архива при скачивании, по умолчанию archive.zip.
+	NameTemplate string            // Шаблон имен файлов, например "{index:2}-{name}".
+	Paths        map[string]string // url -> путь в архиве, "dir/" - папка.
+	Collision    string            // CollisionSuffix, CollisionHost или CollisionHash.
+	Manifest     *bool             // manifest.json и README.txt в архиве, nil - как настроен сервер.
+	Checksums    map[string]string // url -> ожидаемый sha256, файл с другим в архив не попадет.
+	// url -> заголовок -> значение для закрытых источников: Authorization, Cookie.
+	// Сервер держит их только в памяти и шлет только на хост url.
+	Headers map[string]map[string]string
+}
+
+// AddOptions - необязательные параметры AddFiles, только для добавляемых url.
+type AddOptions struct {
+	Paths     map[string]string            // url -> путь в архиве, "dir/" - папка.
+	Checksums map[string]string            // url -> ожидаемый sha256.
+	Headers   map[string]map[string]string // url -> заголовок -> значение.
+}
+
+func taskPath(taskID string, suffix string) string {
+	return apiPrefix + "/tasks/" + url.PathEscape(taskID) + suffix
+}
+
+// CreateTask создает таску, url можно передать сразу.
+// Если передано MaxFiles url, таска сразу стартует.
+// Владелец берется из WithOwner.
+func (c *Client) CreateTask(ctx context.Context, urls ...string) (*Task, error) {
+	return c.CreateTaskWith(ctx, urls, CreateOptions{})
+}
+
+// CreateTaskWith - CreateTask с именем архива, шаблоном и путями в архиве.
+func (c *Client) CreateTaskWith(ctx context.Context, urls []string, opts CreateOptions) (*Task, error) {
+	var t Task
+	body := struct {
+		URLs         []string          `json:"urls,omitempty"`
+		Owner        string            `json:"owner,omitempty"`
+		ArchiveName  string            `json:"archive_name,omitempty"`
+		NameTemplate string            `json:"name_template,omitempty"`
+		Paths        map[string]string `json:"paths,omitempty"`
+		Collision    string            `json:"collision,omitempty"`
+		Manifest     *bool             `json:"manifest,omitempty"`
+		Checksums    map[string]string `json:"checksums,omitempty"`
+
+		Headers map[string]map[string]string `json:"headers,omitempty"`
+	}{
+		URLs:         urls,
+		Owner:        c.owner,
+		ArchiveName:  opts.ArchiveName,
+		NameTemplate: opts.NameTemplate,
+		Paths:        opts.Paths,
+		Collision:    opts.Collision,
+		Manifest:     opts.Manifest,
+		Checksums:    opts.Checksums,
+		Headers:      opts.Headers,
+	}
+	if err := c.doJSON(ctx, http.MethodPost, apiPrefix+"/tasks", body, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// AddURLs добавляет url в таску: все или ни одного.
+func (c *Client) AddURLs(ctx context.Context, taskID string, urls ...string) (*Task, error) {
+	return c.AddFiles(ctx, taskID, urls, AddOptions{})
+}
+
+// AddFiles - AddURLs с путями в архиве, ожидаемыми хешами и заголовками для части url.
+func (c *Client) AddFiles(ctx context.Context, taskID string, urls []string, opts AddOptions) (*Task, error) {
+	var t Task
+	body := struct {
+		URLs      []string                     `json:"urls"`
+		Paths     map[string]string            `json:"paths,omitempty"`
+		Checksums map[string]string            `json:"checksums,omitempty"`
+		Headers   map[string]map[string]string `json:"headers,omitempty"`
+	}{URLs: urls, Paths: opts.Paths, Checksums: opts.Checksums, Headers: opts.Headers}
+	if err := c.doJSON(ctx, http.MethodPost, taskPath(taskID, "/urls"), body, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Start запускает таску, не дожидаясь MaxFiles url.
+func (c *Client) Start(ctx context.Context, taskID string) (*Task, error) {
+	var t Task
+	if err := c.doJSON(ctx, http.MethodPost, taskPath(taskID, "/start"), nil, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Status возвращает состояние таски.
+func (c *Client) Status(ctx context.Context, taskID string) (*Task, error) {
+	var t Task
+	if err := c.doJSON(ctx, http.MethodGet, taskPath(taskID, ""), nil, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// Сортировки для ListOptions.Sort, "-" впереди - по убыванию.
+const (
+	SortCreatedAsc  = "created_at"
+	SortCreatedDesc = "-created_at"
+	SortUpdatedAsc  = "updated_at"
+	SortUpdatedDesc = "-updated_at"
+)
+
+// ListOptions - фильтры для ListTasks, пустые поля не фильтруют.
+type ListOptions struct {
+	Statuses      []Status
+	Owner         string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	HasErrors     *bool
+	Sort          string // По умолчанию SortCreatedDesc.
+	Limit         int    // По умолчанию решает сервер.
+	Cursor        string // TaskPage.NextCursor предыдущей страницы.
+}
+
+func (o ListOptions) values() url.Values {
+	v := url.Values{}
+	if len(o.Statuses) > 0 {
+		statuses := make([]string, len(o.Statuses))
+		for i, s := range o.Statuses {
+			statuses[i] = string(s)
+		}
+		v.Set("status", strings.Join(statuses, ","))
+	}
+	if o.Owner != "" {
+		v.Set("owner", o.Owner)
+	}
+	if !o.CreatedAfter.IsZero() {
+		v.Set("created_after", o.CreatedAfter.Format(time.RFC3339Nano))
+	}
+	if !o.CreatedBefore.IsZero() {
+		v.Set("created_before", o.CreatedBefore.Format(time.RFC3339Nano))
+	}
+	if o.HasErrors != nil {
+		v.Set("has_errors", strconv.FormatBool(*o.HasErrors))
+	}
+	if o.Sort != "" {
+		v.Set("sort", o.Sort)
+	}
+	if o.Limit > 0 {
+		v.Set("limit", strconv.Itoa(o.Limit))
+	}
+	if o.Cursor != "" {
+		v.Set("cursor", o.Cursor)
+	}
+	return v
+}
+
+// TaskPage - страница ListTasks. NextCursor пустой на последней странице.
+type TaskPage struct {
+	Tasks      []Task `json:"tasks"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// ListTasks ищет таски, по умолчанию новые сверху.
+// Следующую страницу берите с Cursor = NextCursor.
+func (c *Client) ListTasks(ctx context.Context, opts ListOptions) (*TaskPage, error) {
+	path := apiPrefix + "/tasks"
+	if q := opts.values().Encode(); q != "" {
+		path += "?" + q
+	}
+	var page TaskPage
+	if err := c.doJSON(ctx, http.MethodGet, path, nil, &page); err != nil {
+		return nil, err
+	}
+	return &page, nil
+}
+
+// Cancel отменяет таску.
+func (c *Client) Cancel(ctx context.Context, taskID string) (*Task, error) {
+	var t Task
+	if err := c.doJSON(ctx, http.MethodDelete, taskPath(taskID, ""), nil, &t); err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// WaitForCompletion опрашивает статус, пока таска не завершится
+// (completed, failed или cancelled) или не истечет ctx.
+// Упавшая таска - не ошибка, смотрите Task.Status и Task.Errors.
+func (c *Client) WaitForCompletion(ctx context.Context, taskID string) (*Task, error) {
+	ticker := time.NewTicker(c.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		t, err := c.Status(ctx, taskID)
+		if err != nil {
+			return nil, err
+		}
+		if t.Status.IsFinished() {
+			return t, nil
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return t, ctx.Err()
+		}
+	}
+}
+
+// Download пишет архив таски в w и возвращает количество байт.
+// Если сервис прислал Repr-Digest или Digest с sha-256, архив сверяется
+// с ним, при несовпадении - ErrDigestMismatch (в w к этому времени уже все записано).
+func (c *Client) Download(ctx context.Context, taskID string, w io.Writer) (int64, error) {
+	resp, err := c.do(ctx, http.MethodGet, taskPath(taskID, "/archive"), nil)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	want := digestSHA256(resp.Header)
+	if want == "" {
+		return io.Copy(w, resp.Body)
+	}
+	h := sha256.New()
+	n, err := io.Copy(io.MultiWriter(w, h), resp.Body)
+	if err != nil {
+		return n, err
+	}
+	if got := base64.StdEncoding.EncodeToString(h.Sum(nil)); got != want {
+		return n, fmt.Errorf("%w: expected sha-256=%s, got %s", ErrDigestMismatch, want, got)
+	}
+	return n, nil
+}
+
+// digestSHA256 - sha-256 в base64 из Repr-Digest (RFC 9530) или Digest (RFC 3230),
+// "" - сервис его не прислал.
+func digestSHA256(h http.Header) string {
+	for _, d := range strings.Split(h.Get("Repr-Digest"), ",") {
+		if v, ok := strings.CutPrefix(strings.TrimSpace(d), "sha-256=:"); ok {
+			return strings.TrimSuffix(v, ":")
+		}
+	}
+	for _, d := range strings.Split(h.Get("Digest"), ",") {
+		alg, v, _ := strings.Cut(strings.TrimSpace(d), "=")
+		if strings.EqualFold(alg, "sha-256") {
+			return v
+		}
+	}
+	return ""
+}
@@ -1,9 +1,14 @@
 package config
 
 import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/url"
 	"os"
 	"strconv"
 	"strings"
+	"time"
 )
 
 type Config struct {
@@ -14,18 +19,308 @@ type Config struct {
 	TmpPath           string
 	AllowedExtensions []string
 	Mode              string
+	LogLevel          string
+	LogFormat         string
+	OTLPEndpoint      string // Пусто - трейсы никуда не отправляются.
+	ServiceName       string
+	ShutdownGrace     time.Duration
+	MinFreeDisk       int64
+	AdminToken        string // Bearer токен для /admin, пусто - админка выключена.
+	ArchiveManifest   bool   // Класть в архив manifest.json и README.txt, если таска не сказала иначе.
+
+	// Политика хранения: сколько живут таски в каждом статусе
+	// и сколько места на диске можно занять под архивы.
+	TTLPending      time.Duration
+	TTLCompleted    time.Duration
+	TTLFailed       time.Duration
+	MaxDiskUsage    int64
+	CleanupInterval time.Duration
+
+	// Кеш скачанных файлов, общий для всех тасок.
+	CacheDir     string // Пусто - TmpPath/cache.
+	CacheMaxSize int64  // 0 - кеш выключен.
+
+	// Общие лимиты на загрузки всех тасок, 0 - без ограничения.
+	DownloadMaxConns        int
+	DownloadMaxConnsPerHost int
+	DownloadBandwidth       int64 // Байт/с на весь сервис.
+	TaskBandwidth           int64 // Байт/с на одну таску.
+
+	// Защита от падающих хостов: после HostFailureThreshold неудач подряд
+	// хост отдыхает HostCooldown, 0 - выключено. И не чаще
+	// HostRequestsPerMin запросов на хост в минуту, 0 - без ограничения.
+	HostFailureThreshold int
+	HostCooldown         time.Duration
+	HostRequestsPerMin   int
+
+	// Как ходить в сеть за файлами, применяется только при старте.
+	DownloadProxy         string // http://, https:// или socks5://, пусто - HTTP(S)_PROXY из env.
+	DownloadNoProxy       string // Через запятую, как NO_PROXY, только для DownloadProxy.
+	DownloadCAFile        string // PEM с доп. CA.
+	DownloadClientCert    string // mTLS: сертификат и ключ, PEM.
+	DownloadClientKey     string
+	DownloadTLSMinVersion string // 1.0-1.3.
+
+	// Хосты, которые видны в лейбле host метрик, через запятую,
+	// остальные считаются как "other". Только при старте.
+	MetricsHosts string
 }
 
-// Конструктор конфига
+// MB - размеры в конфиге задаются в мегабайтах.
+const MB = 1024 * 1024
+
+// KB - полоса в конфиге задается в килобайтах в секунду.
+const KB = 1024
+
+// Default - значения по умолчанию, без env и файлов.
+func Default() *Config {
+	return &Config{
+		Port:              ":8080",
+		MaxTasks:          3,
+		MaxFiles:          3,
+		MaxFileSize:       300 * MB,
+		TmpPath:           "/tmp/archiver/",
+		AllowedExtensions: []string{".jpg", ".jepg", ".pdf"},
+		Mode:              "development",
+		LogLevel:          "info", // В MODE=debug - debug, см. defaultLogLevel.
+		LogFormat:         "text",
+		ServiceName:       "archiver_service",
+		ShutdownGrace:     30 * time.Second,
+		MinFreeDisk:       100 * MB,
+		ArchiveManifest:   true,
+
+		TTLPending:      time.Hour,
+		TTLCompleted:    time.Hour,
+		TTLFailed:       time.Hour,
+		CleanupInterval: time.Minute,
+
+		HostFailureThreshold: 5,
+		HostCooldown:         30 * time.Second,
+
+		DownloadTLSMinVersion: "1.2",
+	}
+}
+
+// defaultLogLevel - в debug режиме по умолчанию пишем debug логи, как раньше.
+func defaultLogLevel(mode string) string {
+	if mode == "debug" {
+		return "debug"
+	}
+	return "info"
+}
+
+// Конструктор конфига: только env, кривые значения молча заменяются дефолтами.
+// Сервис использует Load/Loader, там ошибки не прощаются.
 func NewConfig() *Config {
+	d := Default()
+	mode := getEnv("MODE", d.Mode)
+
 	return &Config{
-		Port:              getEnv("PORT", ":8080"),
-		MaxTasks:          parseInt8Env("MAX_TASKS", 3),
-		MaxFiles:          parseIntEnv("MAX_FILES", 3),
-		MaxFileSize:       parseInt64Env("MAX_FILE_SIZE_MB", 300) * 1024 * 1024,
-		TmpPath:           getEnv("TMP_PATH", "/tmp/archiver/"),
-		AllowedExtensions: strings.Split(getEnv("ALLOWED_EXT", ".jpg .jepg .pdf"), " "),
-		Mode:              getEnv("MODE", "development"),
+		Port:              getEnv("PORT", d.Port),
+		MaxTasks:          parseInt8Env("MAX_TASKS", d.MaxTasks),
+		MaxFiles:          parseIntEnv("MAX_FILES", d.MaxFiles),
+		MaxFileSize:       parseInt64Env("MAX_FILE_SIZE_MB", d.MaxFileSize/MB) * MB,
+		TmpPath:           getEnv("TMP_PATH", d.TmpPath),
+		AllowedExtensions: strings.Split(getEnv("ALLOWED_EXT", strings.Join(d.AllowedExtensions, " ")), " "),
+		Mode:              mode,
+		LogLevel:          getEnv("LOG_LEVEL", defaultLogLevel(mode)),
+		LogFormat:         getEnv("LOG_FORMAT", d.LogFormat),
+		OTLPEndpoint:      getEnv("OTEL_EXPORTER_OTLP_ENDPOINT", d.OTLPEndpoint),
+		ServiceName:       getEnv("OTEL_SERVICE_NAME", d.ServiceName),
+		ShutdownGrace:     parseDurationEnv("SHUTDOWN_GRACE", d.ShutdownGrace),
+		MinFreeDisk:       parseInt64Env("MIN_FREE_DISK_MB", d.MinFreeDisk/MB) * MB,
+		AdminToken:        getEnv("ADMIN_TOKEN", d.AdminToken),
+		ArchiveManifest:   parseBoolEnv("ARCHIVE_MANIFEST", d.ArchiveManifest),
+
+		TTLPending:      parseDurationEnv("TTL_PENDING", d.TTLPending),
+		TTLCompleted:    parseDurationEnv("TTL_COMPLETED", d.TTLCompleted),
+		TTLFailed:       parseDurationEnv("TTL_FAILED", d.TTLFailed),
+		MaxDiskUsage:    parseInt64Env("MAX_DISK_USAGE_MB", d.MaxDiskUsage/MB) * MB,
+		CleanupInterval: parseDurationEnv("CLEANUP_INTERVAL", d.CleanupInterval),
+
+		CacheDir:     getEnv("CACHE_DIR", d.CacheDir),
+		CacheMaxSize: parseInt64Env("CACHE_MAX_SIZE_MB", d.CacheMaxSize/MB) * MB,
+
+		DownloadMaxConns:        parseIntEnv("DOWNLOAD_MAX_CONNS", d.DownloadMaxConns),
+		DownloadMaxConnsPerHost: parseIntEnv("DOWNLOAD_MAX_CONNS_PER_HOST", d.DownloadMaxConnsPerHost),
+		DownloadBandwidth:       parseInt64Env("DOWNLOAD_BANDWIDTH_KB", d.DownloadBandwidth/KB) * KB,
+		TaskBandwidth:           parseInt64Env("TASK_BANDWIDTH_KB", d.TaskBandwidth/KB) * KB,
+
+		HostFailureThreshold: parseIntEnv("HOST_FAILURE_THRESHOLD", d.HostFailureThreshold),
+		HostCooldown:         parseDurationEnv("HOST_COOLDOWN", d.HostCooldown),
+		HostRequestsPerMin:   parseIntEnv("HOST_REQUESTS_PER_MIN", d.HostRequestsPerMin),
+
+		DownloadProxy:         getEnv("DOWNLOAD_PROXY", d.DownloadProxy),
+		DownloadNoProxy:       getEnv("DOWNLOAD_NO_PROXY", d.DownloadNoProxy),
+		DownloadCAFile:        getEnv("DOWNLOAD_CA_FILE", d.DownloadCAFile),
+		DownloadClientCert:    getEnv("DOWNLOAD_CLIENT_CERT", d.DownloadClientCert),
+		DownloadClientKey:     getEnv("DOWNLOAD_CLIENT_KEY", d.DownloadClientKey),
+		DownloadTLSMinVersion: getEnv("DOWNLOAD_TLS_MIN_VERSION", d.DownloadTLSMinVersion),
+
+		MetricsHosts: getEnv("METRICS_HOSTS", d.MetricsHosts),
+	}
+}
+
+// ErrInvalidConfig - конфиг не прошел Validate.
+var ErrInvalidConfig = errors.New("invalid config")
+
+// Validate проверяет значения, возвращает все ошибки сразу.
+func (c *Config) Validate() error {
+	if errs := c.problems(); len(errs) > 0 {
+		return fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+	}
+	return nil
+}
+
+func (c *Config) problems() []error {
+	var errs []error
+	if c.MaxTasks < 1 {
+		errs = append(errs, fmt.Errorf("MAX_TASKS must be at least 1, got %d", c.MaxTasks))
+	}
+	if c.MaxFiles < 1 {
+		errs = append(errs, fmt.Errorf("MAX_FILES must be at least 1, got %d", c.MaxFiles))
+	}
+	if c.MaxFileSize < 1 {
+		errs = append(errs, fmt.Errorf("MAX_FILE_SIZE_MB must be positive, got %d bytes", c.MaxFileSize))
+	}
+	if len(c.AllowedExtensions) == 0 {
+		errs = append(errs, errors.New("ALLOWED_EXT must not be empty"))
+	}
+	for _, ext := range c.AllowedExtensions {
+		if !strings.HasPrefix(ext, ".") || len(ext) < 2 {
+			errs = append(errs, fmt.Errorf("ALLOWED_EXT: %q must look like .pdf", ext))
+		}
+	}
+	if c.TmpPath == "" {
+		errs = append(errs, errors.New("TMP_PATH must not be empty"))
+	}
+	if c.Port == "" {
+		errs = append(errs, errors.New("PORT must not be empty"))
+	}
+	var lvl slog.Level
+	if err := lvl.UnmarshalText([]byte(c.LogLevel)); err != nil {
+		errs = append(errs, fmt.Errorf("LOG_LEVEL: %q is not one of debug, info, warn, error", c.LogLevel))
+	}
+	if f := strings.ToLower(c.LogFormat); f != "text" && f != "json" {
+		errs = append(errs, fmt.Errorf("LOG_FORMAT: %q is not one of text, json", c.LogFormat))
+	}
+	for _, d := range []struct {
+		key   string
+		value time.Duration
+	}{
+		{"SHUTDOWN_GRACE", c.ShutdownGrace},
+		{"TTL_PENDING", c.TTLPending},
+		{"TTL_COMPLETED", c.TTLCompleted},
+		{"TTL_FAILED", c.TTLFailed},
+		{"HOST_COOLDOWN", c.HostCooldown},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %s", d.key, d.value))
+		}
+	}
+	if c.CleanupInterval <= 0 {
+		errs = append(errs, fmt.Errorf("CLEANUP_INTERVAL must be positive, got %s", c.CleanupInterval))
+	}
+	if c.MinFreeDisk < 0 {
+		errs = append(errs, fmt.Errorf("MIN_FREE_DISK_MB must not be negative, got %d", c.MinFreeDisk/MB))
+	}
+	if c.MaxDiskUsage < 0 {
+		errs = append(errs, fmt.Errorf("MAX_DISK_USAGE_MB must not be negative, got %d", c.MaxDiskUsage/MB))
+	}
+	if c.CacheMaxSize < 0 {
+		errs = append(errs, fmt.Errorf("CACHE_MAX_SIZE_MB must not be negative, got %d", c.CacheMaxSize/MB))
+	}
+	for _, l := range []struct {
+		key   string
+		value int64
+	}{
+		{"DOWNLOAD_MAX_CONNS", int64(c.DownloadMaxConns)},
+		{"DOWNLOAD_MAX_CONNS_PER_HOST", int64(c.DownloadMaxConnsPerHost)},
+		{"DOWNLOAD_BANDWIDTH_KB", c.DownloadBandwidth / KB},
+		{"TASK_BANDWIDTH_KB", c.TaskBandwidth / KB},
+		{"HOST_FAILURE_THRESHOLD", int64(c.HostFailureThreshold)},
+		{"HOST_REQUESTS_PER_MIN", int64(c.HostRequestsPerMin)},
+	} {
+		if l.value < 0 {
+			errs = append(errs, fmt.Errorf("%s must not be negative, got %d", l.key, l.value))
+		}
+	}
+	if c.DownloadProxy != "" {
+		u, err := url.Parse(c.DownloadProxy)
+		if err != nil || u.Host == "" || (u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "socks5") {
+			errs = append(errs, fmt.Errorf("DOWNLOAD_PROXY: %q must look like http://proxy:3128 or socks5://proxy:1080", redactURL(c.DownloadProxy)))
+		}
+	}
+	if (c.DownloadClientCert == "") != (c.DownloadClientKey == "") {
+		errs = append(errs, errors.New("DOWNLOAD_CLIENT_CERT and DOWNLOAD_CLIENT_KEY must be set together"))
+	}
+	switch c.DownloadTLSMinVersion {
+	case "1.0", "1.1", "1.2", "1.3":
+	default:
+		errs = append(errs, fmt.Errorf("DOWNLOAD_TLS_MIN_VERSION: %q is not one of 1.0, 1.1, 1.2, 1.3", c.DownloadTLSMinVersion))
+	}
+	return errs
+}
+
+// redactURL прячет пароль из url, чтобы он не попал в логи и /admin/config.
+func redactURL(s string) string {
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Redacted()
+}
+
+// LiveKeys - настройки, которые применяются без перезапуска.
+// Остальные при перечитывании игнорируются до рестарта.
+var LiveKeys = []string{"MAX_TASKS", "MAX_FILES", "MAX_FILE_SIZE_MB", "ALLOWED_EXT", "ARCHIVE_MANIFEST",
+	"DOWNLOAD_MAX_CONNS", "DOWNLOAD_MAX_CONNS_PER_HOST", "DOWNLOAD_BANDWIDTH_KB", "TASK_BANDWIDTH_KB",
+	"HOST_FAILURE_THRESHOLD", "HOST_COOLDOWN", "HOST_REQUESTS_PER_MIN"}
+
+// Values - конфиг в виде переменных окружения, в тех же единицах (MB, 30s),
+// токен скрыт. Для /admin/config и логов.
+func (c *Config) Values() map[string]string {
+	token := ""
+	if c.AdminToken != "" {
+		token = "***"
+	}
+	return map[string]string{
+		"PORT":                        c.Port,
+		"MAX_TASKS":                   strconv.Itoa(int(c.MaxTasks)),
+		"MAX_FILES":                   strconv.Itoa(c.MaxFiles),
+		"MAX_FILE_SIZE_MB":            strconv.FormatInt(c.MaxFileSize/MB, 10),
+		"TMP_PATH":                    c.TmpPath,
+		"ALLOWED_EXT":                 strings.Join(c.AllowedExtensions, " "),
+		"MODE":                        c.Mode,
+		"LOG_LEVEL":                   c.LogLevel,
+		"LOG_FORMAT":                  c.LogFormat,
+		"OTEL_EXPORTER_OTLP_ENDPOINT": c.OTLPEndpoint,
+		"OTEL_SERVICE_NAME":           c.ServiceName,
+		"SHUTDOWN_GRACE":              c.ShutdownGrace.String(),
+		"MIN_FREE_DISK_MB":            strconv.FormatInt(c.MinFreeDisk/MB, 10),
+		"ADMIN_TOKEN":                 token,
+		"ARCHIVE_MANIFEST":            strconv.FormatBool(c.ArchiveManifest),
+		"TTL_PENDING":                 c.TTLPending.String(),
+		"TTL_COMPLETED":               c.TTLCompleted.String(),
+		"TTL_FAILED":                  c.TTLFailed.String(),
+		"MAX_DISK_USAGE_MB":           strconv.FormatInt(c.MaxDiskUsage/MB, 10),
+		"CLEANUP_INTERVAL":            c.CleanupInterval.String(),
+		"CACHE_DIR":                   c.CacheDir,
+		"CACHE_MAX_SIZE_MB":           strconv.FormatInt(c.CacheMaxSize/MB, 10),
+		"DOWNLOAD_MAX_CONNS":          strconv.Itoa(c.DownloadMaxConns),
+		"DOWNLOAD_MAX_CONNS_PER_HOST": strconv.Itoa(c.DownloadMaxConnsPerHost),
+		"DOWNLOAD_BANDWIDTH_KB":       strconv.FormatInt(c.DownloadBandwidth/KB, 10),
+		"TASK_BANDWIDTH_KB":           strconv.FormatInt(c.TaskBandwidth/KB, 10),
+		"HOST_FAILURE_THRESHOLD":      strconv.Itoa(c.HostFailureThreshold),
+		"HOST_COOLDOWN":               c.HostCooldown.String(),
+		"HOST_REQUESTS_PER_MIN":       strconv.Itoa(c.HostRequestsPerMin),
+		"DOWNLOAD_PROXY":              redactURL(c.DownloadProxy),
+		"DOWNLOAD_NO_PROXY":           c.DownloadNoProxy,
+		"DOWNLOAD_CA_FILE":            c.DownloadCAFile,
+		"DOWNLOAD_CLIENT_CERT":        c.DownloadClientCert,
+		"DOWNLOAD_CLIENT_KEY":         c.DownloadClientKey,
+		"DOWNLOAD_TLS_MIN_VERSION":    c.DownloadTLSMinVersion,
+		"METRICS_HOSTS":               c.MetricsHosts,
 	}
 }
 
@@ -41,12 +336,12 @@ func parseIntEnv(key string, defaultValue int) int {
 	if valueStr == "" {
 		return defaultValue
 	}
-	value, err := strconv.ParseInt(valueStr, 10, 8)
+	value, err := strconv.Atoi(valueStr) // Было ParseInt(..., 8): MAX_FILES=1000 молча превращался в 3.
 	if err != nil {
 		return defaultValue
 	}
 
-	return int(value)
+	return value
 }
 
 // Это можно просто с помощью parseIntEnv, но я написал это перевее
@@ -75,3 +370,25 @@ func parseInt64Env(key string, defaultValue int64) int64 {
 
 	return value
 }
+
+func parseBoolEnv(key string, defaultValue bool) bool {
+	value, err := strconv.ParseBool(os.Getenv(key))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// Длительность в формате time.ParseDuration: 30m, 1h, 24h.
+func parseDurationEnv(key string, defaultValue time.Duration) time.Duration {
+	valueStr := os.Getenv(key)
+	if valueStr == "" {
+		return defaultValue
+	}
+	value, err := time.ParseDuration(valueStr)
+	if err != nil {
+		return defaultValue
+	}
+
+	return value
+}
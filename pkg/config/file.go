@@ -0,0 +1,228 @@
+package config
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Парсеры файлов конфига. Конфиг плоский (ключ - значение, списки строк),
+// поэтому хватает простых разборщиков на stdlib, без зависимостей:
+// вложенные таблицы, якоря и многострочные строки не поддерживаются.
+// Значения приводятся к строке, как в env, списки склеиваются через пробел.
+
+// parseJSON: {"max_files": 10, "allowed_ext": [".pdf", ".jpg"]}.
+func parseJSON(data []byte) (map[string]string, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]any
+	if err := dec.Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string, len(raw))
+	for k, v := range raw {
+		switch v := v.(type) {
+		case string:
+			values[k] = v
+		case json.Number:
+			values[k] = v.String()
+		case bool:
+			values[k] = strconv.FormatBool(v)
+		case []any:
+			items := make([]string, 0, len(v))
+			for _, item := range v {
+				s, ok := item.(string)
+				if !ok {
+					return nil, fmt.Errorf("%s: only lists of strings are supported", k)
+				}
+				items = append(items, s)
+			}
+			values[k] = strings.Join(items, " ")
+		default:
+			return nil, fmt.Errorf("%s: nested values are not supported", k)
+		}
+	}
+	return values, nil
+}
+
+// parseYAML: плоский YAML.
+//
+//	max_files: 10
+//	allowed_ext: [.pdf, .jpg]
+//	allowed_ext:
+//	  - .pdf
+//	  - .jpg
+func parseYAML(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	var listKey string // Ключ, под которым идет блочный список "- item".
+	var list []string
+
+	flush := func() {
+		if listKey != "" {
+			values[listKey] = strings.Join(list, " ")
+		}
+		listKey, list = "", nil
+	}
+
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := stripComment(sc.Text())
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || trimmed == "---" {
+			continue
+		}
+
+		if item, ok := strings.CutPrefix(trimmed, "- "); ok && listKey != "" {
+			list = append(list, unquote(strings.TrimSpace(item)))
+			continue
+		}
+		if line[0] == ' ' || line[0] == '\t' {
+			return nil, fmt.Errorf("line %d: nested values are not supported", n)
+		}
+		flush()
+
+		key, value, ok := strings.Cut(trimmed, ":")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want key: value", n)
+		}
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		switch {
+		case value == "":
+			listKey = key
+		case strings.HasPrefix(value, "["):
+			items, err := parseList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			values[key] = strings.Join(items, " ")
+		default:
+			values[key] = unquote(value)
+		}
+	}
+	flush()
+	return values, sc.Err()
+}
+
+// parseTOML: плоский TOML без таблиц.
+//
+//	max_files = 10
+//	allowed_ext = [".pdf", ".jpg"]
+//	shutdown_grace = "30s"
+func parseTOML(data []byte) (map[string]string, error) {
+	values := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(stripComment(sc.Text()))
+		if line == "" {
+			continue
+		}
+		if strings.HasPrefix(line, "[") {
+			return nil, fmt.Errorf("line %d: tables are not supported", n)
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("line %d: want key = value", n)
+		}
+		key, value = unquote(strings.TrimSpace(key)), strings.TrimSpace(value)
+		if strings.HasPrefix(value, "[") {
+			items, err := parseList(value)
+			if err != nil {
+				return nil, fmt.Errorf("line %d: %w", n, err)
+			}
+			values[key] = strings.Join(items, " ")
+			continue
+		}
+		values[key] = unquote(value)
+	}
+	return values, sc.Err()
+}
+
+// readDotEnv читает .env: KEY=value, можно с export и кавычками.
+// Незнакомые ключи пропускаются, в .env обычно лежит и чужое.
+func readDotEnv(name string) (map[string]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]string)
+	sc := bufio.NewScanner(bytes.NewReader(data))
+	for n := 1; sc.Scan(); n++ {
+		line := strings.TrimSpace(sc.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimPrefix(line, "export ")
+		key, value, ok := strings.Cut(line, "=")
+		if !ok {
+			return nil, fmt.Errorf("%s: line %d: want KEY=value", name, n)
+		}
+		key = strings.TrimSpace(key)
+		if _, ok := findField(key); !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if !strings.HasPrefix(value, `"`) && !strings.HasPrefix(value, "'") {
+			value = strings.TrimSpace(stripComment(value))
+		}
+		// Пустое значение, как и в env, значит "не задано".
+		if value = unquote(value); value != "" {
+			values[key] = value
+		}
+	}
+	return values, sc.Err()
+}
+
+// parseList: [a, "b", 'c'].
+func parseList(s string) ([]string, error) {
+	inner, ok := strings.CutPrefix(s, "[")
+	if inner, ok = strings.CutSuffix(inner, "]"); !ok {
+		return nil, errors.New("unterminated list")
+	}
+	var items []string
+	for _, item := range strings.Split(inner, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, unquote(item))
+		}
+	}
+	return items, nil
+}
+
+// stripComment отрезает # комментарий, если # не внутри кавычек.
+func stripComment(line string) string {
+	var quote rune
+	for i, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == '#' && (i == 0 || line[i-1] == ' ' || line[i-1] == '\t'):
+			return line[:i]
+		}
+	}
+	return line
+}
+
+func unquote(s string) string {
+	if len(s) >= 2 {
+		switch {
+		case s[0] == '"' && s[len(s)-1] == '"':
+			if u, err := strconv.Unquote(s); err == nil {
+				return u
+			}
+			return s[1 : len(s)-1]
+		case s[0] == '\'' && s[len(s)-1] == '\'':
+			return s[1 : len(s)-1]
+		}
+	}
+	return s
+}
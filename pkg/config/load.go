@@ -0,0 +1,381 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Откуда взялось значение, по возрастанию приоритета.
+const (
+	SourceDefault = "default"
+	SourceFile    = "file"
+	SourceDotEnv  = ".env"
+	SourceEnv     = "env"
+	SourceFlag    = "flag"
+)
+
+// field - одна настройка: ключ как у переменной окружения и строгий парсер.
+type field struct {
+	key  string
+	help string
+	set  func(c *Config, v string) error
+}
+
+// fields - все настройки. Ключи те же, что в env, в файле можно писать
+// и в нижнем регистре (max_files), флаги - через дефис (-max-files).
+var fields = []field{
+	{"PORT", "listen address", func(c *Config, v string) error { c.Port = v; return nil }},
+	{"MAX_TASKS", "max tasks at once (1-127)", func(c *Config, v string) error {
+		n, err := parseNumber(v, math.MinInt8, math.MaxInt8)
+		if err == nil {
+			c.MaxTasks = int8(n)
+		}
+		return err
+	}},
+	{"MAX_FILES", "max urls in a task", func(c *Config, v string) error {
+		n, err := parseNumber(v, math.MinInt32, math.MaxInt32)
+		if err == nil {
+			c.MaxFiles = int(n)
+		}
+		return err
+	}},
+	{"MAX_FILE_SIZE_MB", "max file size, MB", func(c *Config, v string) error { return setMB(&c.MaxFileSize, v) }},
+	{"TMP_PATH", "directory for downloads and archives", func(c *Config, v string) error { c.TmpPath = v; return nil }},
+	{"ALLOWED_EXT", "allowed extensions, space separated", func(c *Config, v string) error {
+		c.AllowedExtensions = strings.Fields(v)
+		return nil
+	}},
+	{"MODE", "development, debug or production", func(c *Config, v string) error { c.Mode = v; return nil }},
+	{"LOG_LEVEL", "debug, info, warn or error", func(c *Config, v string) error { c.LogLevel = v; return nil }},
+	{"LOG_FORMAT", "text or json", func(c *Config, v string) error { c.LogFormat = v; return nil }},
+	{"OTEL_EXPORTER_OTLP_ENDPOINT", "OTLP/HTTP collector address", func(c *Config, v string) error { c.OTLPEndpoint = v; return nil }},
+	{"OTEL_SERVICE_NAME", "service name in traces", func(c *Config, v string) error { c.ServiceName = v; return nil }},
+	{"SHUTDOWN_GRACE", "how long to wait for tasks on shutdown", func(c *Config, v string) error { return setDuration(&c.ShutdownGrace, v) }},
+	{"MIN_FREE_DISK_MB", "min free space in TMP_PATH for /readyz, MB", func(c *Config, v string) error { return setMB(&c.MinFreeDisk, v) }},
+	{"ADMIN_TOKEN", "bearer token for /admin", func(c *Config, v string) error { c.AdminToken = v; return nil }},
+	{"ARCHIVE_MANIFEST", "add manifest.json and README.txt to archives (true/false)", func(c *Config, v string) error {
+		b, err := strconv.ParseBool(strings.TrimSpace(v))
+		if err != nil {
+			return errors.New("not a bool, want true or false")
+		}
+		c.ArchiveManifest = b
+		return nil
+	}},
+	{"TTL_PENDING", "how long pending tasks live", func(c *Config, v string) error { return setDuration(&c.TTLPending, v) }},
+	{"TTL_COMPLETED", "how long completed tasks live", func(c *Config, v string) error { return setDuration(&c.TTLCompleted, v) }},
+	{"TTL_FAILED", "how long failed and cancelled tasks live", func(c *Config, v string) error { return setDuration(&c.TTLFailed, v) }},
+	{"MAX_DISK_USAGE_MB", "disk budget for archives, MB, 0 - unlimited", func(c *Config, v string) error { return setMB(&c.MaxDiskUsage, v) }},
+	{"CLEANUP_INTERVAL", "how often to clean up", func(c *Config, v string) error { return setDuration(&c.CleanupInterval, v) }},
+	{"CACHE_DIR", "download cache directory, default TMP_PATH/cache", func(c *Config, v string) error { c.CacheDir = v; return nil }},
+	{"CACHE_MAX_SIZE_MB", "download cache size, MB, 0 - no cache", func(c *Config, v string) error { return setMB(&c.CacheMaxSize, v) }},
+	{"DOWNLOAD_MAX_CONNS", "max downloads at once across all tasks, 0 - unlimited", func(c *Config, v string) error {
+		return setInt(&c.DownloadMaxConns, v)
+	}},
+	{"DOWNLOAD_MAX_CONNS_PER_HOST", "max downloads at once from one host, 0 - unlimited", func(c *Config, v string) error {
+		return setInt(&c.DownloadMaxConnsPerHost, v)
+	}},
+	{"DOWNLOAD_BANDWIDTH_KB", "download bandwidth for the whole service, KB/s, 0 - unlimited", func(c *Config, v string) error {
+		return setKB(&c.DownloadBandwidth, v)
+	}},
+	{"TASK_BANDWIDTH_KB", "download bandwidth for one task, KB/s, 0 - unlimited", func(c *Config, v string) error {
+		return setKB(&c.TaskBandwidth, v)
+	}},
+	{"HOST_FAILURE_THRESHOLD", "failures in a row to pause a host, 0 - never", func(c *Config, v string) error {
+		return setInt(&c.HostFailureThreshold, v)
+	}},
+	{"HOST_COOLDOWN", "how long a failing host is paused", func(c *Config, v string) error { return setDuration(&c.HostCooldown, v) }},
+	{"HOST_REQUESTS_PER_MIN", "max requests per minute to one host, 0 - unlimited", func(c *Config, v string) error {
+		return setInt(&c.HostRequestsPerMin, v)
+	}},
+	{"DOWNLOAD_PROXY", "proxy for downloads: http://, https:// or socks5://, default HTTP(S)_PROXY", func(c *Config, v string) error {
+		c.DownloadProxy = v
+		return nil
+	}},
+	{"DOWNLOAD_NO_PROXY", "hosts to download without DOWNLOAD_PROXY, comma separated", func(c *Config, v string) error {
+		c.DownloadNoProxy = v
+		return nil
+	}},
+	{"DOWNLOAD_CA_FILE", "extra CA certificates for downloads, PEM", func(c *Config, v string) error { c.DownloadCAFile = v; return nil }},
+	{"DOWNLOAD_CLIENT_CERT", "client certificate for mTLS, PEM", func(c *Config, v string) error { c.DownloadClientCert = v; return nil }},
+	{"DOWNLOAD_CLIENT_KEY", "client certificate key for mTLS, PEM", func(c *Config, v string) error { c.DownloadClientKey = v; return nil }},
+	{"DOWNLOAD_TLS_MIN_VERSION", "minimum TLS version for downloads: 1.0-1.3", func(c *Config, v string) error {
+		c.DownloadTLSMinVersion = strings.TrimSpace(v)
+		return nil
+	}},
+	{"METRICS_HOSTS", "hosts shown in the host label of metrics, comma separated, others are \"other\"", func(c *Config, v string) error {
+		c.MetricsHosts = v
+		return nil
+	}},
+}
+
+// Keys - все ключи конфига в порядке объявления.
+func Keys() []string {
+	keys := make([]string, len(fields))
+	for i, f := range fields {
+		keys[i] = f.key
+	}
+	return keys
+}
+
+// Set задает один ключ (как в env) тем же строгим парсером, что и при загрузке:
+// MAX_TASKS=-1000 или MAX_FILE_SIZE_MB с переполнением - ошибка, а не мусор.
+// Validate после Set - на вызывающем.
+func (c *Config) Set(key, value string) error {
+	f, ok := findField(normalizeKey(key))
+	if !ok {
+		return fmt.Errorf("%w: unknown key %s", ErrInvalidConfig, key)
+	}
+	if err := f.set(c, value); err != nil {
+		return fmt.Errorf("%w: %s=%q: %w", ErrInvalidConfig, f.key, value, err)
+	}
+	return nil
+}
+
+func findField(key string) (field, bool) {
+	for _, f := range fields {
+		if f.key == key {
+			return f, true
+		}
+	}
+	return field{}, false
+}
+
+// normalizeKey: max-files, max_files и MAX_FILES - один ключ.
+func normalizeKey(key string) string {
+	return strings.ToUpper(strings.ReplaceAll(strings.TrimSpace(key), "-", "_"))
+}
+
+func flagName(key string) string {
+	return strings.ToLower(strings.ReplaceAll(key, "_", "-"))
+}
+
+// Loader собирает конфиг из нескольких мест, по убыванию приоритета:
+// флаги > env > .env > файл конфига > значения по умолчанию.
+// В отличие от NewConfig, кривые значения - ошибка, и сообщаются все сразу.
+//
+// Один Loader можно звать много раз (SIGHUP): файлы перечитываются,
+// флаги остаются те же.
+type Loader struct {
+	File    string            // Файл конфига (.json, .yaml, .yml, .toml), пусто - $CONFIG_FILE.
+	EnvFile string            // .env файл, пусто - ./.env, если он есть.
+	Flags   map[string]string // Значения из командной строки, ключи как в env.
+}
+
+// Load - Loader без флагов: $CONFIG_FILE, ./.env и env.
+func Load() (*Config, error) {
+	return (&Loader{}).Load()
+}
+
+// RegisterFlags добавляет в fs -config, -env-file и по флагу на каждый ключ
+// (-max-files и т.д.). В Flags попадают только явно заданные.
+func (l *Loader) RegisterFlags(fs *flag.FlagSet) {
+	fs.StringVar(&l.File, "config", l.File, "config file (.json, .yaml, .toml), default $CONFIG_FILE")
+	fs.StringVar(&l.EnvFile, "env-file", l.EnvFile, "dotenv file, default ./.env if it exists")
+	for _, f := range fields {
+		fs.Var(&flagValue{l: l, key: f.key}, flagName(f.key), f.help+" ("+f.key+")")
+	}
+}
+
+// flagValue пишет значение флага в Loader.Flags.
+type flagValue struct {
+	l   *Loader
+	key string
+}
+
+func (v *flagValue) String() string {
+	if v.l == nil {
+		return ""
+	}
+	return v.l.Flags[v.key]
+}
+
+func (v *flagValue) Set(s string) error {
+	if v.l.Flags == nil {
+		v.l.Flags = make(map[string]string)
+	}
+	v.l.Flags[v.key] = s
+	return nil
+}
+
+// Load собирает и проверяет конфиг.
+// Ошибки: ErrInvalidConfig со всеми проблемами сразу, или ошибка чтения файла.
+func (l *Loader) Load() (*Config, error) {
+	cfg, _, err := l.LoadWithSources()
+	return cfg, err
+}
+
+// LoadWithSources - как Load, плюс откуда взялся каждый ключ (SourceEnv и т.п.).
+func (l *Loader) LoadWithSources() (*Config, map[string]string, error) {
+	values, sources, err := l.collect()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	cfg := Default()
+	var errs []error
+	for _, f := range fields {
+		v, ok := values[f.key]
+		if !ok {
+			continue
+		}
+		if err := f.set(cfg, v); err != nil {
+			errs = append(errs, fmt.Errorf("%s=%q (%s): %w", f.key, v, sources[f.key], err))
+		}
+	}
+	if _, ok := values["LOG_LEVEL"]; !ok {
+		cfg.LogLevel = defaultLogLevel(cfg.Mode)
+		sources["LOG_LEVEL"] = SourceDefault
+	}
+
+	errs = append(errs, cfg.problems()...)
+	if len(errs) > 0 {
+		return nil, nil, fmt.Errorf("%w: %w", ErrInvalidConfig, errors.Join(errs...))
+	}
+	return cfg, sources, nil
+}
+
+// collect сводит все источники в ключ -> значение, старшие перекрывают младших.
+func (l *Loader) collect() (map[string]string, map[string]string, error) {
+	values := make(map[string]string)
+	sources := make(map[string]string)
+	for _, key := range Keys() {
+		sources[key] = SourceDefault
+	}
+	put := func(layer map[string]string, source string) {
+		for k, v := range layer {
+			values[k] = v
+			sources[k] = source
+		}
+	}
+
+	file := l.File
+	if file == "" {
+		file = os.Getenv("CONFIG_FILE")
+	}
+	if file != "" {
+		layer, err := readConfigFile(file)
+		if err != nil {
+			return nil, nil, err
+		}
+		put(layer, SourceFile)
+	}
+
+	envFile, required := l.EnvFile, true
+	if envFile == "" {
+		envFile, required = ".env", false
+	}
+	layer, err := readDotEnv(envFile)
+	switch {
+	case err == nil:
+		put(layer, SourceDotEnv)
+	case errors.Is(err, os.ErrNotExist) && !required:
+	default:
+		return nil, nil, err
+	}
+
+	// Пустая переменная - как не заданная, так было и в NewConfig.
+	env := make(map[string]string)
+	for _, key := range Keys() {
+		if v := os.Getenv(key); v != "" {
+			env[key] = v
+		}
+	}
+	put(env, SourceEnv)
+	put(l.Flags, SourceFlag)
+	return values, sources, nil
+}
+
+// readConfigFile читает плоский файл конфига, формат по расширению.
+// Незнакомые ключи - ошибка: опечатка не должна молча превращаться в дефолт.
+func readConfigFile(name string) (map[string]string, error) {
+	data, err := os.ReadFile(name)
+	if err != nil {
+		return nil, fmt.Errorf("config file: %w", err)
+	}
+
+	var raw map[string]string
+	switch ext := strings.ToLower(filepath.Ext(name)); ext {
+	case ".json":
+		raw, err = parseJSON(data)
+	case ".yaml", ".yml":
+		raw, err = parseYAML(data)
+	case ".toml":
+		raw, err = parseTOML(data)
+	default:
+		return nil, fmt.Errorf("config file %s: unknown format %q, want .json, .yaml or .toml", name, ext)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("config file %s: %w", name, err)
+	}
+
+	values := make(map[string]string, len(raw))
+	var unknown []error
+	for k, v := range raw {
+		key := normalizeKey(k)
+		if _, ok := findField(key); !ok {
+			unknown = append(unknown, fmt.Errorf("unknown key %q", k))
+			continue
+		}
+		values[key] = v
+	}
+	if len(unknown) > 0 {
+		return nil, fmt.Errorf("%w: config file %s: %w", ErrInvalidConfig, name, errors.Join(unknown...))
+	}
+	return values, nil
+}
+
+// ----- Строгие парсеры значений -----
+
+func parseNumber(v string, lo, hi int64) (int64, error) {
+	n, err := strconv.ParseInt(strings.TrimSpace(v), 10, 64)
+	if err != nil {
+		return 0, errors.New("not an integer")
+	}
+	if n < lo || n > hi {
+		return 0, fmt.Errorf("out of range, max %d", hi)
+	}
+	return n, nil
+}
+
+func setMB(dst *int64, v string) error {
+	n, err := parseNumber(v, math.MinInt64/MB, math.MaxInt64/MB)
+	if err != nil {
+		return err
+	}
+	*dst = n * MB
+	return nil
+}
+
+func setInt(dst *int, v string) error {
+	n, err := parseNumber(v, math.MinInt32, math.MaxInt32)
+	if err != nil {
+		return err
+	}
+	*dst = int(n)
+	return nil
+}
+
+func setKB(dst *int64, v string) error {
+	n, err := parseNumber(v, math.MinInt64/KB, math.MaxInt64/KB)
+	if err != nil {
+		return err
+	}
+	*dst = n * KB
+	return nil
+}
+
+func setDuration(dst *time.Duration, v string) error {
+	d, err := time.ParseDuration(strings.TrimSpace(v))
+	if err != nil {
+		return errors.New("not a duration, want e.g. 30s, 5m, 1h")
+	}
+	*dst = d
+	return nil
+}
@@ -0,0 +1,188 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func writeFile(t *testing.T, name, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatalf("Failed to write %s: %v", name, err)
+	}
+	return path
+}
+
+func TestLoader_FileFormats(t *testing.T) {
+	clearEnvVars()
+	defer clearEnvVars()
+
+	files := map[string]string{
+		"config.json": `{"max_files": 1000, "allowed_ext": [".pdf", ".png"], "shutdown_grace": "10s", "LOG_FORMAT": "json"}`,
+		"config.yaml": `# комментарий
+max_files: 1000
+allowed_ext:
+  - .pdf
+  - ".png"
+shutdown_grace: 10s # тоже комментарий
+LOG_FORMAT: 'json'
+`,
+		"config.toml": `# комментарий
+max-files = 1000
+allowed_ext = [".pdf", ".png"]
+shutdown_grace = "10s"
+LOG_FORMAT = "json"
+`,
+	}
+	for name, content := range files {
+		t.Run(name, func(t *testing.T) {
+			cfg, err := (&Loader{File: writeFile(t, name, content)}).Load()
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			if cfg.MaxFiles != 1000 {
+				t.Errorf("Expected MaxFiles 1000, got %d", cfg.MaxFiles)
+			}
+			if !reflect.DeepEqual(cfg.AllowedExtensions, []string{".pdf", ".png"}) {
+				t.Errorf("Expected [.pdf .png], got %v", cfg.AllowedExtensions)
+			}
+			if cfg.ShutdownGrace != 10*time.Second || cfg.LogFormat != "json" {
+				t.Errorf("Unexpected config: %+v", cfg)
+			}
+			if cfg.Port != ":8080" {
+				t.Errorf("Expected default Port, got %q", cfg.Port)
+			}
+		})
+	}
+}
+
+func TestLoader_Precedence(t *testing.T) {
+	clearEnvVars()
+	defer clearEnvVars()
+
+	file := writeFile(t, "config.yaml", "max_tasks: 1\nmax_files: 1\nmax_file_size_mb: 1\nmode: debug\n")
+	dotenv := writeFile(t, ".env", "# комментарий\nexport MAX_FILES=2\nMAX_FILE_SIZE_MB=\"2\"\nMAX_TASKS=2\nOTHER_APP_KEY=x\n")
+	setEnvOrFatal(t, "MAX_FILES", "3")
+	setEnvOrFatal(t, "MAX_TASKS", "3")
+
+	l := &Loader{}
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	l.RegisterFlags(fs)
+	if err := fs.Parse([]string{"-config", file, "-env-file", dotenv, "-max-tasks", "4"}); err != nil {
+		t.Fatalf("Parse: %v", err)
+	}
+
+	cfg, sources, err := l.LoadWithSources()
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	checks := []struct {
+		key    string
+		got    int64
+		want   int64
+		source string
+	}{
+		{"MAX_TASKS", int64(cfg.MaxTasks), 4, SourceFlag},
+		{"MAX_FILES", int64(cfg.MaxFiles), 3, SourceEnv},
+		{"MAX_FILE_SIZE_MB", cfg.MaxFileSize / MB, 2, SourceDotEnv},
+		{"MIN_FREE_DISK_MB", cfg.MinFreeDisk / MB, 100, SourceDefault},
+	}
+	for _, c := range checks {
+		if c.got != c.want || sources[c.key] != c.source {
+			t.Errorf("%s: expected %d from %s, got %d from %s", c.key, c.want, c.source, c.got, sources[c.key])
+		}
+	}
+	if cfg.Mode != "debug" || cfg.LogLevel != "debug" {
+		t.Errorf("Expected debug mode from file with debug logs, got %q/%q", cfg.Mode, cfg.LogLevel)
+	}
+}
+
+func TestLoader_ReportsAllErrors(t *testing.T) {
+	clearEnvVars()
+	defer clearEnvVars()
+	setEnvOrFatal(t, "MAX_TASKS", "1000")
+	setEnvOrFatal(t, "MAX_FILES", "many")
+	setEnvOrFatal(t, "TTL_PENDING", "1 hour")
+	setEnvOrFatal(t, "LOG_FORMAT", "xml")
+
+	_, err := (&Loader{}).Load()
+	if !errors.Is(err, ErrInvalidConfig) {
+		t.Fatalf("Expected ErrInvalidConfig, got %v", err)
+	}
+	for _, key := range []string{"MAX_TASKS", "MAX_FILES", "TTL_PENDING", "LOG_FORMAT"} {
+		if !strings.Contains(err.Error(), key) {
+			t.Errorf("Expected error to mention %s, got %v", key, err)
+		}
+	}
+}
+
+func TestLoader_FileErrors(t *testing.T) {
+	clearEnvVars()
+	defer clearEnvVars()
+
+	tests := []struct {
+		name    string
+		file    string
+		content string
+	}{
+		{"unknown key", "config.yaml", "max_file: 10\n"},
+		{"nested yaml", "config.yaml", "limits:\n  max_files: 10\n"},
+		{"toml table", "config.toml", "[limits]\nmax_files = 10\n"},
+		{"nested json", "config.json", `{"limits": {"max_files": 10}}`},
+		{"unknown format", "config.ini", "max_files=10\n"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := (&Loader{File: writeFile(t, tt.file, tt.content)}).Load(); err == nil {
+				t.Error("Expected error, got nil")
+			}
+		})
+	}
+
+	if _, err := (&Loader{EnvFile: filepath.Join(t.TempDir(), "missing.env")}).Load(); err == nil {
+		t.Error("Expected error for missing explicit .env")
+	}
+}
+
+func TestKeysMatchValues(t *testing.T) {
+	values := Default().Values()
+	keys := Keys()
+	if len(keys) != len(values) {
+		t.Errorf("Expected %d keys, got %d", len(values), len(keys))
+	}
+	for _, key := range keys {
+		if _, ok := values[key]; !ok {
+			t.Errorf("Key %s is missing in Values", key)
+		}
+	}
+}
+
+func TestConfig_Set(t *testing.T) {
+	c := Default()
+	if err := c.Set("max-tasks", "7"); err != nil || c.MaxTasks != 7 {
+		t.Errorf("Expected MaxTasks 7, got %d (%v)", c.MaxTasks, err)
+	}
+	for _, kv := range [][2]string{
+		{"MAX_TASKS", "-1000"},
+		{"MAX_TASKS", "300"},
+		{"MAX_FILE_SIZE_MB", "9007199254740991"},
+		{"DOWNLOAD_BANDWIDTH_KB", "-9223372036854775807"},
+		{"MAX_FILES", "99999999999"},
+		{"HOST_COOLDOWN", "soon"},
+		{"NOPE", "1"},
+	} {
+		if err := c.Set(kv[0], kv[1]); !errors.Is(err, ErrInvalidConfig) {
+			t.Errorf("%s=%s: expected ErrInvalidConfig, got %v", kv[0], kv[1], err)
+		}
+	}
+	if c.MaxTasks != 7 || c.MaxFileSize != Default().MaxFileSize {
+		t.Errorf("Expected rejected values not to change the config, got %d %d", c.MaxTasks, c.MaxFileSize)
+	}
+}